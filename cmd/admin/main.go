@@ -0,0 +1,141 @@
+// Command admin runs maintenance tasks against the same database and storage
+// as the server.
+//
+//	admin regenerate-thumbnails
+//	admin scrub
+//	admin rewrap-keys
+//	admin encrypt-storage
+//	admin backfill-versions [file]
+package main
+
+import (
+	"HttpServer/internal/app"
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const usage = `usage: admin <command>
+
+commands:
+  regenerate-thumbnails  remake the thumbnails of every image document
+  scrub                  check stored content for missing, corrupted and
+                         orphaned blobs; exits with 1 if any are found
+  rewrap-keys            wrap the data keys of encrypted files with the
+                         current master key, the last one of the key file
+  encrypt-storage        encrypt the files stored before encryption was
+                         enabled; afterwards files in the clear are refused
+  backfill-versions [file]
+                         give documents saved before versions existed their
+                         stored file as version 1; file has one line per
+                         document with its id, a tab and the storage key of
+                         its file. Documents left without are listed`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	ctx := context.Background()
+
+	a, err := app.NewApp(ctx)
+	if err != nil {
+		log.Fatalf("failed to init app: %s", err.Error())
+	}
+
+	switch os.Args[1] {
+	case "regenerate-thumbnails":
+		n, err := a.RegenerateThumbnails(ctx)
+		if err != nil {
+			log.Fatalf("failed to regenerate thumbnails: %s", err.Error())
+		}
+		fmt.Printf("wrote %d thumbnails\n", n)
+	case "scrub":
+		report, err := a.Scrub(ctx)
+		if err != nil {
+			log.Fatalf("failed to scrub storage: %s", err.Error())
+		}
+		for _, p := range report.Problems {
+			if p.DocumentID != nil {
+				fmt.Printf("%s\t%s\tdocument %d version %d\t%s\n", p.Kind, p.StorageKey, *p.DocumentID, *p.Version, p.Detail)
+			} else {
+				fmt.Printf("%s\t%s\t%s\n", p.Kind, p.StorageKey, p.Detail)
+			}
+		}
+		fmt.Printf("scrub %d: checked %d versions and %d blobs, recorded %d checksums; %d missing, %d corrupted, %d orphaned\n",
+			report.ID, report.Versions, report.Blobs, report.Recorded, report.Missing, report.Corrupted, report.Orphaned)
+		if report.Missing+report.Corrupted+report.Orphaned > 0 {
+			os.Exit(1)
+		}
+	case "rewrap-keys":
+		n, err := a.RewrapKeys(ctx)
+		if err != nil {
+			log.Fatalf("failed to rewrap keys: %s", err.Error())
+		}
+		fmt.Printf("rewrapped %d data keys\n", n)
+	case "encrypt-storage":
+		n, err := a.EncryptStorage(ctx)
+		if err != nil {
+			log.Fatalf("failed to encrypt storage: %s", err.Error())
+		}
+		fmt.Printf("encrypted %d files\n", n)
+	case "backfill-versions":
+		var files map[int]string
+		if len(os.Args) > 2 {
+			f, err := os.Open(os.Args[2])
+			if err != nil {
+				log.Fatalf("failed to open file list: %s", err.Error())
+			}
+			files, err = readFileList(f)
+			f.Close()
+			if err != nil {
+				log.Fatalf("failed to read file list: %s", err.Error())
+			}
+		}
+		n, unresolved, err := a.BackfillVersions(ctx, files)
+		if err != nil {
+			log.Fatalf("failed to backfill versions: %s", err.Error())
+		}
+		for _, id := range unresolved {
+			fmt.Printf("unresolved\tdocument %d\n", id)
+		}
+		fmt.Printf("backfilled %d document versions, %d documents unresolved\n", n, len(unresolved))
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+// readFileList reads the lines of document id and storage key given to
+// backfill-versions. Blank lines and lines starting with # are skipped. A
+// file may belong to one document only, as deleting a version deletes it.
+func readFileList(r io.Reader) (map[int]string, error) {
+	files := make(map[int]string)
+	owners := make(map[string]int)
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		idText, key, ok := strings.Cut(text, "\t")
+		key = strings.TrimSpace(key)
+		id, err := strconv.Atoi(strings.TrimSpace(idText))
+		if !ok || err != nil || id <= 0 || key == "" {
+			return nil, fmt.Errorf("line %d: want a document id, a tab and a storage key", line)
+		}
+		if _, ok := files[id]; ok {
+			return nil, fmt.Errorf("line %d: document %d is listed twice", line, id)
+		}
+		if other, ok := owners[key]; ok {
+			return nil, fmt.Errorf("line %d: %s is already the file of document %d", line, key, other)
+		}
+		files[id], owners[key] = key, id
+	}
+	return files, sc.Err()
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadFileList(t *testing.T) {
+	files, err := readFileList(strings.NewReader("# id\tfile\n\n1\treport.pdf\n 2\tscan of invoice.png \n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]string{1: "report.pdf", 2: "scan of invoice.png"}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("got %v, want %v", files, want)
+	}
+
+	for _, list := range []string{
+		"1 report.pdf\n",
+		"x\treport.pdf\n",
+		"0\treport.pdf\n",
+		"1\t\n",
+		"1\ta.pdf\n1\tb.pdf\n",
+		"1\ta.pdf\n2\ta.pdf\n",
+	} {
+		if _, err := readFileList(strings.NewReader(list)); err == nil {
+			t.Errorf("%q was accepted", list)
+		}
+	}
+}
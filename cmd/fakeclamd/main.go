@@ -0,0 +1,100 @@
+// Command fakeclamd is a stand-in for clamd to try out scanning locally. It
+// answers PING and INSTREAM, and finds the EICAR test string and nothing
+// else.
+//
+//	fakeclamd [-listen 127.0.0.1:3310] [-max-size 26214400]
+//
+// Point CLAMD_ADDRESS at it; a -listen value starting with / is a unix
+// socket.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+)
+
+// eicar is the standard antivirus test string.
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+func main() {
+	listen := flag.String("listen", "127.0.0.1:3310", "address or unix socket path to listen on")
+	maxSize := flag.Int64("max-size", 25<<20, "longest stream accepted, like StreamMaxLength")
+	flag.Parse()
+
+	network := "tcp"
+	if strings.HasPrefix(*listen, "/") {
+		network = "unix"
+		os.Remove(*listen)
+	}
+	l, err := net.Listen(network, *listen)
+	if err != nil {
+		log.Fatalf("failed to listen: %s", err.Error())
+	}
+	log.Printf("listening on %s", *listen)
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			log.Fatalf("failed to accept: %s", err.Error())
+		}
+		go serve(conn, *maxSize)
+	}
+}
+
+func serve(conn net.Conn, maxSize int64) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	// commands start with z and end with NUL or start with n and end with a
+	// newline
+	prefix, err := r.ReadByte()
+	if err != nil {
+		return
+	}
+	delim := byte(0)
+	if prefix == 'n' {
+		delim = '\n'
+	}
+	cmd, err := r.ReadString(delim)
+	if err != nil {
+		return
+	}
+	reply := func(s string) {
+		io.WriteString(conn, s+string(delim))
+	}
+
+	switch strings.TrimSuffix(cmd, string(delim)) {
+	case "PING":
+		reply("PONG")
+	case "INSTREAM":
+		var content bytes.Buffer
+		for {
+			var n uint32
+			if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+				return
+			}
+			if n == 0 {
+				break
+			}
+			if int64(content.Len())+int64(n) > maxSize {
+				reply("INSTREAM size limit exceeded. ERROR")
+				return
+			}
+			if _, err := io.CopyN(&content, r, int64(n)); err != nil {
+				return
+			}
+		}
+		if bytes.Contains(content.Bytes(), []byte(eicar)) {
+			reply("stream: Eicar-Test-Signature FOUND")
+			return
+		}
+		reply("stream: OK")
+	default:
+		reply("UNKNOWN COMMAND")
+	}
+}
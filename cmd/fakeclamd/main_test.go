@@ -0,0 +1,66 @@
+package main
+
+import (
+	"HttpServer/internal/scanner"
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startFake serves fakeclamd on a free port and returns a scanner using it.
+func startFake(t *testing.T, maxSize int64) scanner.Scanner {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn, maxSize)
+		}
+	}()
+	return scanner.NewClamd(l.Addr().String(), 5*time.Second)
+}
+
+func TestScanAgainstFake(t *testing.T) {
+	s := startFake(t, 1<<20)
+	tests := []struct {
+		name      string
+		content   []byte
+		infected  bool
+		signature string
+	}{
+		{"empty", nil, false, ""},
+		{"clean", []byte("hello"), false, ""},
+		{"eicar", []byte(eicar), true, "Eicar-Test-Signature"},
+		// the signature straddles the chunks the content is sent in
+		{"eicar across chunks", append(bytes.Repeat([]byte{'x'}, 64<<10-10), eicar...), true, "Eicar-Test-Signature"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := s.Scan(context.Background(), bytes.NewReader(tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Infected != tt.infected || res.Signature != tt.signature {
+				t.Errorf("got %+v, want infected %v with %q", res, tt.infected, tt.signature)
+			}
+		})
+	}
+}
+
+func TestScanAgainstFakeSizeLimit(t *testing.T) {
+	s := startFake(t, 100<<10)
+	_, err := s.Scan(context.Background(), bytes.NewReader(make([]byte, 1<<20)))
+	if err == nil || !strings.Contains(err.Error(), "size limit exceeded") {
+		t.Errorf("got %v, want the size limit reported", err)
+	}
+}
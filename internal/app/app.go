@@ -1,26 +1,38 @@
 package app
 
 import (
+	"HttpServer/config"
 	"HttpServer/internal/handler"
 	"HttpServer/internal/middleware"
+	"HttpServer/internal/models"
 	"HttpServer/internal/repository"
+	"HttpServer/internal/scanner"
 	"HttpServer/internal/service"
+	"HttpServer/internal/storage"
 	"context"
+	"crypto/rand"
 	"fmt"
 	"github.com/gorilla/mux"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
 	"github.com/redis/go-redis/v9"
+	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 type App struct {
 	ctx         context.Context
 	pool        *pgxpool.Pool
 	redisClient *redis.Client
-	authService *service.AuthService
-	docService  *service.DocumentService
+	authService service.AuthService
+	maintenance service.MaintenanceService
+	scrubs      service.ScrubService
+	// encrypted is nil unless files are encrypted at rest
+	encrypted   storage.EncryptedStorage
 	authHandler *handler.RegisterHandler
 	docHandler  *handler.DocumentHandler
 }
@@ -44,17 +56,140 @@ func NewApp(ctx context.Context) (*App, error) {
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
+	storageDir := config.String("STORAGE_DIR", "./uploads")
+	store, err := storage.NewLocalStorage(storageDir)
+	if err != nil {
+		return nil, err
+	}
+	// resumable upload parts and import temp files are not encrypted, see
+	// storage.NewEncryptedStorage
+	var encrypted storage.EncryptedStorage
+	if keyFile := config.String("ENCRYPTION_KEY_FILE", ""); keyFile != "" {
+		keys, err := storage.NewKeyFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		encrypted = storage.NewEncryptedStorage(store, keys)
+		store = encrypted
+	}
+
 	documentRepo := repository.NewDocumentRepository(pool, redisClient)
 	userRepo := repository.NewUserRepository(pool)
 	authService := service.NewUserService(userRepo)
-	docService := service.NewDocumentService(documentRepo, authService)
+	cursorSecret := []byte(config.String("CURSOR_SECRET", ""))
+	if len(cursorSecret) == 0 {
+		// cursors issued before a restart become invalid, which is acceptable
+		// for a single instance but CURSOR_SECRET should be set in production
+		cursorSecret = make([]byte, 32)
+		if _, err := rand.Read(cursorSecret); err != nil {
+			return nil, fmt.Errorf("failed to generate cursor secret: %w", err)
+		}
+	}
+	defaultPolicy := service.UploadPolicy{
+		Allow: config.List("UPLOAD_ALLOW", nil),
+		Deny:  config.List("UPLOAD_DENY", []string{"application/x-msdownload", "application/x-executable", "application/x-mach-binary"}),
+	}
+	// zero means unlimited
+	defaultQuota := models.Quota{
+		MaxBytes:     int64(config.Int("QUOTA_BYTES", 0)),
+		MaxDocuments: config.Int("QUOTA_DOCUMENTS", 0),
+		MaxFileSize:  int64(config.Int("QUOTA_FILE_SIZE", 0)),
+	}
+	// UPLOAD_ALLOW_<ROLE>, UPLOAD_DENY_<ROLE> and QUOTA_<LIMIT>_<ROLE>
+	// override the defaults per role
+	uploadPolicies := map[string]service.UploadPolicy{}
+	quotas := map[string]models.Quota{}
+	for _, role := range config.List("UPLOAD_ROLES", []string{models.RoleUser, models.RoleAdmin}) {
+		suffix := "_" + strings.ToUpper(role)
+		uploadPolicies[role] = service.UploadPolicy{
+			Allow: config.List("UPLOAD_ALLOW"+suffix, defaultPolicy.Allow),
+			Deny:  config.List("UPLOAD_DENY"+suffix, defaultPolicy.Deny),
+		}
+		quotas[role] = models.Quota{
+			MaxBytes:     int64(config.Int("QUOTA_BYTES"+suffix, int(defaultQuota.MaxBytes))),
+			MaxDocuments: config.Int("QUOTA_DOCUMENTS"+suffix, defaultQuota.MaxDocuments),
+			MaxFileSize:  int64(config.Int("QUOTA_FILE_SIZE"+suffix, int(defaultQuota.MaxFileSize))),
+		}
+	}
+	linkRepo := repository.NewLinkRepository(pool)
+	folderRepo := repository.NewFolderRepository(pool, redisClient)
+	jobRepo := repository.NewJobRepository(redisClient)
+	uploadRepo := repository.NewUploadRepository(redisClient)
+	quotaRepo := repository.NewQuotaRepository(pool)
+	notificationRepo := repository.NewNotificationRepository(pool)
+	scrubRepo := repository.NewScrubRepository(pool)
+	lockRepo := repository.NewLockRepository(redisClient)
+	// without a scanner uploads stay pending, which blocks them all if
+	// unscanned downloads are blocked
+	var malware scanner.Scanner
+	if address := config.String("CLAMD_ADDRESS", ""); address != "" {
+		malware = scanner.NewClamd(address, config.Duration("SCAN_TIMEOUT", time.Minute))
+	}
+	blockUnscanned := config.Bool("SCAN_BLOCK_UNSCANNED", false)
+	if blockUnscanned && malware == nil {
+		return nil, fmt.Errorf("SCAN_BLOCK_UNSCANNED requires CLAMD_ADDRESS")
+	}
+	docServices := service.NewDocumentServices(service.DocumentDeps{
+		Documents:     documentRepo,
+		Links:         linkRepo,
+		Folders:       folderRepo,
+		Jobs:          jobRepo,
+		Uploads:       uploadRepo,
+		Quotas:        quotaRepo,
+		Notifications: notificationRepo,
+		Scrubs:        scrubRepo,
+		Locks:         lockRepo,
+		Auth:          authService,
+		Storage:       store,
+		Scanner:       malware,
+	}, service.DocumentConfig{
+		CursorSecret:        cursorSecret,
+		MaxVersions:         config.Int("MAX_VERSIONS", 10),
+		TrashRetention:      config.Duration("TRASH_RETENTION", 30*24*time.Hour),
+		UploadPolicies:      uploadPolicies,
+		DefaultUploadPolicy: defaultPolicy,
+		ThumbnailSizes:      config.IntList("THUMBNAIL_SIZES", []int{128, 512}),
+		Import: service.ImportLimits{
+			MaxArchiveSize: int64(config.Int("IMPORT_MAX_SIZE", 512<<20)),
+			MaxEntries:     config.Int("IMPORT_MAX_ENTRIES", 1000),
+			MaxEntrySize:   int64(config.Int("IMPORT_MAX_ENTRY_SIZE", 100<<20)),
+			MaxTotalSize:   int64(config.Int("IMPORT_MAX_TOTAL_SIZE", 2<<30)),
+			MaxRatio:       int64(config.Int("IMPORT_MAX_RATIO", 100)),
+		},
+		Resumable: service.ResumableConfig{
+			Dir:     config.String("UPLOAD_PARTS_DIR", filepath.Join(storageDir, ".parts")),
+			MaxSize: int64(config.Int("UPLOAD_MAX_SIZE", 5<<30)),
+			Expiry:  config.Duration("UPLOAD_EXPIRY", 24*time.Hour),
+		},
+		Quotas:       quotas,
+		DefaultQuota: defaultQuota,
+		Retention: service.RetentionConfig{
+			Notice:    config.Duration("EXPIRY_NOTICE", 7*24*time.Hour),
+			BatchSize: config.Int("EXPIRY_BATCH_SIZE", 500),
+		},
+		Integrity: service.IntegrityConfig{
+			VerifyDownloads: config.Bool("VERIFY_DOWNLOADS", false),
+			OrphanGrace:     config.Duration("SCRUB_ORPHAN_GRACE", time.Hour),
+		},
+		Scan: service.ScanConfig{
+			BlockUnscanned: blockUnscanned,
+		},
+		Lock: service.LockConfig{
+			DefaultTTL: config.Duration("LOCK_TTL", 30*time.Minute),
+			MaxTTL:     config.Duration("LOCK_MAX_TTL", 8*time.Hour),
+		},
+	})
 	authHandler := handler.NewRegisterHandler(authService)
-	docHandler := handler.NewDocumentHandler(docService, authService)
+	docHandler := handler.NewDocumentHandler(docServices, authService)
 
 	return &App{
 		ctx:         ctx,
 		pool:        pool,
 		redisClient: redisClient,
+		authService: authService,
+		maintenance: docServices.Maintenance,
+		scrubs:      docServices.Scrubs,
+		encrypted:   encrypted,
 		authHandler: authHandler,
 		docHandler:  docHandler,
 	}, nil
@@ -67,11 +202,146 @@ func (a *App) Run() error {
 	r.Handle("/api/auth", middleware.WithContext(a.ctx, http.HandlerFunc(a.authHandler.Authenticate))).Methods("POST")
 	r.Handle("/api/register", middleware.WithContext(a.ctx, http.HandlerFunc(a.authHandler.Register))).Methods("POST")
 	r.Handle("/api/docs", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.GetDocuments))).Methods("GET")
-	r.Handle("/api/docs/{id:[0-9]+}", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.GetDocumentsByID))).Methods("GET")
+	r.Handle("/api/docs/batch", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.Batch))).Methods("POST")
+	r.Handle("/api/docs/archive", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.DownloadArchive))).Methods("POST")
+	r.Handle("/api/docs/import", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.ImportArchive))).Methods("POST")
+	r.Handle("/api/jobs/{id:[0-9a-f]+}", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.GetJob))).Methods("GET")
+	r.Handle("/api/docs/search", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.SearchDocuments))).Methods("GET")
+	r.Handle("/api/docs/{id:[0-9]+}", middleware.WithContext(a.ctx, a.anonLimit(http.HandlerFunc(a.docHandler.GetDocumentsByID)))).Methods("GET")
 	r.Handle("/api/docs/{id:[0-9]+}", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.DeleteDoc))).Methods("DELETE")
+	r.Handle("/api/docs/{id:[0-9]+}", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.UpdateDocument))).Methods("PATCH")
 	r.Handle("/api/docs", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.UploadDoc))).Methods("POST")
+	r.Handle("/api/docs/{id:[0-9]+}/content", middleware.WithContext(a.ctx, a.anonLimit(http.HandlerFunc(a.docHandler.DownloadContent)))).Methods("GET", "POST")
+	r.Handle("/api/docs/{id:[0-9]+}/content", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.UpdateContent))).Methods("PUT")
+	r.Handle("/api/docs/{id:[0-9]+}/thumbnail", middleware.WithContext(a.ctx, a.anonLimit(http.HandlerFunc(a.docHandler.DownloadThumbnail)))).Methods("GET")
+	r.Handle("/api/docs/{id:[0-9]+}/versions", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.ListVersions))).Methods("GET")
+	r.Handle("/api/docs/{id:[0-9]+}/versions/{version:[0-9]+}/content", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.DownloadContent))).Methods("GET")
+	r.Handle("/api/docs/{id:[0-9]+}/versions/{version:[0-9]+}/restore", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.RestoreVersion))).Methods("POST")
+	r.Handle("/api/docs/{id:[0-9]+}/grants", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.ListGrants))).Methods("GET")
+	r.Handle("/api/docs/{id:[0-9]+}/grants", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.AddGrants))).Methods("POST")
+	r.Handle("/api/docs/{id:[0-9]+}/grants", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.RemoveGrants))).Methods("DELETE")
+	r.Handle("/api/docs/{id:[0-9]+}/owner", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.TransferOwnership))).Methods("POST")
+	r.Handle("/api/docs/{id:[0-9]+}/links", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.ListLinks))).Methods("GET")
+	r.Handle("/api/docs/{id:[0-9]+}/links", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.CreateLink))).Methods("POST")
+	r.Handle("/api/docs/{id:[0-9]+}/links/{link:[0-9]+}", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.RevokeLink))).Methods("DELETE")
+	r.Handle("/api/docs/{id:[0-9]+}/move", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.MoveDocument))).Methods("POST")
+	r.Handle("/api/folders", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.ListFolders))).Methods("GET")
+	r.Handle("/api/folders", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.CreateFolder))).Methods("POST")
+	r.Handle("/api/folders/{id:[0-9]+}", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.GetFolder))).Methods("GET")
+	r.Handle("/api/folders/{id:[0-9]+}", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.UpdateFolder))).Methods("PATCH")
+	r.Handle("/api/folders/{id:[0-9]+}/children", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.ListFolderChildren))).Methods("GET")
+	r.Handle("/api/folders/{id:[0-9]+}/grants", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.ListFolderGrants))).Methods("GET")
+	r.Handle("/api/folders/{id:[0-9]+}/grants", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.AddFolderGrants))).Methods("POST")
+	r.Handle("/api/folders/{id:[0-9]+}/grants", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.RemoveFolderGrants))).Methods("DELETE")
+	r.Handle("/api/paths/{path:.*}", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.ResolvePath))).Methods("GET")
+	r.Handle("/api/uploads", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.UploadOptions))).Methods("OPTIONS")
+	r.Handle("/api/uploads", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.CreateUpload))).Methods("POST")
+	r.Handle("/api/uploads/{id:[0-9a-f]+}", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.UploadOptions))).Methods("OPTIONS")
+	r.Handle("/api/uploads/{id:[0-9a-f]+}", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.HeadUpload))).Methods("HEAD")
+	r.Handle("/api/uploads/{id:[0-9a-f]+}", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.PatchUpload))).Methods("PATCH")
+	r.Handle("/api/uploads/{id:[0-9a-f]+}", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.DeleteUpload))).Methods("DELETE")
+	r.Handle("/api/me/usage", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.GetUsage))).Methods("GET")
+	r.Handle("/api/admin/users/{login}/quota", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.GetUserQuota))).Methods("GET")
+	r.Handle("/api/admin/users/{login}/quota", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.SetUserQuota))).Methods("PUT")
+	r.Handle("/api/admin/users/{login}/quota", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.ResetUserQuota))).Methods("DELETE")
+	r.Handle("/api/me/notifications", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.ListNotifications))).Methods("GET")
+	r.Handle("/api/me/notifications/{id:[0-9]+}/read", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.MarkNotificationRead))).Methods("POST")
+	r.Handle("/api/admin/retention-rules", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.ListRetentionRules))).Methods("GET")
+	r.Handle("/api/admin/retention-rules", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.CreateRetentionRule))).Methods("POST")
+	r.Handle("/api/admin/retention-rules/{id:[0-9]+}", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.DeleteRetentionRule))).Methods("DELETE")
+	r.Handle("/api/docs/{id:[0-9]+}/hold", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.SetHold))).Methods("PUT")
+	r.Handle("/api/docs/{id:[0-9]+}/lock", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.GetLock))).Methods("GET")
+	r.Handle("/api/docs/{id:[0-9]+}/lock", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.LockDocument))).Methods("POST")
+	r.Handle("/api/docs/{id:[0-9]+}/lock", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.UnlockDocument))).Methods("DELETE")
+	r.Handle("/api/admin/audit", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.ListAudit))).Methods("GET")
+	r.Handle("/api/admin/scrubs", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.ListScrubReports))).Methods("GET")
+	r.Handle("/api/admin/scrubs", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.StartScrub))).Methods("POST")
+	r.Handle("/api/admin/scrubs/{id:[0-9]+}", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.GetScrubReport))).Methods("GET")
+	r.Handle("/api/public/docs", middleware.WithContext(a.ctx, a.anonLimit(http.HandlerFunc(a.docHandler.ListPublicDocuments)))).Methods("GET")
+	r.Handle("/api/trash", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.ListTrash))).Methods("GET")
+	r.Handle("/api/trash", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.EmptyTrash))).Methods("DELETE")
+	r.Handle("/api/trash/{id:[0-9]+}/restore", middleware.WithContext(a.ctx, http.HandlerFunc(a.docHandler.RestoreDoc))).Methods("POST")
 	r.Handle("/api/auth/{token}", middleware.WithContext(a.ctx, http.HandlerFunc(a.authHandler.DeleteToken))).Methods("DELETE")
 
+	// the files of documents saved before versions existed are not known
+	// here; admin backfill-versions attaches them
+	go func() {
+		_, unresolved, err := a.maintenance.BackfillVersions(a.ctx, nil)
+		if err != nil {
+			log.Printf("failed to look for documents without versions: %v", err)
+		} else if len(unresolved) > 0 {
+			log.Printf("%d documents saved before versions existed have no version; run admin backfill-versions", len(unresolved))
+		}
+	}()
+	go a.runEvery(config.Duration("TRASH_PURGE_INTERVAL", time.Hour), "trash purge", a.maintenance.PurgeTrash)
+	go a.runEvery(config.Duration("UPLOAD_PURGE_INTERVAL", time.Hour), "upload purge", a.maintenance.PurgeUploads)
+	go a.runEvery(config.Duration("EXPIRY_INTERVAL", time.Hour), "document expiry", a.maintenance.ExpireDocuments)
+	go a.runEvery(config.Duration("SCAN_INTERVAL", 10*time.Minute), "pending scans", a.maintenance.ScanPending)
+	// a scrub reads all content, so it only runs periodically when asked to
+	if interval := config.Duration("SCRUB_INTERVAL", 0); interval > 0 {
+		go a.runEvery(interval, "storage scrub", func(ctx context.Context) error {
+			_, err := a.scrubs.Scrub(ctx)
+			return err
+		})
+	}
+
 	fmt.Println("Server started at http://localhost:8080")
 	return http.ListenAndServe(":8080", r)
 }
+
+// RegenerateThumbnails remakes the thumbnails of every image document.
+func (a *App) RegenerateThumbnails(ctx context.Context) (int, error) {
+	return a.maintenance.RegenerateThumbnails(ctx)
+}
+
+// Scrub checks all stored content; see ScrubService.Scrub.
+func (a *App) Scrub(ctx context.Context) (*models.ScrubReport, error) {
+	return a.scrubs.Scrub(ctx)
+}
+
+// EncryptStorage encrypts the files stored before encryption was enabled,
+// after which files in the clear are refused.
+func (a *App) EncryptStorage(ctx context.Context) (int, error) {
+	if a.encrypted == nil {
+		return 0, fmt.Errorf("encryption at rest is not enabled, set ENCRYPTION_KEY_FILE")
+	}
+	return a.encrypted.EncryptAll(ctx)
+}
+
+// BackfillVersions gives documents saved before versions existed their file
+// in files as first version; see MaintenanceService.BackfillVersions.
+func (a *App) BackfillVersions(ctx context.Context, files map[int]string) (int, []int, error) {
+	return a.maintenance.BackfillVersions(ctx, files)
+}
+
+// RewrapKeys wraps the data keys of encrypted files with the current master
+// key, after which the previous master keys can be dropped.
+func (a *App) RewrapKeys(ctx context.Context) (int, error) {
+	if a.encrypted == nil {
+		return 0, fmt.Errorf("encryption at rest is not enabled, set ENCRYPTION_KEY_FILE")
+	}
+	return a.encrypted.Rewrap(ctx)
+}
+
+// anonLimit rate limits callers that do not present a valid token.
+func (a *App) anonLimit(next http.Handler) http.Handler {
+	limit := config.Int("ANON_RATE_LIMIT", 60)
+	window := config.Duration("ANON_RATE_WINDOW", time.Minute)
+	return middleware.AnonymousRateLimit(a.redisClient, a.authService.GetLoginFromToken, limit, window, next)
+}
+
+// runEvery runs job on every tick until the app context is done.
+func (a *App) runEvery(interval time.Duration, name string, job func(ctx context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := job(a.ctx); err != nil {
+				log.Printf("%s failed: %v", name, err)
+			}
+		}
+	}
+}
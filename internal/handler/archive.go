@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"HttpServer/internal/models"
+	"HttpServer/internal/utils"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// DownloadArchive streams a ZIP of the documents given by ids, below
+// folder_id or matching filters. Access is checked before anything is sent,
+// so errors are still reported as JSON.
+func (h *DocumentHandler) DownloadArchive(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req struct {
+		Token string `json:"token"`
+		models.ArchiveRequest
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, 400, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Token == "" {
+		req.Token = requestToken(r)
+	}
+	entries, err := h.documentService.ArchiveEntries(ctx, req.Token, req.ArchiveRequest)
+	if err != nil {
+		writeError(w, err, "Failed to prepare archive")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="documents.zip"`)
+	w.WriteHeader(http.StatusOK)
+	if err := h.documentService.WriteArchive(ctx, entries, w); err != nil {
+		log.Printf("failed to send archive of %d documents: %v", len(entries), err)
+	}
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"HttpServer/internal/models"
+	"HttpServer/internal/utils"
+	"encoding/json"
+	"net/http"
+)
+
+// Batch applies one action to many documents, e.g.
+// {"action": "add_tags", "ids": [1, 2], "tags": ["invoice"]}, and reports
+// the outcome per document. The changes are committed unless the request is
+// atomic and some document failed.
+func (h *DocumentHandler) Batch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req struct {
+		Token      string            `json:"token"`
+		Permission models.Permission `json:"permission"`
+		models.BatchRequest
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, 400, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Token == "" {
+		req.Token = requestToken(r)
+	}
+	if req.Action == models.BatchAddGrants && len(req.Grants) == 0 {
+		if req.Permission == "" {
+			req.Permission = models.PermView
+		}
+		for _, login := range req.Logins {
+			req.Grants = append(req.Grants, models.Grant{Login: login, Permission: req.Permission})
+		}
+	}
+	if req.Action == models.BatchRemoveGrants {
+		for _, g := range req.Grants {
+			req.Logins = append(req.Logins, g.Login)
+		}
+	}
+
+	report, err := h.documentService.Batch(ctx, req.Token, req.BatchRequest)
+	if err != nil {
+		writeError(w, err, "Failed to run batch")
+		return
+	}
+	results := make([]map[string]interface{}, 0, len(report.Results))
+	failed := 0
+	for _, res := range report.Results {
+		item := map[string]interface{}{
+			"id":     res.ID,
+			"status": res.Status,
+		}
+		if res.Err != nil {
+			code, msg := errorStatus(res.Err, "Internal error")
+			item["code"], item["error"] = code, msg
+			failed++
+		}
+		results = append(results, item)
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"committed": report.Committed,
+			"failed":    failed,
+			"results":   results,
+		},
+	})
+}
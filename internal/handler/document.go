@@ -17,13 +17,19 @@ import (
 
 type DocumentHandler struct {
 	documentService service.DocumentService
+	lockService     service.LockService
+	adminService    service.AdminService
+	scrubService    service.ScrubService
 	authService     service.AuthService
 }
 
-func NewDocumentHandler(docService service.DocumentService, authService service.AuthService) *DocumentHandler {
+func NewDocumentHandler(services service.DocumentServices, authService service.AuthService) *DocumentHandler {
 	return &DocumentHandler{
 
-		documentService: docService,
+		documentService: services.Documents,
+		lockService:     services.Locks,
+		adminService:    services.Admin,
+		scrubService:    services.Scrubs,
 		authService:     authService,
 	}
 }
@@ -31,26 +37,76 @@ func NewDocumentHandler(docService service.DocumentService, authService service.
 func (h *DocumentHandler) GetDocuments(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	var requestData struct {
-		Token string `json:"token"`
-		Login string `json:"login"`
-		Key   string `json:"key"`
-		Value string `json:"value"`
-		Limit int    `json:"limit"`
+		Token   string                  `json:"token"`
+		Login   string                  `json:"login"`
+		Key     string                  `json:"key"`
+		Value   string                  `json:"value"`
+		Limit   int                     `json:"limit"`
+		Filters []models.DocumentFilter `json:"filters"`
+		Sort    []models.SortField      `json:"sort"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil && err != io.EOF {
 		utils.ErrorResponse(w, 400, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
-	docs, err := h.documentService.GetDocuments(ctx, requestData.Token, requestData.Login, requestData.Key, requestData.Value, requestData.Limit)
-	fmt.Println("get запрос", requestData.Token, requestData.Login, requestData.Key, requestData.Value, requestData.Limit)
+	query, err := parseDocumentQuery(r.URL.Query())
+	if err != nil {
+		utils.ErrorResponse(w, 400, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if requestData.Key != "" {
+		query.Filters = append(query.Filters, models.DocumentFilter{Field: requestData.Key, Op: models.FilterEq, Values: []string{requestData.Value}})
+	}
+	query.Filters = append(query.Filters, requestData.Filters...)
+	if len(query.Sort) == 0 {
+		query.Sort = requestData.Sort
+	}
+	if query.Limit == 0 {
+		query.Limit = requestData.Limit
+	}
+	if requestData.Token == "" {
+		requestData.Token = requestToken(r)
+	}
+	if requestData.Login == "" {
+		requestData.Login = r.URL.Query().Get("login")
+	}
+
+	list, err := h.documentService.GetDocuments(ctx, requestData.Token, requestData.Login, query)
 	if err != nil {
-		http.Error(w, "failed to get documents", http.StatusInternalServerError)
+		writeError(w, err, "failed to get documents")
 		return
 	}
 
+	data := map[string]interface{}{
+		"docs": list.Docs,
+		"next": pageLink(r, list.NextCursor),
+		"prev": pageLink(r, list.PrevCursor),
+	}
+	if list.Total != nil {
+		data["total"] = *list.Total
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": data,
+	})
+}
+func (h *DocumentHandler) SearchDocuments(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	limit := 0
+	if l := r.URL.Query().Get("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil {
+			utils.ErrorResponse(w, 400, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+	results, err := h.documentService.SearchDocuments(ctx, requestToken(r), r.URL.Query().Get("q"), limit)
+	if err != nil {
+		writeError(w, err, "failed to search documents")
+		return
+	}
 	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
 		"data": map[string]interface{}{
-			"docs": docs,
+			"docs": results,
 		},
 	})
 }
@@ -66,16 +122,34 @@ func (h *DocumentHandler) GetDocumentsByID(w http.ResponseWriter, r *http.Reques
 		utils.ErrorResponse(w, 400, "Неверный формат ID", http.StatusBadRequest)
 		return
 	}
-	if err := json.NewDecoder(r.Body).Decode(&reqToken); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&reqToken); err != nil && err != io.EOF {
 		fmt.Println(err)
 		utils.ErrorResponse(w, 400, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
+	if reqToken.Token == "" {
+		reqToken.Token = requestToken(r)
+	}
 
-	doc, err := h.documentService.GetDocumentById(ctx, reqToken.Token, idInt)
-	if err != nil {
-		http.Error(w, "failed to get documents", http.StatusInternalServerError)
-		return
+	// callers without access see public documents only as their projection
+	var doc interface{}
+	if reqToken.Token != "" {
+		found, err := h.documentService.GetDocumentById(ctx, reqToken.Token, idInt)
+		if err != nil && !errors.Is(err, models.ErrNotFound) {
+			writeError(w, err, "failed to get documents")
+			return
+		}
+		if found != nil {
+			doc = found
+		}
+	}
+	if doc == nil {
+		public, err := h.documentService.GetPublicDocument(ctx, idInt)
+		if err != nil {
+			writeError(w, err, "failed to get documents")
+			return
+		}
+		doc = public
 	}
 	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
 		"data": map[string]interface{}{
@@ -83,6 +157,33 @@ func (h *DocumentHandler) GetDocumentsByID(w http.ResponseWriter, r *http.Reques
 		},
 	})
 }
+
+// ListPublicDocuments lists public documents to anyone. It takes the same
+// filter, sort and paging parameters as GetDocuments.
+func (h *DocumentHandler) ListPublicDocuments(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query, err := parseDocumentQuery(r.URL.Query())
+	if err != nil {
+		utils.ErrorResponse(w, 400, err.Error(), http.StatusBadRequest)
+		return
+	}
+	list, err := h.documentService.ListPublicDocuments(ctx, query)
+	if err != nil {
+		writeError(w, err, "failed to get documents")
+		return
+	}
+	data := map[string]interface{}{
+		"docs": list.Docs,
+		"next": pageLink(r, list.NextCursor),
+		"prev": pageLink(r, list.PrevCursor),
+	}
+	if list.Total != nil {
+		data["total"] = *list.Total
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": data,
+	})
+}
 func (h *DocumentHandler) DeleteDoc(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	var reqToken struct {
@@ -97,7 +198,7 @@ func (h *DocumentHandler) DeleteDoc(w http.ResponseWriter, r *http.Request) {
 	}
 	st, err := h.documentService.DeleteDoc(ctx, reqToken.Token, idInt)
 	if err != nil {
-		http.Error(w, "failed to get documents", http.StatusInternalServerError)
+		writeError(w, err, "failed to delete document")
 		return
 	}
 	fmt.Println(st)
@@ -108,6 +209,39 @@ func (h *DocumentHandler) DeleteDoc(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// UpdateDocument changes the name, tags and metadata of a document. Tags
+// given replace the current ones; metadata is merged, a null value removing
+// its key.
+func (h *DocumentHandler) UpdateDocument(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := pathInt(r, "id")
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Неверный формат ID", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Token string `json:"token"`
+		models.DocumentPatch
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, 400, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Token == "" {
+		req.Token = requestToken(r)
+	}
+	doc, err := h.documentService.UpdateDocument(ctx, req.Token, id, req.DocumentPatch)
+	if err != nil {
+		writeError(w, err, "Failed to update document")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"docs": doc,
+		},
+	})
+}
+
 func (h *DocumentHandler) UploadDoc(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	err := r.ParseMultipartForm(10 << 20) // 10 MB
@@ -133,15 +267,51 @@ func (h *DocumentHandler) UploadDoc(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to read file", http.StatusInternalServerError)
 		return
 	}
-	err = h.documentService.UploadDocument(ctx, doc, fileData, handler.Filename)
+	token := r.FormValue("token")
+	if token == "" {
+		token = requestToken(r)
+	}
+	saved, err := h.documentService.UploadDocument(ctx, token, doc, fileData, handler.Filename)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to upload document: %s", err), http.StatusInternalServerError)
+		writeError(w, err, fmt.Sprintf("Failed to upload document: %s", err))
 		return
 	}
 	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
 		"data": map[string]interface{}{
 			"file": handler.Filename,
-			"json": doc,
+			"json": saved,
+		},
+	})
+}
+
+// TransferOwnership hands a document over to another user. The previous
+// owner keeps the permission given in keep_permission, if any.
+func (h *DocumentHandler) TransferOwnership(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := pathInt(r, "id")
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Неверный формат ID", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Token          string            `json:"token"`
+		Login          string            `json:"login"`
+		KeepPermission models.Permission `json:"keep_permission"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, 400, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Token == "" {
+		req.Token = requestToken(r)
+	}
+	if err := h.documentService.TransferOwnership(ctx, req.Token, id, req.Login, req.KeepPermission); err != nil {
+		writeError(w, err, "Failed to transfer ownership")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"owner": req.Login,
 		},
 	})
 }
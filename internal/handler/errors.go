@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"HttpServer/internal/models"
+	"HttpServer/internal/utils"
+	"errors"
+	"net/http"
+)
+
+// writeError maps service errors to API errors. Anything unexpected is
+// reported as an internal error with the given message.
+func writeError(w http.ResponseWriter, err error, message string) {
+	status, msg := errorStatus(err, message)
+	utils.ErrorResponse(w, status, msg, status)
+}
+
+// errorStatus returns the HTTP status and the message reported for err.
+func errorStatus(err error, message string) (int, string) {
+	switch {
+	case errors.Is(err, models.ErrInvalidQuery):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, models.ErrUnauthorized):
+		if err == models.ErrUnauthorized {
+			return http.StatusUnauthorized, "Invalid or missing token"
+		}
+		return http.StatusUnauthorized, err.Error()
+	case errors.Is(err, models.ErrImmutable), errors.Is(err, models.ErrBlocked):
+		return http.StatusForbidden, err.Error()
+	case errors.Is(err, models.ErrForbidden):
+		return http.StatusForbidden, "Access denied"
+	case errors.Is(err, models.ErrNotFound):
+		return http.StatusNotFound, err.Error()
+	case errors.Is(err, models.ErrGone):
+		return http.StatusGone, err.Error()
+	case errors.Is(err, models.ErrUnsupported):
+		return http.StatusUnsupportedMediaType, err.Error()
+	case errors.Is(err, models.ErrLocked):
+		return http.StatusLocked, err.Error()
+	case errors.Is(err, models.ErrConflict):
+		return http.StatusConflict, err.Error()
+	case errors.Is(err, models.ErrTooLarge), errors.Is(err, models.ErrQuotaExceeded):
+		return http.StatusRequestEntityTooLarge, err.Error()
+	case errors.Is(err, models.ErrCorrupted):
+		return http.StatusInternalServerError, err.Error()
+	case errors.Is(err, models.ErrChecksumMismatch):
+		// 460 Checksum Mismatch of the tus protocol
+		return 460, err.Error()
+	}
+	return http.StatusInternalServerError, message
+}
@@ -0,0 +1,266 @@
+package handler
+
+import (
+	"HttpServer/internal/models"
+	"HttpServer/internal/utils"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"io"
+	"net/http"
+	"strings"
+)
+
+func (h *DocumentHandler) ListFolders(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	folders, err := h.documentService.ListFolders(ctx, requestToken(r))
+	if err != nil {
+		writeError(w, err, "Failed to get folders")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"folders": folders,
+		},
+	})
+}
+
+// CreateFolder creates a folder at the top level or, with parent_id, inside
+// another folder.
+func (h *DocumentHandler) CreateFolder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req struct {
+		Token    string `json:"token"`
+		Name     string `json:"name"`
+		ParentID *int   `json:"parent_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, 400, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Token == "" {
+		req.Token = requestToken(r)
+	}
+	folder, err := h.documentService.CreateFolder(ctx, req.Token, req.Name, req.ParentID)
+	if err != nil {
+		writeError(w, err, "Failed to create folder")
+		return
+	}
+	utils.RespondJSON(w, http.StatusCreated, map[string]interface{}{
+		"data": map[string]interface{}{
+			"folder": folder,
+		},
+	})
+}
+
+func (h *DocumentHandler) GetFolder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := pathInt(r, "id")
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Неверный формат ID", http.StatusBadRequest)
+		return
+	}
+	folder, err := h.documentService.GetFolder(ctx, requestToken(r), id)
+	if err != nil {
+		writeError(w, err, "Failed to get folder")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"folder": folder,
+		},
+	})
+}
+
+// UpdateFolder renames a folder and/or moves it under parent_id. A parent_id
+// of 0 moves it to the top level.
+func (h *DocumentHandler) UpdateFolder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := pathInt(r, "id")
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Неверный формат ID", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Token string `json:"token"`
+		models.FolderChange
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, 400, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Token == "" {
+		req.Token = requestToken(r)
+	}
+	folder, err := h.documentService.UpdateFolder(ctx, req.Token, id, req.FolderChange)
+	if err != nil {
+		writeError(w, err, "Failed to update folder")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"folder": folder,
+		},
+	})
+}
+
+// ListFolderChildren lists the subfolders and documents of a folder. The
+// documents take the same filter, sort and paging parameters as
+// GetDocuments.
+func (h *DocumentHandler) ListFolderChildren(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := pathInt(r, "id")
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Неверный формат ID", http.StatusBadRequest)
+		return
+	}
+	query, err := parseDocumentQuery(r.URL.Query())
+	if err != nil {
+		utils.ErrorResponse(w, 400, err.Error(), http.StatusBadRequest)
+		return
+	}
+	children, err := h.documentService.ListFolderChildren(ctx, requestToken(r), id, query)
+	if err != nil {
+		writeError(w, err, "Failed to get folder content")
+		return
+	}
+	data := map[string]interface{}{
+		"folder": children.Folder,
+		"docs":   children.Docs.Docs,
+		"next":   pageLink(r, children.Docs.NextCursor),
+		"prev":   pageLink(r, children.Docs.PrevCursor),
+	}
+	if children.Folders != nil {
+		data["folders"] = children.Folders
+	}
+	if children.Docs.Total != nil {
+		data["total"] = *children.Docs.Total
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": data,
+	})
+}
+
+// MoveDocument puts a document into folder_id, or back to the top level when
+// folder_id is null or 0.
+func (h *DocumentHandler) MoveDocument(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := pathInt(r, "id")
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Неверный формат ID", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Token    string `json:"token"`
+		FolderID *int   `json:"folder_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		utils.ErrorResponse(w, 400, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Token == "" {
+		req.Token = requestToken(r)
+	}
+	if err := h.documentService.MoveDocument(ctx, req.Token, id, req.FolderID); err != nil {
+		writeError(w, err, "Failed to move document")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"id":        id,
+			"folder_id": req.FolderID,
+		},
+	})
+}
+
+// ResolvePath looks up a document or folder by its path, e.g.
+// /api/paths/reports/2024/q1.pdf.
+func (h *DocumentHandler) ResolvePath(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	path := strings.Trim(mux.Vars(r)["path"], "/")
+	folder, doc, err := h.documentService.ResolvePath(ctx, requestToken(r), path)
+	if err != nil {
+		writeError(w, err, "Failed to resolve path")
+		return
+	}
+	data := map[string]interface{}{"path": path}
+	if doc != nil {
+		data["type"], data["docs"] = "document", doc
+	} else {
+		data["type"], data["folder"] = "folder", folder
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": data,
+	})
+}
+
+func (h *DocumentHandler) ListFolderGrants(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := pathInt(r, "id")
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Неверный формат ID", http.StatusBadRequest)
+		return
+	}
+	grants, err := h.documentService.ListFolderGrants(ctx, requestToken(r), id)
+	if err != nil {
+		writeError(w, err, "Failed to get grants")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"grants": grants,
+		},
+	})
+}
+
+// AddFolderGrants shares a folder. The grants apply to everything below it.
+func (h *DocumentHandler) AddFolderGrants(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := pathInt(r, "id")
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Неверный формат ID", http.StatusBadRequest)
+		return
+	}
+	req, err := readGrantsRequest(r)
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	grants, err := h.documentService.AddFolderGrants(ctx, req.Token, id, req.Grants)
+	if err != nil {
+		writeError(w, err, "Failed to update grants")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"grants": grants,
+		},
+	})
+}
+
+func (h *DocumentHandler) RemoveFolderGrants(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := pathInt(r, "id")
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Неверный формат ID", http.StatusBadRequest)
+		return
+	}
+	req, err := readGrantsRequest(r)
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	var logins []string
+	for _, g := range req.Grants {
+		logins = append(logins, g.Login)
+	}
+	grants, err := h.documentService.RemoveFolderGrants(ctx, req.Token, id, logins)
+	if err != nil {
+		writeError(w, err, "Failed to update grants")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"grants": grants,
+		},
+	})
+}
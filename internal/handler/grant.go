@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"HttpServer/internal/models"
+	"HttpServer/internal/utils"
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+type grantsRequest struct {
+	Token      string            `json:"token"`
+	Logins     []string          `json:"logins"`
+	Permission models.Permission `json:"permission"`
+	Grants     []models.Grant    `json:"grants"`
+}
+
+// readGrantsRequest reads the JSON body, falling back to repeated login
+// query parameters. Plain logins are given the request's permission, view
+// by default.
+func readGrantsRequest(r *http.Request) (grantsRequest, error) {
+	var req grantsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		return req, err
+	}
+	if req.Token == "" {
+		req.Token = requestToken(r)
+	}
+	if len(req.Logins) == 0 {
+		req.Logins = r.URL.Query()["login"]
+	}
+	if req.Permission == "" {
+		req.Permission = models.PermView
+	}
+	for _, login := range req.Logins {
+		req.Grants = append(req.Grants, models.Grant{Login: login, Permission: req.Permission})
+	}
+	return req, nil
+}
+
+func (h *DocumentHandler) ListGrants(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := pathInt(r, "id")
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Неверный формат ID", http.StatusBadRequest)
+		return
+	}
+	grants, err := h.documentService.ListGrants(ctx, requestToken(r), id)
+	if err != nil {
+		writeError(w, err, "Failed to get grants")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"grants": grants,
+		},
+	})
+}
+
+func (h *DocumentHandler) AddGrants(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := pathInt(r, "id")
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Неверный формат ID", http.StatusBadRequest)
+		return
+	}
+	req, err := readGrantsRequest(r)
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	grants, err := h.documentService.AddGrants(ctx, req.Token, id, req.Grants)
+	if err != nil {
+		writeError(w, err, "Failed to update grants")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"grants": grants,
+		},
+	})
+}
+
+func (h *DocumentHandler) RemoveGrants(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := pathInt(r, "id")
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Неверный формат ID", http.StatusBadRequest)
+		return
+	}
+	req, err := readGrantsRequest(r)
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	var logins []string
+	for _, g := range req.Grants {
+		logins = append(logins, g.Login)
+	}
+	grants, err := h.documentService.RemoveGrants(ctx, req.Token, id, logins)
+	if err != nil {
+		writeError(w, err, "Failed to update grants")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"grants": grants,
+		},
+	})
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"HttpServer/internal/models"
+	"HttpServer/internal/utils"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// SetHold changes the protection of a document, e.g. with
+// {"legal_hold": true} or {"immutable_until": "2030-01-01T00:00:00Z"}.
+func (h *DocumentHandler) SetHold(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := pathInt(r, "id")
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Неверный формат ID", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Token string `json:"token"`
+		models.Hold
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, 400, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Token == "" {
+		req.Token = requestToken(r)
+	}
+	doc, err := h.adminService.SetHold(ctx, req.Token, id, req.Hold)
+	if err != nil {
+		writeError(w, err, "Failed to set hold")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"docs": doc,
+		},
+	})
+}
+
+// ListAudit returns the latest audit entries, of one document with
+// ?document_id=.
+func (h *DocumentHandler) ListAudit(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var documentID *int
+	if v := r.URL.Query().Get("document_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			utils.ErrorResponse(w, 400, "Неверный формат ID", http.StatusBadRequest)
+			return
+		}
+		documentID = &id
+	}
+	limit := 0
+	if l := r.URL.Query().Get("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil {
+			utils.ErrorResponse(w, 400, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+	entries, err := h.adminService.ListAudit(ctx, requestToken(r), documentID, limit)
+	if err != nil {
+		writeError(w, err, "Failed to get audit log")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"entries": entries,
+		},
+	})
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"HttpServer/internal/models"
+	"HttpServer/internal/utils"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"io"
+	"net/http"
+)
+
+// ImportArchive accepts a ZIP or tar.gz archive in the file field of a
+// multipart form and answers 202 with the job that expands it into
+// documents. The options field holds models.ImportOptions as JSON.
+func (h *DocumentHandler) ImportArchive(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	reader, err := r.MultipartReader()
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	token := requestToken(r)
+	var opts models.ImportOptions
+	// The archive is streamed, so the other fields must come before it.
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			utils.ErrorResponse(w, 400, "File is required", http.StatusBadRequest)
+			return
+		}
+		switch part.FormName() {
+		case "token":
+			value, err := io.ReadAll(io.LimitReader(part, 4096))
+			if err != nil {
+				utils.ErrorResponse(w, 400, "Invalid form", http.StatusBadRequest)
+				return
+			}
+			token = string(value)
+		case "options":
+			if err := json.NewDecoder(part).Decode(&opts); err != nil {
+				utils.ErrorResponse(w, 400, "Invalid options JSON", http.StatusBadRequest)
+				return
+			}
+		case "file":
+			job, err := h.documentService.ImportArchive(ctx, token, part, opts)
+			if err != nil {
+				writeError(w, err, "Failed to import archive")
+				return
+			}
+			utils.RespondJSON(w, http.StatusAccepted, map[string]interface{}{
+				"data": map[string]interface{}{
+					"job": job,
+				},
+			})
+			return
+		}
+	}
+}
+
+// GetJob reports the progress of a job started by the caller.
+func (h *DocumentHandler) GetJob(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	job, err := h.documentService.GetJob(ctx, requestToken(r), mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, err, "Failed to get job")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"job": job,
+		},
+	})
+}
@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"HttpServer/internal/utils"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func (h *DocumentHandler) CreateLink(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := pathInt(r, "id")
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Неверный формат ID", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Token        string     `json:"token"`
+		ExpiresAt    *time.Time `json:"expires_at"`
+		ExpiresIn    string     `json:"expires_in"`
+		MaxDownloads *int       `json:"max_downloads"`
+		Password     string     `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		utils.ErrorResponse(w, 400, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Token == "" {
+		req.Token = requestToken(r)
+	}
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil {
+			utils.ErrorResponse(w, 400, "Invalid expires_in", http.StatusBadRequest)
+			return
+		}
+		expiresAt := time.Now().Add(d)
+		req.ExpiresAt = &expiresAt
+	}
+
+	link, err := h.documentService.CreateLink(ctx, req.Token, id, req.ExpiresAt, req.MaxDownloads, req.Password)
+	if err != nil {
+		writeError(w, err, "Failed to create link")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"link": link,
+			"url":  "/api/docs/" + strconv.Itoa(id) + "/content?link=" + link.Token,
+		},
+	})
+}
+
+func (h *DocumentHandler) ListLinks(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := pathInt(r, "id")
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Неверный формат ID", http.StatusBadRequest)
+		return
+	}
+	links, err := h.documentService.ListLinks(ctx, requestToken(r), id)
+	if err != nil {
+		writeError(w, err, "Failed to get links")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"links": links,
+		},
+	})
+}
+
+func (h *DocumentHandler) RevokeLink(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := pathInt(r, "id")
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Неверный формат ID", http.StatusBadRequest)
+		return
+	}
+	linkID, err := pathInt(r, "link")
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Invalid link ID", http.StatusBadRequest)
+		return
+	}
+	st, err := h.documentService.RevokeLink(ctx, requestToken(r), id, linkID)
+	if err != nil {
+		writeError(w, err, "Failed to revoke link")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			strconv.Itoa(linkID): st,
+		},
+	})
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"HttpServer/internal/utils"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// LockDocument checks a document out to the caller, for ttl_seconds if the
+// body sets it. Locking it again extends the lock.
+func (h *DocumentHandler) LockDocument(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := pathInt(r, "id")
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Неверный формат ID", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Token      string `json:"token"`
+		TTLSeconds int    `json:"ttl_seconds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		utils.ErrorResponse(w, 400, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Token == "" {
+		req.Token = requestToken(r)
+	}
+	lock, err := h.lockService.LockDocument(ctx, req.Token, id, time.Duration(req.TTLSeconds)*time.Second)
+	if err != nil {
+		writeError(w, err, "Failed to lock document")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"lock": lock,
+		},
+	})
+}
+
+// GetLock returns who has a document checked out and until when.
+func (h *DocumentHandler) GetLock(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := pathInt(r, "id")
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Неверный формат ID", http.StatusBadRequest)
+		return
+	}
+	lock, err := h.lockService.GetLock(ctx, requestToken(r), id)
+	if err != nil {
+		writeError(w, err, "Failed to get lock")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"lock": lock,
+		},
+	})
+}
+
+// UnlockDocument releases the lock of the caller, or breaks any lock with
+// ?force=true.
+func (h *DocumentHandler) UnlockDocument(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := pathInt(r, "id")
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Неверный формат ID", http.StatusBadRequest)
+		return
+	}
+	force := false
+	if v := r.URL.Query().Get("force"); v != "" {
+		if force, err = strconv.ParseBool(v); err != nil {
+			utils.ErrorResponse(w, 400, "Invalid force", http.StatusBadRequest)
+			return
+		}
+	}
+	st, err := h.lockService.UnlockDocument(ctx, requestToken(r), id, force)
+	if err != nil {
+		writeError(w, err, "Failed to unlock document")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"released": st,
+		},
+	})
+}
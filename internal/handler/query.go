@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"HttpServer/internal/models"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// reservedParams are query parameters that are not document filters.
+var reservedParams = map[string]bool{
+	"token":  true,
+	"login":  true,
+	"limit":  true,
+	"sort":   true,
+	"cursor": true,
+	"count":  true,
+}
+
+// parseDocumentQuery reads filters from query parameters of the form
+// field=value or field.op=value, e.g. name.prefix=rep, mime.in=a,b,
+// created.range=2024-01-01,2024-12-31, tag=invoice or meta.customer=acme,
+// and the sort order from sort=name,-created.
+func parseDocumentQuery(values url.Values) (models.DocumentQuery, error) {
+	var q models.DocumentQuery
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		if !reservedParams[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		vals := values[key]
+		field, op := key, models.FilterEq
+		prefix, name := "", key
+		if strings.HasPrefix(key, models.MetaFieldPrefix) {
+			prefix, name = models.MetaFieldPrefix, key[len(models.MetaFieldPrefix):]
+		}
+		if i := strings.IndexByte(name, '.'); i >= 0 {
+			field, op = prefix+name[:i], models.FilterOp(name[i+1:])
+		}
+		for _, v := range vals {
+			f := models.DocumentFilter{Field: field, Op: op}
+			switch op {
+			case models.FilterIn:
+				f.Values = strings.Split(v, ",")
+			case models.FilterRange:
+				bounds := strings.SplitN(v, ",", 2)
+				if len(bounds) != 2 {
+					return q, fmt.Errorf("%w: %s expects from,to", models.ErrInvalidQuery, key)
+				}
+				f.Values = bounds
+			default:
+				f.Values = []string{v}
+			}
+			q.Filters = append(q.Filters, f)
+		}
+	}
+
+	if order := values.Get("sort"); order != "" {
+		for _, s := range strings.Split(order, ",") {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+			if strings.HasPrefix(s, "-") {
+				q.Sort = append(q.Sort, models.SortField{Field: s[1:], Desc: true})
+			} else {
+				q.Sort = append(q.Sort, models.SortField{Field: strings.TrimPrefix(s, "+")})
+			}
+		}
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l < 0 {
+			return q, fmt.Errorf("%w: bad limit", models.ErrInvalidQuery)
+		}
+		q.Limit = l
+	}
+
+	q.Cursor = values.Get("cursor")
+	if count := values.Get("count"); count != "" {
+		withTotal, err := strconv.ParseBool(count)
+		if err != nil {
+			return q, fmt.Errorf("%w: bad count", models.ErrInvalidQuery)
+		}
+		q.WithTotal = withTotal
+	}
+
+	return q, nil
+}
+
+// pageLink returns the URL of the same listing positioned at cursor, or an
+// empty string when there is no such page. The token is never echoed back.
+func pageLink(r *http.Request, cursor string) string {
+	if cursor == "" {
+		return ""
+	}
+	values := r.URL.Query()
+	values.Del("token")
+	values.Set("cursor", cursor)
+	return r.URL.Path + "?" + values.Encode()
+}
+
+// requestToken returns the token passed in the query string or as a bearer
+// token in the Authorization header.
+func requestToken(r *http.Request) string {
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token
+	}
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
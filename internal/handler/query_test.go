@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"HttpServer/internal/models"
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseDocumentQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  models.DocumentQuery
+	}{
+		{
+			name:  "empty",
+			query: "",
+			want:  models.DocumentQuery{},
+		},
+		{
+			name:  "reserved parameters are no filters",
+			query: "token=t&login=bob&cursor=c&limit=5&count=true",
+			want:  models.DocumentQuery{Limit: 5, Cursor: "c", WithTotal: true},
+		},
+		{
+			name:  "equality by default",
+			query: "name=report",
+			want: models.DocumentQuery{Filters: []models.DocumentFilter{
+				{Field: "name", Op: models.FilterEq, Values: []string{"report"}},
+			}},
+		},
+		{
+			name:  "operators",
+			query: "name.prefix=rep&mime.in=a,b&created.range=2024-01-01,",
+			want: models.DocumentQuery{Filters: []models.DocumentFilter{
+				{Field: "created", Op: models.FilterRange, Values: []string{"2024-01-01", ""}},
+				{Field: "mime", Op: models.FilterIn, Values: []string{"a", "b"}},
+				{Field: "name", Op: models.FilterPrefix, Values: []string{"rep"}},
+			}},
+		},
+		{
+			name:  "repeated parameters",
+			query: "owner=alice&owner=bob",
+			want: models.DocumentQuery{Filters: []models.DocumentFilter{
+				{Field: "owner", Op: models.FilterEq, Values: []string{"alice"}},
+				{Field: "owner", Op: models.FilterEq, Values: []string{"bob"}},
+			}},
+		},
+		{
+			name:  "tags and metadata keys",
+			query: "meta.customer=acme&meta.total.range=1,2&tag=invoice",
+			want: models.DocumentQuery{Filters: []models.DocumentFilter{
+				{Field: "meta.customer", Op: models.FilterEq, Values: []string{"acme"}},
+				{Field: "meta.total", Op: models.FilterRange, Values: []string{"1", "2"}},
+				{Field: "tag", Op: models.FilterEq, Values: []string{"invoice"}},
+			}},
+		},
+		{
+			name:  "sort",
+			query: "sort=name,-created,+owner,",
+			want: models.DocumentQuery{Sort: []models.SortField{
+				{Field: "name"}, {Field: "created", Desc: true}, {Field: "owner"},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := parseDocumentQuery(values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDocumentQueryRejects(t *testing.T) {
+	for _, query := range []string{
+		"created.range=2024-01-01",
+		"limit=-1",
+		"limit=many",
+		"count=maybe",
+	} {
+		values, err := url.ParseQuery(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := parseDocumentQuery(values); !errors.Is(err, models.ErrInvalidQuery) {
+			t.Errorf("%s: got error %v, want ErrInvalidQuery", query, err)
+		}
+	}
+}
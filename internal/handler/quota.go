@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"HttpServer/internal/models"
+	"HttpServer/internal/utils"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+// GetUsage reports the quota of the caller and how much of it is used.
+func (h *DocumentHandler) GetUsage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	report, err := h.documentService.GetUsage(ctx, requestToken(r))
+	if err != nil {
+		writeError(w, err, "Failed to get usage")
+		return
+	}
+	respondQuota(w, report)
+}
+
+func (h *DocumentHandler) GetUserQuota(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	report, err := h.adminService.GetUserQuota(ctx, requestToken(r), mux.Vars(r)["login"])
+	if err != nil {
+		writeError(w, err, "Failed to get quota")
+		return
+	}
+	respondQuota(w, report)
+}
+
+// SetUserQuota overrides the role quota of a user, e.g.
+// {"max_bytes": 10737418240, "max_documents": null}. Null or missing limits
+// keep the role value, zero lifts the limit.
+func (h *DocumentHandler) SetUserQuota(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req struct {
+		Token string `json:"token"`
+		models.QuotaOverride
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, 400, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Token == "" {
+		req.Token = requestToken(r)
+	}
+	report, err := h.adminService.SetUserQuota(ctx, req.Token, mux.Vars(r)["login"], req.QuotaOverride)
+	if err != nil {
+		writeError(w, err, "Failed to set quota")
+		return
+	}
+	respondQuota(w, report)
+}
+
+func (h *DocumentHandler) ResetUserQuota(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	report, err := h.adminService.ResetUserQuota(ctx, requestToken(r), mux.Vars(r)["login"])
+	if err != nil {
+		writeError(w, err, "Failed to reset quota")
+		return
+	}
+	respondQuota(w, report)
+}
+
+func respondQuota(w http.ResponseWriter, report *models.QuotaReport) {
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"quota": report,
+		},
+	})
+}
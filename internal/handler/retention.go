@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"HttpServer/internal/models"
+	"HttpServer/internal/utils"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+func (h *DocumentHandler) ListRetentionRules(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	rules, err := h.adminService.ListRetentionRules(ctx, requestToken(r))
+	if err != nil {
+		writeError(w, err, "Failed to get retention rules")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"rules": rules,
+		},
+	})
+}
+
+// CreateRetentionRule adds a rule such as {"tag": "invoice", "days": 90}.
+func (h *DocumentHandler) CreateRetentionRule(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req struct {
+		Token string `json:"token"`
+		models.RetentionRule
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, 400, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Token == "" {
+		req.Token = requestToken(r)
+	}
+	rule, err := h.adminService.CreateRetentionRule(ctx, req.Token, req.RetentionRule)
+	if err != nil {
+		writeError(w, err, "Failed to create retention rule")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"rule": rule,
+		},
+	})
+}
+
+func (h *DocumentHandler) DeleteRetentionRule(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := pathInt(r, "id")
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Неверный формат ID", http.StatusBadRequest)
+		return
+	}
+	st, err := h.adminService.DeleteRetentionRule(ctx, requestToken(r), id)
+	if err != nil {
+		writeError(w, err, "Failed to delete retention rule")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			strconv.Itoa(id): st,
+		},
+	})
+}
+
+// ListNotifications returns the caller's latest notifications, only the
+// unread ones with ?unread=true.
+func (h *DocumentHandler) ListNotifications(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	unread, _ := strconv.ParseBool(r.URL.Query().Get("unread"))
+	notes, err := h.documentService.ListNotifications(ctx, requestToken(r), unread)
+	if err != nil {
+		writeError(w, err, "Failed to get notifications")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"notifications": notes,
+		},
+	})
+}
+
+func (h *DocumentHandler) MarkNotificationRead(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := pathInt(r, "id")
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Неверный формат ID", http.StatusBadRequest)
+		return
+	}
+	st, err := h.documentService.MarkNotificationRead(ctx, requestToken(r), id)
+	if err != nil {
+		writeError(w, err, "Failed to mark notification")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			strconv.Itoa(id): st,
+		},
+	})
+}
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"HttpServer/internal/utils"
+	"net/http"
+)
+
+// StartScrub starts a scrub of the storage. Its report can be polled.
+func (h *DocumentHandler) StartScrub(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	report, err := h.scrubService.StartScrub(ctx, requestToken(r))
+	if err != nil {
+		writeError(w, err, "Failed to start scrub")
+		return
+	}
+	utils.RespondJSON(w, http.StatusAccepted, map[string]interface{}{
+		"data": map[string]interface{}{
+			"scrub": report,
+		},
+	})
+}
+
+func (h *DocumentHandler) ListScrubReports(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	reports, err := h.scrubService.ListScrubReports(ctx, requestToken(r))
+	if err != nil {
+		writeError(w, err, "Failed to get scrub reports")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"scrubs": reports,
+		},
+	})
+}
+
+func (h *DocumentHandler) GetScrubReport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := pathInt(r, "id")
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Неверный формат ID", http.StatusBadRequest)
+		return
+	}
+	report, err := h.scrubService.GetScrubReport(ctx, requestToken(r), id)
+	if err != nil {
+		writeError(w, err, "Failed to get scrub report")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"scrub": report,
+		},
+	})
+}
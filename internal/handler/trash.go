@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"HttpServer/internal/utils"
+	"net/http"
+	"strconv"
+)
+
+func (h *DocumentHandler) ListTrash(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	docs, err := h.documentService.ListTrash(ctx, requestToken(r))
+	if err != nil {
+		writeError(w, err, "Failed to get trash")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"docs": docs,
+		},
+	})
+}
+
+func (h *DocumentHandler) RestoreDoc(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := pathInt(r, "id")
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Неверный формат ID", http.StatusBadRequest)
+		return
+	}
+	st, err := h.documentService.RestoreDoc(ctx, requestToken(r), id)
+	if err != nil {
+		writeError(w, err, "Failed to restore document")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			strconv.Itoa(id): st,
+		},
+	})
+}
+
+func (h *DocumentHandler) EmptyTrash(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	n, err := h.documentService.EmptyTrash(ctx, requestToken(r))
+	if err != nil {
+		writeError(w, err, "Failed to empty trash")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"purged_files": n,
+		},
+	})
+}
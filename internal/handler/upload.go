@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"HttpServer/internal/models"
+	"HttpServer/internal/service"
+	"HttpServer/internal/utils"
+	"encoding/base64"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Resumable uploads follow the tus 1.0 protocol (https://tus.io) with the
+// creation, expiration, termination and checksum extensions.
+const tusVersion = "1.0.0"
+
+func tusHeaders(w http.ResponseWriter) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Cache-Control", "no-store")
+}
+
+// tusRequest rejects requests of clients that speak another protocol
+// version.
+func tusRequest(w http.ResponseWriter, r *http.Request) bool {
+	tusHeaders(w)
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		utils.ErrorResponse(w, http.StatusPreconditionFailed, "Unsupported tus version", http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// uploadHeaders describe the state of an upload. Once it is complete
+// Upload-Document-Id names the document it became.
+func uploadHeaders(w http.ResponseWriter, upload *models.Upload) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Expires", upload.Expires.UTC().Format(http.TimeFormat))
+	if upload.DocumentID != nil {
+		w.Header().Set("Upload-Document-Id", strconv.Itoa(*upload.DocumentID))
+	}
+}
+
+// UploadOptions advertises the supported protocol features.
+func (h *DocumentHandler) UploadOptions(w http.ResponseWriter, r *http.Request) {
+	tusHeaders(w)
+	algorithms := make([]string, 0, len(service.ChecksumAlgorithms))
+	for name := range service.ChecksumAlgorithms {
+		algorithms = append(algorithms, name)
+	}
+	sort.Strings(algorithms)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", "creation,expiration,termination,checksum")
+	w.Header().Set("Tus-Checksum-Algorithm", strings.Join(algorithms, ","))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateUpload starts an upload of Upload-Length bytes. Upload-Metadata may
+// carry filename, filetype, name, public, folder_id and tags (comma
+// separated) for the document to create.
+func (h *DocumentHandler) CreateUpload(w http.ResponseWriter, r *http.Request) {
+	if !tusRequest(w, r) {
+		return
+	}
+	ctx := r.Context()
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Invalid Upload-Length", http.StatusBadRequest)
+		return
+	}
+	raw := r.Header.Get("Upload-Metadata")
+	meta, err := parseUploadMetadata(raw)
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Invalid Upload-Metadata", http.StatusBadRequest)
+		return
+	}
+	doc := models.Document{
+		Name: meta["name"],
+		Mime: meta["filetype"],
+	}
+	if v, ok := meta["public"]; ok {
+		if doc.Public, err = strconv.ParseBool(v); err != nil {
+			utils.ErrorResponse(w, 400, "Invalid Upload-Metadata", http.StatusBadRequest)
+			return
+		}
+	}
+	if v, ok := meta["folder_id"]; ok {
+		folderID, err := strconv.Atoi(v)
+		if err != nil {
+			utils.ErrorResponse(w, 400, "Неверный формат ID", http.StatusBadRequest)
+			return
+		}
+		doc.FolderID = &folderID
+	}
+	if v := meta["tags"]; v != "" {
+		doc.Tags = strings.Split(v, ",")
+	}
+
+	upload, err := h.documentService.CreateUpload(ctx, requestToken(r), length, doc, meta["filename"], raw)
+	if err != nil {
+		writeError(w, err, "Failed to create upload")
+		return
+	}
+	uploadHeaders(w, upload)
+	w.Header().Set("Location", "/api/uploads/"+upload.ID)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// HeadUpload reports how much of an upload arrived so the client can resume.
+func (h *DocumentHandler) HeadUpload(w http.ResponseWriter, r *http.Request) {
+	if !tusRequest(w, r) {
+		return
+	}
+	upload, err := h.documentService.GetUpload(r.Context(), requestToken(r), mux.Vars(r)["id"])
+	if err != nil {
+		status, _ := errorStatus(err, "")
+		w.WriteHeader(status)
+		return
+	}
+	uploadHeaders(w, upload)
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if upload.Metadata != "" {
+		w.Header().Set("Upload-Metadata", upload.Metadata)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// PatchUpload appends the body at Upload-Offset. Upload-Checksum, e.g.
+// "sha1 <base64 digest>", makes the server verify the chunk.
+func (h *DocumentHandler) PatchUpload(w http.ResponseWriter, r *http.Request) {
+	if !tusRequest(w, r) {
+		return
+	}
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		utils.ErrorResponse(w, 415, "Content-Type must be application/offset+octet-stream", http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		utils.ErrorResponse(w, 400, "Invalid Upload-Offset", http.StatusBadRequest)
+		return
+	}
+	var sum *models.Checksum
+	if v := r.Header.Get("Upload-Checksum"); v != "" {
+		algorithm, encoded, _ := strings.Cut(v, " ")
+		digest, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			utils.ErrorResponse(w, 400, "Invalid Upload-Checksum", http.StatusBadRequest)
+			return
+		}
+		sum = &models.Checksum{Algorithm: algorithm, Sum: digest}
+	}
+
+	upload, err := h.documentService.WriteUpload(r.Context(), requestToken(r), mux.Vars(r)["id"], offset, r.Body, sum)
+	if err != nil {
+		writeError(w, err, fmt.Sprintf("Failed to write upload: %s", err))
+		return
+	}
+	uploadHeaders(w, upload)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteUpload cancels an upload.
+func (h *DocumentHandler) DeleteUpload(w http.ResponseWriter, r *http.Request) {
+	if !tusRequest(w, r) {
+		return
+	}
+	if err := h.documentService.DeleteUpload(r.Context(), requestToken(r), mux.Vars(r)["id"]); err != nil {
+		writeError(w, err, "Failed to delete upload")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseUploadMetadata decodes "key base64value,key base64value". Values may
+// be omitted.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	meta := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return meta, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, fmt.Errorf("empty metadata key")
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, err
+		}
+		meta[key] = string(value)
+	}
+	return meta, nil
+}
@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"HttpServer/internal/models"
+	"HttpServer/internal/utils"
+	"github.com/gorilla/mux"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+func pathInt(r *http.Request, name string) (int, error) {
+	return strconv.Atoi(mux.Vars(r)[name])
+}
+
+func (h *DocumentHandler) UpdateContent(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := pathInt(r, "id")
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Неверный формат ID", http.StatusBadRequest)
+		return
+	}
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		utils.ErrorResponse(w, 400, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		utils.ErrorResponse(w, 400, "File is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	fileData, err := io.ReadAll(file)
+	if err != nil {
+		utils.ErrorResponse(w, 500, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+	mimeType := r.FormValue("mime")
+	if mimeType == "" {
+		mimeType = header.Header.Get("Content-Type")
+	}
+	token := r.FormValue("token")
+	if token == "" {
+		token = requestToken(r)
+	}
+
+	v, err := h.documentService.UpdateContent(ctx, token, id, fileData, header.Filename, mimeType)
+	if err != nil {
+		writeError(w, err, "Failed to update document")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"version": v,
+		},
+	})
+}
+
+func (h *DocumentHandler) ListVersions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := pathInt(r, "id")
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Неверный формат ID", http.StatusBadRequest)
+		return
+	}
+	versions, err := h.documentService.ListVersions(ctx, requestToken(r), id)
+	if err != nil {
+		writeError(w, err, "Failed to get versions")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"versions": versions,
+		},
+	})
+}
+
+// DownloadContent streams the current version of a document, or the version
+// given in the path. The current version can also be reached with a share
+// link token in the link parameter, with the link password, if any, in the
+// X-Share-Password header or, for forms, the password field of a POST. It
+// is never read from the URL, which ends up in logs and browser history.
+func (h *DocumentHandler) DownloadContent(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := pathInt(r, "id")
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Неверный формат ID", http.StatusBadRequest)
+		return
+	}
+	version := 0
+	if _, ok := mux.Vars(r)["version"]; ok {
+		if version, err = pathInt(r, "version"); err != nil {
+			utils.ErrorResponse(w, 400, "Invalid version", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var v *models.DocumentVersion
+	var content io.ReadCloser
+	if link := r.URL.Query().Get("link"); link != "" && version == 0 {
+		password := r.Header.Get("X-Share-Password")
+		if password == "" && r.Method == http.MethodPost {
+			password = r.PostFormValue("password")
+		}
+		v, content, err = h.documentService.OpenShared(ctx, link, password, id)
+	} else {
+		v, content, err = h.documentService.OpenVersion(ctx, requestToken(r), id, version)
+	}
+	if err != nil {
+		writeError(w, err, "Failed to get document content")
+		return
+	}
+	defer content.Close()
+
+	if v.Mime != "" {
+		w.Header().Set("Content-Type", v.Mime)
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": v.Filename}))
+	w.Header().Set("Content-Length", strconv.FormatInt(v.Size, 10))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, content); err != nil {
+		log.Printf("failed to send version %d of document %d: %v", v.Version, id, err)
+	}
+}
+
+// DownloadThumbnail serves a thumbnail of an image document in the size
+// given by the size parameter, the smallest one by default.
+func (h *DocumentHandler) DownloadThumbnail(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := pathInt(r, "id")
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Неверный формат ID", http.StatusBadRequest)
+		return
+	}
+	size := 0
+	if s := r.URL.Query().Get("size"); s != "" {
+		if size, err = strconv.Atoi(s); err != nil || size <= 0 {
+			utils.ErrorResponse(w, 400, "Invalid size", http.StatusBadRequest)
+			return
+		}
+	}
+	mimeType, content, err := h.documentService.OpenThumbnail(ctx, requestToken(r), id, size)
+	if err != nil {
+		writeError(w, err, "Failed to get thumbnail")
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", mimeType)
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, content); err != nil {
+		log.Printf("failed to send thumbnail of document %d: %v", id, err)
+	}
+}
+
+func (h *DocumentHandler) RestoreVersion(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := pathInt(r, "id")
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Неверный формат ID", http.StatusBadRequest)
+		return
+	}
+	version, err := pathInt(r, "version")
+	if err != nil {
+		utils.ErrorResponse(w, 400, "Invalid version", http.StatusBadRequest)
+		return
+	}
+	v, err := h.documentService.RestoreVersion(ctx, requestToken(r), id, version)
+	if err != nil {
+		writeError(w, err, "Failed to restore version")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"version": v,
+		},
+	})
+}
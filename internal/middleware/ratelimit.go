@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"HttpServer/internal/utils"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tokenCacheTTL is how long the validity of a token is remembered, so that a
+// logged out token keeps bypassing the limit for at most this long.
+const tokenCacheTTL = time.Minute
+
+// TokenLookup returns the login a token belongs to, or an empty string for
+// an unknown token.
+type TokenLookup func(ctx context.Context, token string) (string, error)
+
+// AnonymousRateLimit allows at most limit requests per window from each
+// client address that does not present a valid token. Requests with a valid
+// token are passed through untouched.
+func AnonymousRateLimit(rdb *redis.Client, lookup TokenLookup, limit int, window time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := findToken(r); token != "" && validToken(r.Context(), rdb, lookup, token) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		now := time.Now()
+		slot := now.Truncate(window)
+		key := fmt.Sprintf("ratelimit:anon:%s:%d", clientIP(r), slot.Unix())
+		pipe := rdb.TxPipeline()
+		count := pipe.Incr(r.Context(), key)
+		pipe.Expire(r.Context(), key, window)
+		if _, err := pipe.Exec(r.Context()); err != nil {
+			// do not lock everyone out when Redis is unavailable
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit))
+		remaining := limit - int(count.Val())
+		if remaining < 0 {
+			remaining = 0
+		}
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		if int(count.Val()) > limit {
+			retry := slot.Add(window).Sub(now)
+			w.Header().Set("Retry-After", strconv.Itoa(int(retry.Seconds())+1))
+			utils.ErrorResponse(w, 429, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// findToken looks for a token in the query string, the Authorization header
+// and, for small JSON bodies, the token field of the body, which is put back
+// for the handler to read.
+func findToken(r *http.Request) string {
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token
+	}
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	if r.Body == nil || r.ContentLength <= 0 || r.ContentLength > 64<<10 {
+		return ""
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+	var payload struct {
+		Token string `json:"token"`
+	}
+	if json.Unmarshal(body, &payload) != nil {
+		return ""
+	}
+	return payload.Token
+}
+
+// validToken reports whether the token belongs to a user. The answer is
+// cached under a hash of the token, so that made up tokens cost one lookup
+// per window rather than one per request.
+func validToken(ctx context.Context, rdb *redis.Client, lookup TokenLookup, token string) bool {
+	sum := sha256.Sum256([]byte(token))
+	key := "ratelimit:token:" + hex.EncodeToString(sum[:])
+	if cached, err := rdb.Get(ctx, key).Result(); err == nil {
+		return cached == "1"
+	}
+	login, err := lookup(ctx, token)
+	if err != nil {
+		return false
+	}
+	valid := "0"
+	if login != "" {
+		valid = "1"
+	}
+	rdb.Set(ctx, key, valid, tokenCacheTTL)
+	return login != ""
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return strings.TrimSpace(r.RemoteAddr)
+	}
+	return host
+}
@@ -0,0 +1,25 @@
+package models
+
+// ArchiveRequest selects the documents to download as one archive: the
+// listed ones, everything below a folder, or whatever matches the filters.
+type ArchiveRequest struct {
+	IDs      []int            `json:"ids"`
+	FolderID *int             `json:"folder_id"`
+	Filters  []DocumentFilter `json:"filters"`
+}
+
+// ArchiveItem is a document to put into an archive with its current
+// version. Path is the folder path of the document relative to the
+// requested folder, empty for documents at the top.
+type ArchiveItem struct {
+	Path     string
+	Document Document
+	Version  DocumentVersion
+}
+
+// ArchiveEntry is a file of an archive: its name inside the archive and the
+// document version it holds.
+type ArchiveEntry struct {
+	Name    string
+	Version DocumentVersion
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// Hold changes the protection of a document. Nil fields are kept. A legal
+// hold lasts until it is released; an immutability period can be extended
+// but not shortened.
+type Hold struct {
+	LegalHold      *bool      `json:"legal_hold"`
+	ImmutableUntil *time.Time `json:"immutable_until"`
+}
+
+const (
+	AuditOK     = "ok"
+	AuditDenied = "denied"
+)
+
+// AuditEntry records a change of the protection of a document or an
+// attempt to change a protected document. Login is empty for attempts of
+// background jobs such as the trash purge.
+type AuditEntry struct {
+	ID         int64     `json:"id"`
+	Login      string    `json:"login"`
+	Action     string    `json:"action"`
+	DocumentID *int      `json:"document_id,omitempty"`
+	Outcome    string    `json:"outcome"`
+	Detail     string    `json:"detail,omitempty"`
+	Created    time.Time `json:"created"`
+}
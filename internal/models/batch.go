@@ -0,0 +1,46 @@
+package models
+
+type BatchAction string
+
+const (
+	BatchDelete       BatchAction = "delete"
+	BatchSetPublic    BatchAction = "set_public"
+	BatchAddGrants    BatchAction = "add_grants"
+	BatchRemoveGrants BatchAction = "remove_grants"
+	BatchAddTags      BatchAction = "add_tags"
+	BatchRemoveTags   BatchAction = "remove_tags"
+)
+
+// BatchRequest applies one action to many documents. Only the fields the
+// action needs are used. With Atomic set nothing is changed unless the
+// action succeeds for every document.
+type BatchRequest struct {
+	Action BatchAction `json:"action"`
+	IDs    []int       `json:"ids"`
+	Public *bool       `json:"public"`
+	Grants []Grant     `json:"grants"`
+	Logins []string    `json:"logins"`
+	Tags   []string    `json:"tags"`
+	Atomic bool        `json:"atomic"`
+}
+
+type BatchStatus string
+
+const (
+	BatchOK         BatchStatus = "ok"
+	BatchFailed     BatchStatus = "failed"
+	BatchRolledBack BatchStatus = "rolled_back"
+)
+
+// BatchResult is the outcome of a batch action for one document. Err is set
+// for failed items.
+type BatchResult struct {
+	ID     int
+	Status BatchStatus
+	Err    error
+}
+
+type BatchReport struct {
+	Committed bool
+	Results   []BatchResult
+}
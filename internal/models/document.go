@@ -1,16 +1,132 @@
 package models
 
 import (
+	"encoding/json"
 	"github.com/lib/pq"
 	"time"
 )
 
+// Document is a stored document. ExpiresAt is when it is deleted: the
+// expiry set on it or the one required by a retention rule, whichever is
+// earlier. A document under legal hold or immutable until a time in the
+// future cannot be deleted or changed; see Hold. ScanStatus is the one of
+// the current version.
 type Document struct {
-	ID      int            `json:"id"`
-	Name    string         `json:"name"`
-	Mime    string         `json:"mime"`
-	File    bool           `json:"file"`
-	Public  bool           `json:"public"`
-	Created time.Time      `json:"created"`
-	Grant   pq.StringArray `json:"grant"`
+	ID             int                    `json:"id"`
+	Name           string                 `json:"name"`
+	Mime           string                 `json:"mime"`
+	File           bool                   `json:"file"`
+	Public         bool                   `json:"public"`
+	Owner          string                 `json:"owner"`
+	Created        time.Time              `json:"created"`
+	Grant          pq.StringArray         `json:"grant"`
+	Tags           pq.StringArray         `json:"tags"`
+	Metadata       map[string]interface{} `json:"metadata"`
+	Version        int                    `json:"version"`
+	FolderID       *int                   `json:"folder_id,omitempty"`
+	MaxVersions    *int                   `json:"max_versions,omitempty"`
+	DeletedAt      *time.Time             `json:"deleted_at,omitempty"`
+	ExpiresAt      *time.Time             `json:"expires_at,omitempty"`
+	LegalHold      bool                   `json:"legal_hold"`
+	ImmutableUntil *time.Time             `json:"immutable_until,omitempty"`
+	ScanStatus     string                 `json:"scan_status,omitempty"`
+	Content        string                 `json:"-"`
+}
+
+// PublicDocument is what anyone may see of a public document. It names the
+// owner, who published it, but leaves out whom else it is shared with, its
+// folder, its metadata and its retention and hold state.
+type PublicDocument struct {
+	ID         int            `json:"id"`
+	Name       string         `json:"name"`
+	Mime       string         `json:"mime"`
+	File       bool           `json:"file"`
+	Public     bool           `json:"public"`
+	Owner      string         `json:"owner"`
+	Created    time.Time      `json:"created"`
+	Tags       pq.StringArray `json:"tags"`
+	Version    int            `json:"version"`
+	ScanStatus string         `json:"scan_status,omitempty"`
+}
+
+// PublicView returns the public projection of the document.
+func (d Document) PublicView() PublicDocument {
+	return PublicDocument{
+		ID:         d.ID,
+		Name:       d.Name,
+		Mime:       d.Mime,
+		File:       d.File,
+		Public:     d.Public,
+		Owner:      d.Owner,
+		Created:    d.Created,
+		Tags:       d.Tags,
+		Version:    d.Version,
+		ScanStatus: d.ScanStatus,
+	}
+}
+
+// DocumentPatch changes the attributes of a document. Nil fields are kept.
+// Tags replace the current tags; Metadata is merged into the current
+// metadata, and a null value removes its key. A null ExpiresAt removes the
+// expiry set on the document.
+type DocumentPatch struct {
+	Name      *string                `json:"name"`
+	Tags      *[]string              `json:"tags"`
+	Metadata  map[string]interface{} `json:"metadata"`
+	ExpiresAt OptionalTime           `json:"expires_at"`
+}
+
+// OptionalTime tells a null value, which sets Time to nil, from a missing
+// one, which leaves Set false.
+type OptionalTime struct {
+	Set  bool
+	Time *time.Time
+}
+
+func (t *OptionalTime) UnmarshalJSON(data []byte) error {
+	t.Set = true
+	return json.Unmarshal(data, &t.Time)
+}
+
+// Scan statuses of versions. Pending versions were not scanned yet, e.g.
+// because the scanner was unavailable.
+const (
+	ScanPending  = "pending"
+	ScanClean    = "clean"
+	ScanInfected = "infected"
+)
+
+// Sources of the checksum of a version. A checksum computed from the stored
+// blob only shows changes after it was computed, not whether the blob was
+// stored intact.
+const (
+	ChecksumUpload   = "upload"
+	ChecksumComputed = "computed"
+)
+
+// DocumentVersion is one stored content of a document. SHA256 is the hex
+// digest of the content, empty for versions stored before digests were
+// recorded, and SHA256Source tells where it comes from. ScanResult names the
+// malware found in infected versions.
+type DocumentVersion struct {
+	DocumentID   int       `json:"document_id"`
+	Version      int       `json:"version"`
+	Filename     string    `json:"filename"`
+	Mime         string    `json:"mime"`
+	Size         int64     `json:"size"`
+	SHA256       string    `json:"sha256,omitempty"`
+	SHA256Source string    `json:"sha256_source,omitempty"`
+	ScanStatus   string    `json:"scan_status"`
+	ScanResult   string    `json:"scan_result,omitempty"`
+	StorageKey   string    `json:"-"`
+	CreatedBy    string    `json:"created_by"`
+	Created      time.Time `json:"created"`
+}
+
+type SearchResult struct {
+	Document
+	Rank float32 `json:"rank"`
+	// Snippet is HTML with the matches in <mark> tags and everything else
+	// escaped.
+	Snippet string `json:"snippet"`
 }
@@ -0,0 +1,27 @@
+package models
+
+import "errors"
+
+var (
+	ErrInvalidQuery  = errors.New("invalid query")
+	ErrUnauthorized  = errors.New("unauthorized")
+	ErrForbidden     = errors.New("forbidden")
+	ErrNotFound      = errors.New("not found")
+	ErrGone          = errors.New("no longer available")
+	ErrUnsupported   = errors.New("unsupported media type")
+	ErrConflict      = errors.New("conflict")
+	ErrTooLarge      = errors.New("too large")
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	// ErrChecksumMismatch means received data does not match the checksum
+	// the client sent along.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// ErrImmutable means the document is under legal hold or immutable.
+	ErrImmutable = errors.New("document is protected")
+	// ErrCorrupted means stored content no longer matches its checksum.
+	ErrCorrupted = errors.New("content is corrupted")
+	// ErrBlocked means content may not be downloaded because it is infected
+	// or, by policy, not scanned yet.
+	ErrBlocked = errors.New("download blocked")
+	// ErrLocked means another user has checked the document out.
+	ErrLocked = errors.New("document is locked")
+)
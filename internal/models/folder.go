@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+type Folder struct {
+	ID       int       `json:"id"`
+	Name     string    `json:"name"`
+	ParentID *int      `json:"parent_id"`
+	Owner    string    `json:"owner"`
+	Created  time.Time `json:"created"`
+}
+
+// FolderChildren is one page of a folder's content. Subfolders are only
+// listed on the first page.
+type FolderChildren struct {
+	Folder  Folder
+	Folders []Folder
+	Docs    *DocumentList
+}
+
+// FolderChange renames and/or moves a folder. Fields left nil are kept; a
+// ParentID of zero moves the folder to the top level.
+type FolderChange struct {
+	Name     *string `json:"name"`
+	ParentID *int    `json:"parent_id"`
+}
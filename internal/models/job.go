@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+type JobStatus string
+
+const (
+	JobPending JobStatus = "pending"
+	JobRunning JobStatus = "running"
+	JobDone    JobStatus = "done"
+	JobFailed  JobStatus = "failed"
+)
+
+// Job is a long running task whose progress can be polled. Total is zero
+// while the amount of work is not known yet.
+type Job struct {
+	ID        string     `json:"id"`
+	Kind      string     `json:"kind"`
+	Owner     string     `json:"owner"`
+	Status    JobStatus  `json:"status"`
+	Total     int        `json:"total"`
+	Processed int        `json:"processed"`
+	Failed    int        `json:"failed"`
+	Documents []int      `json:"documents"`
+	Errors    []JobError `json:"errors,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	Created   time.Time  `json:"created"`
+	Updated   time.Time  `json:"updated"`
+}
+
+// JobError is a failure of a job on one item, e.g. an archive entry.
+type JobError struct {
+	Item  string `json:"item"`
+	Error string `json:"error"`
+}
+
+// ImportOptions control how an archive is expanded into documents.
+type ImportOptions struct {
+	// FolderID is where the documents go, the top level when nil.
+	FolderID *int `json:"folder_id"`
+	// KeepFolders recreates the directories of the archive as folders.
+	KeepFolders bool     `json:"keep_folders"`
+	Public      bool     `json:"public"`
+	Tags        []string `json:"tags"`
+	Grants      []Grant  `json:"grants"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// ShareLink gives anyone holding its token access to the current content of
+// one document. The token itself is only known when the link is created.
+type ShareLink struct {
+	ID           int        `json:"id"`
+	DocumentID   int        `json:"document_id"`
+	Token        string     `json:"token,omitempty"`
+	CreatedBy    string     `json:"created_by"`
+	Created      time.Time  `json:"created"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	MaxDownloads *int       `json:"max_downloads,omitempty"`
+	Downloads    int        `json:"downloads"`
+	Denied       int        `json:"denied"`
+	LastAccess   *time.Time `json:"last_access,omitempty"`
+	HasPassword  bool       `json:"has_password"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	PasswordHash string     `json:"-"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// DocumentLock is the check-out of a document by one user, who alone may
+// change it until the lock is released or expires.
+type DocumentLock struct {
+	DocumentID int       `json:"document_id"`
+	Owner      string    `json:"owner"`
+	Acquired   time.Time `json:"acquired"`
+	Expires    time.Time `json:"expires"`
+}
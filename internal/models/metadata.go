@@ -0,0 +1,73 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// MetaFieldPrefix marks a filter on a metadata key, e.g. meta.customer.
+const MetaFieldPrefix = "meta."
+
+const (
+	maxTags        = 50
+	maxTagLength   = 64
+	maxMetaKeys    = 50
+	maxMetaTextLen = 1024
+)
+
+var metaKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+func ValidMetaKey(key string) bool {
+	return metaKeyPattern.MatchString(key)
+}
+
+// NormalizeTags lower-cases, trims, sorts and deduplicates tags.
+func NormalizeTags(tags []string) ([]string, error) {
+	if len(tags) > maxTags {
+		return nil, fmt.Errorf("%w: at most %d tags are allowed", ErrInvalidQuery, maxTags)
+	}
+	seen := make(map[string]bool, len(tags))
+	res := make([]string, 0, len(tags))
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || len(t) > maxTagLength || strings.Contains(t, ",") {
+			return nil, fmt.Errorf("%w: invalid tag %q", ErrInvalidQuery, t)
+		}
+		if !seen[t] {
+			seen[t] = true
+			res = append(res, t)
+		}
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// ValidateMetadata checks that metadata maps valid keys to strings, numbers
+// or booleans. With allowNull a null value is accepted as well; in a patch
+// it removes the key.
+func ValidateMetadata(metadata map[string]interface{}, allowNull bool) error {
+	if len(metadata) > maxMetaKeys {
+		return fmt.Errorf("%w: at most %d metadata keys are allowed", ErrInvalidQuery, maxMetaKeys)
+	}
+	for key, value := range metadata {
+		if !ValidMetaKey(key) {
+			return fmt.Errorf("%w: invalid metadata key %q", ErrInvalidQuery, key)
+		}
+		switch v := value.(type) {
+		case string:
+			if len(v) > maxMetaTextLen {
+				return fmt.Errorf("%w: metadata value of %s is too long", ErrInvalidQuery, key)
+			}
+		case float64, bool:
+		case nil:
+			if !allowNull {
+				return fmt.Errorf("%w: metadata value of %s is null", ErrInvalidQuery, key)
+			}
+		default:
+			return fmt.Errorf("%w: metadata value of %s must be a string, number or boolean", ErrInvalidQuery, key)
+		}
+	}
+	return nil
+}
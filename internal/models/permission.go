@@ -0,0 +1,43 @@
+package models
+
+// Permission is an access level on a document. Every level includes all the
+// levels before it.
+type Permission string
+
+const (
+	PermView     Permission = "view"
+	PermDownload Permission = "download"
+	PermEdit     Permission = "edit"
+	PermShare    Permission = "share"
+	PermDelete   Permission = "delete"
+	PermOwner    Permission = "owner"
+)
+
+var permissionLevels = []Permission{"", PermView, PermDownload, PermEdit, PermShare, PermDelete, PermOwner}
+
+// Level returns the numeric level stored in the database, or zero for an
+// unknown permission.
+func (p Permission) Level() int {
+	for level, perm := range permissionLevels {
+		if perm == p {
+			return level
+		}
+	}
+	return 0
+}
+
+func (p Permission) Valid() bool {
+	return p.Level() > 0
+}
+
+func PermissionFromLevel(level int) Permission {
+	if level < 0 || level >= len(permissionLevels) {
+		return ""
+	}
+	return permissionLevels[level]
+}
+
+type Grant struct {
+	Login      string     `json:"login"`
+	Permission Permission `json:"permission"`
+}
@@ -0,0 +1,65 @@
+package models
+
+type FilterOp string
+
+const (
+	FilterEq     FilterOp = "eq"
+	FilterPrefix FilterOp = "prefix"
+	FilterRange  FilterOp = "range"
+	FilterIn     FilterOp = "in"
+)
+
+// DocumentFilter restricts a listing by one field. Values holds a single
+// value for eq and prefix, any number of values for in, and a [from, to]
+// pair for range where an empty bound means the range is open on that side.
+type DocumentFilter struct {
+	Field  string   `json:"field"`
+	Op     FilterOp `json:"op"`
+	Values []string `json:"values"`
+}
+
+type SortField struct {
+	Field string `json:"field"`
+	Desc  bool   `json:"desc"`
+}
+
+type DocumentQuery struct {
+	Filters   []DocumentFilter `json:"filters,omitempty"`
+	Sort      []SortField      `json:"sort,omitempty"`
+	Limit     int              `json:"limit"`
+	After     *Keyset          `json:"after,omitempty"`
+	Before    *Keyset          `json:"before,omitempty"`
+	WithTotal bool             `json:"with_total,omitempty"`
+	Cursor    string           `json:"-"`
+}
+
+// Keyset identifies a position in a sorted listing by the sort values of a
+// row followed by its id.
+type Keyset struct {
+	Values []string `json:"v"`
+	ID     int      `json:"id"`
+}
+
+type DocumentPage struct {
+	Docs  []Document `json:"docs"`
+	Next  *Keyset    `json:"next,omitempty"`
+	Prev  *Keyset    `json:"prev,omitempty"`
+	Total *int       `json:"total,omitempty"`
+}
+
+// DocumentList is a page of documents with opaque cursors for the
+// neighbouring pages.
+type DocumentList struct {
+	Docs       []Document
+	NextCursor string
+	PrevCursor string
+	Total      *int
+}
+
+// PublicDocumentList is a DocumentList as shown to anyone.
+type PublicDocumentList struct {
+	Docs       []PublicDocument
+	NextCursor string
+	PrevCursor string
+	Total      *int
+}
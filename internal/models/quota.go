@@ -0,0 +1,45 @@
+package models
+
+// Quota limits what a user may store. Zero means unlimited.
+type Quota struct {
+	MaxBytes     int64 `json:"max_bytes"`
+	MaxDocuments int   `json:"max_documents"`
+	MaxFileSize  int64 `json:"max_file_size"`
+}
+
+// QuotaOverride replaces parts of the quota of a user's role. Nil fields
+// keep the role value.
+type QuotaOverride struct {
+	MaxBytes     *int64 `json:"max_bytes"`
+	MaxDocuments *int   `json:"max_documents"`
+	MaxFileSize  *int64 `json:"max_file_size"`
+}
+
+// Apply returns q with the fields set in o replaced.
+func (o QuotaOverride) Apply(q Quota) Quota {
+	if o.MaxBytes != nil {
+		q.MaxBytes = *o.MaxBytes
+	}
+	if o.MaxDocuments != nil {
+		q.MaxDocuments = *o.MaxDocuments
+	}
+	if o.MaxFileSize != nil {
+		q.MaxFileSize = *o.MaxFileSize
+	}
+	return q
+}
+
+// Usage is what a user's documents take up, versions and trash included.
+type Usage struct {
+	Bytes     int64 `json:"bytes"`
+	Documents int   `json:"documents"`
+}
+
+// QuotaReport is the quota of a user next to what the user uses. Override
+// is only reported to admins.
+type QuotaReport struct {
+	Login    string         `json:"login"`
+	Quota    Quota          `json:"quota"`
+	Override *QuotaOverride `json:"override,omitempty"`
+	Usage    Usage          `json:"usage"`
+}
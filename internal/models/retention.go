@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// RetentionRule expires documents Days after they were created. It applies
+// to documents that match all of its criteria: the tag, the folder or one
+// of its subfolders, and the MIME type, which may be a wildcard such as
+// image/*. At least one criterion is required.
+type RetentionRule struct {
+	ID        int       `json:"id"`
+	Tag       *string   `json:"tag,omitempty"`
+	FolderID  *int      `json:"folder_id,omitempty"`
+	Mime      *string   `json:"mime,omitempty"`
+	Days      int       `json:"days"`
+	CreatedBy string    `json:"created_by"`
+	Created   time.Time `json:"created"`
+}
+
+const NotifyExpiry = "expiry"
+
+// Notification is a message for a user, e.g. that a document expires soon.
+type Notification struct {
+	ID         int        `json:"id"`
+	Login      string     `json:"-"`
+	Kind       string     `json:"kind"`
+	DocumentID *int       `json:"document_id,omitempty"`
+	Message    string     `json:"message"`
+	Created    time.Time  `json:"created"`
+	ReadAt     *time.Time `json:"read_at,omitempty"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+const (
+	BlobMissing   = "missing"
+	BlobCorrupted = "corrupted"
+	BlobOrphaned  = "orphaned"
+)
+
+// BlobProblem is a blob a scrub found missing, corrupted or orphaned, i.e.
+// in storage without a version referring to it.
+type BlobProblem struct {
+	Kind       string `json:"kind"`
+	StorageKey string `json:"storage_key"`
+	DocumentID *int   `json:"document_id,omitempty"`
+	Version    *int   `json:"version,omitempty"`
+	Detail     string `json:"detail,omitempty"`
+}
+
+// ScrubReport is the outcome of checking every version against its blob.
+// Recorded counts versions without a checksum, which got one. Unverified
+// counts versions whose checksum was computed from their blob rather than
+// taken on upload, including the recorded ones, so their check only shows
+// changes since. The counts are exact while Problems is capped. Finished is nil while the scrub runs.
+type ScrubReport struct {
+	ID         int           `json:"id"`
+	Started    time.Time     `json:"started"`
+	Updated    time.Time     `json:"updated"`
+	Finished   *time.Time    `json:"finished,omitempty"`
+	Versions   int           `json:"versions"`
+	Recorded   int           `json:"recorded"`
+	Unverified int           `json:"unverified"`
+	Blobs      int           `json:"blobs"`
+	Missing    int           `json:"missing"`
+	Corrupted  int           `json:"corrupted"`
+	Orphaned   int           `json:"orphaned"`
+	Problems   []BlobProblem `json:"problems,omitempty"`
+	Error      string        `json:"error,omitempty"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Upload is a resumable upload. The content is received in chunks and
+// becomes a document once Offset reaches Length.
+type Upload struct {
+	ID     string `json:"id"`
+	Owner  string `json:"owner"`
+	Length int64  `json:"length"`
+	Offset int64  `json:"offset"`
+	// Document holds the attributes of the document to create.
+	Document Document `json:"document"`
+	Filename string   `json:"filename"`
+	// Metadata is the metadata the client sent, returned to it as is.
+	Metadata   string    `json:"metadata,omitempty"`
+	DocumentID *int      `json:"document_id,omitempty"`
+	Created    time.Time `json:"created"`
+	Expires    time.Time `json:"expires"`
+}
+
+// Checksum is the digest of a chunk computed by the client.
+type Checksum struct {
+	Algorithm string
+	Sum       []byte
+}
@@ -1,6 +1,12 @@
 package models
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type User struct {
 	Login    string
 	Password string
+	Role     string
 }
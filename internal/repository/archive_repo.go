@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"HttpServer/internal/models"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// FindArchiveItems returns the documents selected by req that login may
+// download, with their current versions. Listed documents that cannot be
+// downloaded are an error; documents below a folder or matched by filters
+// are silently left out. More than limit documents are an error too.
+func (r *repo) FindArchiveItems(ctx context.Context, login string, req models.ArchiveRequest, limit int) ([]models.ArchiveItem, error) {
+	b := &sqlBuilder{}
+	from := `documents5 d`
+	path, order := `''::text`, `d.name, d.id`
+	conds := []string{accessibleBy(b.arg(login), models.PermDownload)}
+
+	switch {
+	case len(req.IDs) > 0:
+		conds = append(conds, "d.id = ANY("+b.arg(req.IDs)+")")
+	case req.FolderID != nil:
+		if _, _, err := folderGrants.require(ctx, r.db, login, *req.FolderID, models.PermView); err != nil {
+			return nil, err
+		}
+		from = `tree t JOIN documents5 d ON d.folder_id = t.id`
+		path, order = `t.path`, `t.path, d.name, d.id`
+	default:
+		filterConds, err := b.filters(req.Filters)
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, filterConds...)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s, %s, %s
+		FROM %s
+		JOIN document_versions v ON v.document_id = d.id AND v.version = d.current_version
+		WHERE %s
+		ORDER BY %s
+		LIMIT %s
+	`, documentColumns, versionColumns, path, from, strings.Join(conds, " AND "), order, b.arg(limit+1))
+	if req.FolderID != nil {
+		// the folder itself is the root of the archive, so its path is empty
+		query = `
+			WITH RECURSIVE tree AS (
+				SELECT f.id, ''::text AS path FROM folders f WHERE f.id = ` + b.arg(*req.FolderID) + `
+				UNION ALL
+				SELECT c.id, ltrim(t.path || '/' || c.name, '/') FROM folders c JOIN tree t ON c.parent_id = t.id
+			)` + query
+	}
+
+	rows, err := r.db.Query(ctx, query, b.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []models.ArchiveItem
+	for rows.Next() {
+		var it models.ArchiveItem
+		if err := scanDocument(rows, &it.Document, append(versionDest(&it.Version), &it.Path)...); err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(items) > limit {
+		return nil, fmt.Errorf("%w: at most %d documents can be archived at once", models.ErrInvalidQuery, limit)
+	}
+
+	if len(req.IDs) > 0 {
+		found := make(map[int]bool, len(items))
+		for _, it := range items {
+			found[it.Document.ID] = true
+		}
+		for _, id := range req.IDs {
+			if !found[id] {
+				if err := r.accessError(ctx, login, id, models.PermDownload); err != nil {
+					return nil, fmt.Errorf("document %d: %w", id, err)
+				}
+			}
+		}
+	}
+	return items, nil
+}
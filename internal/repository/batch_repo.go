@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"HttpServer/internal/models"
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+)
+
+// Batch applies req to every listed document in a single transaction. Each
+// document gets its own savepoint, so a failure only undoes the changes to
+// that document, unless req is atomic, in which case any failure undoes
+// everything. A document for which check fails counts as failed without
+// being touched.
+func (r *repo) Batch(ctx context.Context, login string, req models.BatchRequest, check func(id int) error) (*models.BatchReport, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	report := &models.BatchReport{Results: make([]models.BatchResult, 0, len(req.IDs))}
+	var affected []string
+	failed := false
+	for _, id := range req.IDs {
+		if err := check(id); err != nil {
+			report.Results = append(report.Results, models.BatchResult{ID: id, Status: models.BatchFailed, Err: err})
+			failed = true
+			continue
+		}
+		sp, err := tx.Begin(ctx)
+		if err != nil {
+			return nil, err
+		}
+		logins, err := r.batchItem(ctx, sp, login, id, req)
+		if err != nil {
+			if rbErr := sp.Rollback(ctx); rbErr != nil {
+				return nil, rbErr
+			}
+			report.Results = append(report.Results, models.BatchResult{ID: id, Status: models.BatchFailed, Err: err})
+			failed = true
+			continue
+		}
+		if err := sp.Commit(ctx); err != nil {
+			return nil, err
+		}
+		report.Results = append(report.Results, models.BatchResult{ID: id, Status: models.BatchOK})
+		affected = append(affected, logins...)
+	}
+
+	if failed && req.Atomic {
+		for i := range report.Results {
+			if report.Results[i].Status == models.BatchOK {
+				report.Results[i].Status = models.BatchRolledBack
+			}
+		}
+		return report, nil
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	report.Committed = true
+
+	r.invalidateUsers(ctx, affected...)
+
+	return report, nil
+}
+
+// batchItem applies the action of req to one document and returns the
+// logins whose cached views it affects.
+func (r *repo) batchItem(ctx context.Context, tx pgx.Tx, login string, id int, req models.BatchRequest) ([]string, error) {
+	switch req.Action {
+	case models.BatchAddGrants, models.BatchRemoveGrants:
+		change := addGrantsChange(ctx, documentGrants, login, id, req.Grants)
+		if req.Action == models.BatchRemoveGrants {
+			change = r.mutableChange(ctx, login, string(req.Action), id, removeGrantsChange(ctx, documentGrants, id, req.Logins))
+		}
+		_, affected, err := changeGrantsTx(ctx, tx, documentGrants, login, id, change)
+		if err != nil {
+			return nil, err
+		}
+		audience, err := documentAudience(ctx, tx, id)
+		return append(affected, audience...), err
+	}
+
+	var perm models.Permission
+	var query string
+	var args []interface{}
+	switch req.Action {
+	case models.BatchDelete:
+		perm = models.PermDelete
+		query = `UPDATE documents5 SET deleted_at = now(), deleted_by = $2 WHERE id = $1`
+		args = []interface{}{id, login}
+	case models.BatchSetPublic:
+		perm = models.PermShare
+		query = `UPDATE documents5 SET "public" = $2 WHERE id = $1`
+		args = []interface{}{id, *req.Public}
+	case models.BatchAddTags:
+		perm = models.PermEdit
+		query = `UPDATE documents5 SET tags = ARRAY(SELECT DISTINCT t FROM unnest(tags || $2::text[]) t ORDER BY t) WHERE id = $1`
+		args = []interface{}{id, req.Tags}
+	case models.BatchRemoveTags:
+		perm = models.PermEdit
+		query = `UPDATE documents5 SET tags = ARRAY(SELECT t FROM unnest(tags) t WHERE t <> ALL($2::text[]) ORDER BY t) WHERE id = $1`
+		args = []interface{}{id, req.Tags}
+	default:
+		return nil, fmt.Errorf("%w: unknown action %q", models.ErrInvalidQuery, req.Action)
+	}
+
+	if _, _, err := requireAccess(ctx, tx, login, id, perm); err != nil {
+		return nil, err
+	}
+	// publishing only changes who may see a document, so held ones may be
+	// published and withdrawn
+	if req.Action != models.BatchSetPublic {
+		if err := r.requireMutable(ctx, tx, login, string(req.Action), id); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tx.Exec(ctx, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to update document: %w", err)
+	}
+	return documentAudience(ctx, tx, id)
+}
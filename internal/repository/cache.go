@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const cacheTTL = time.Minute * 10
+
+func userCacheSet(login string) string {
+	return fmt.Sprintf("cache:user:%s", login)
+}
+
+// cacheFor stores data under key and remembers the key for every login whose
+// view it depends on, so that invalidateUsers can find it later.
+func (r *repo) cacheFor(ctx context.Context, key string, data []byte, logins ...string) {
+	pipe := r.redis.TxPipeline()
+	pipe.Set(ctx, key, data, cacheTTL)
+	for _, login := range logins {
+		pipe.SAdd(ctx, userCacheSet(login), key)
+		pipe.Expire(ctx, userCacheSet(login), cacheTTL)
+	}
+	pipe.Exec(ctx)
+}
+
+// invalidateUsers drops every cached listing and document of the logins.
+func (r *repo) invalidateUsers(ctx context.Context, logins ...string) {
+	for _, login := range logins {
+		set := userCacheSet(login)
+		keys, err := r.redis.SMembers(ctx, set).Result()
+		if err != nil {
+			continue
+		}
+		r.redis.Del(ctx, append(keys, set)...)
+	}
+}
+
+// invalidateDocument drops the cached views of everyone in the audience of
+// a document.
+func (r *repo) invalidateDocument(ctx context.Context, id int) {
+	if audience, err := documentAudience(ctx, r.db, id); err == nil {
+		r.invalidateUsers(ctx, audience...)
+	}
+}
+
+// invalidateAllUsers drops every cached listing and document, for changes
+// such as retention rules that may touch the documents of anyone. Other keys
+// in Redis are left alone.
+func (r *repo) invalidateAllUsers(ctx context.Context) {
+	iter := r.redis.Scan(ctx, 0, userCacheSet("*"), 100).Iterator()
+	var sets []string
+	for iter.Next(ctx) {
+		sets = append(sets, iter.Val())
+	}
+	for _, set := range sets {
+		keys, err := r.redis.SMembers(ctx, set).Result()
+		if err != nil {
+			continue
+		}
+		r.redis.Del(ctx, append(keys, set)...)
+	}
+}
@@ -0,0 +1,350 @@
+package repository
+
+import (
+	"HttpServer/internal/models"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type fieldKind int
+
+const (
+	textField fieldKind = iota
+	boolField
+	timeField
+	intField
+	grantField
+	tagField
+)
+
+type documentField struct {
+	column   string
+	kind     fieldKind
+	sortable bool
+}
+
+// documentFields is the whitelist of fields that can be used in filters and
+// sort clauses. Nothing outside of it ever reaches the generated SQL.
+var documentFields = map[string]documentField{
+	"name":    {column: "d.name", kind: textField, sortable: true},
+	"mime":    {column: "d.mime", kind: textField, sortable: true},
+	"public":  {column: `d."public"`, kind: boolField, sortable: true},
+	"created": {column: "d.created", kind: timeField, sortable: true},
+	"owner":   {column: "d.owner_login", kind: textField, sortable: true},
+	"folder":  {column: "d.folder_id", kind: intField},
+	"grantee": {column: "g.login", kind: grantField},
+	"tag":     {column: "d.tags", kind: tagField},
+}
+
+// hasGrant wraps a condition on document_grants g of the current document.
+const hasGrant = "EXISTS (SELECT 1 FROM document_grants g WHERE g.document_id = d.id AND %s)"
+
+var defaultSort = []models.SortField{{Field: "name"}, {Field: "created"}}
+
+type sqlBuilder struct {
+	args []interface{}
+}
+
+func (b *sqlBuilder) arg(v interface{}) string {
+	b.args = append(b.args, v)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+func (b *sqlBuilder) filters(filters []models.DocumentFilter) ([]string, error) {
+	var conds []string
+	for _, f := range filters {
+		cond, err := b.filter(f)
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, cond)
+	}
+	return conds, nil
+}
+
+func (b *sqlBuilder) filter(f models.DocumentFilter) (string, error) {
+	if strings.HasPrefix(f.Field, models.MetaFieldPrefix) {
+		return b.metaFilter(f)
+	}
+	field, ok := documentFields[f.Field]
+	if !ok {
+		return "", fmt.Errorf("%w: unknown field %q", models.ErrInvalidQuery, f.Field)
+	}
+	if f.Op == "" {
+		f.Op = models.FilterEq
+	}
+
+	switch f.Op {
+	case models.FilterEq:
+		if len(f.Values) != 1 {
+			return "", fmt.Errorf("%w: %s.eq expects one value", models.ErrInvalidQuery, f.Field)
+		}
+		v, err := parseFieldValue(field, f.Values[0])
+		if err != nil {
+			return "", fmt.Errorf("%w: %s: %v", models.ErrInvalidQuery, f.Field, err)
+		}
+		switch field.kind {
+		case grantField:
+			return fmt.Sprintf(hasGrant, fmt.Sprintf("%s = %s", field.column, b.arg(v))), nil
+		case tagField:
+			return fmt.Sprintf("%s @> ARRAY[%s]::text[]", field.column, b.arg(v)), nil
+		}
+		return fmt.Sprintf("%s = %s", field.column, b.arg(v)), nil
+
+	case models.FilterPrefix:
+		if field.kind != textField || len(f.Values) != 1 {
+			return "", fmt.Errorf("%w: prefix is not supported for %s", models.ErrInvalidQuery, f.Field)
+		}
+		return fmt.Sprintf(`%s LIKE %s ESCAPE '\'`, field.column, b.arg(escapeLike(f.Values[0])+"%")), nil
+
+	case models.FilterIn:
+		if len(f.Values) == 0 {
+			return "", fmt.Errorf("%w: %s.in expects at least one value", models.ErrInvalidQuery, f.Field)
+		}
+		values := make([]interface{}, 0, len(f.Values))
+		for _, raw := range f.Values {
+			v, err := parseFieldValue(field, raw)
+			if err != nil {
+				return "", fmt.Errorf("%w: %s: %v", models.ErrInvalidQuery, f.Field, err)
+			}
+			values = append(values, v)
+		}
+		switch field.kind {
+		case grantField:
+			return fmt.Sprintf(hasGrant, fmt.Sprintf("%s = ANY(%s)", field.column, b.arg(toStrings(values)))), nil
+		case tagField:
+			return fmt.Sprintf("%s && %s::text[]", field.column, b.arg(toStrings(values))), nil
+		}
+		placeholders := make([]string, len(values))
+		for i, v := range values {
+			placeholders[i] = b.arg(v)
+		}
+		return fmt.Sprintf("%s IN (%s)", field.column, strings.Join(placeholders, ", ")), nil
+
+	case models.FilterRange:
+		if field.kind == boolField || field.kind == grantField || field.kind == tagField || len(f.Values) != 2 {
+			return "", fmt.Errorf("%w: range is not supported for %s", models.ErrInvalidQuery, f.Field)
+		}
+		var conds []string
+		if f.Values[0] != "" {
+			v, err := parseFieldValue(field, f.Values[0])
+			if err != nil {
+				return "", fmt.Errorf("%w: %s: %v", models.ErrInvalidQuery, f.Field, err)
+			}
+			conds = append(conds, fmt.Sprintf("%s >= %s", field.column, b.arg(v)))
+		}
+		if f.Values[1] != "" {
+			v, err := parseFieldValue(field, f.Values[1])
+			if err != nil {
+				return "", fmt.Errorf("%w: %s: %v", models.ErrInvalidQuery, f.Field, err)
+			}
+			conds = append(conds, fmt.Sprintf("%s <= %s", field.column, b.arg(v)))
+		}
+		if len(conds) == 0 {
+			return "", fmt.Errorf("%w: %s.range needs at least one bound", models.ErrInvalidQuery, f.Field)
+		}
+		return strings.Join(conds, " AND "), nil
+	}
+
+	return "", fmt.Errorf("%w: unknown operator %q", models.ErrInvalidQuery, f.Op)
+}
+
+// metaFilter renders a filter on the metadata key named by a meta.<key>
+// field. Equality goes through the GIN index with a containment test that
+// matches the value as a string and, when it parses as one, as a number or
+// boolean. Ranges compare numerically when both bounds are numbers and as
+// text otherwise.
+func (b *sqlBuilder) metaFilter(f models.DocumentFilter) (string, error) {
+	key := strings.TrimPrefix(f.Field, models.MetaFieldPrefix)
+	if !models.ValidMetaKey(key) {
+		return "", fmt.Errorf("%w: invalid metadata key %q", models.ErrInvalidQuery, key)
+	}
+	if f.Op == "" {
+		f.Op = models.FilterEq
+	}
+
+	switch f.Op {
+	case models.FilterEq, models.FilterIn:
+		if len(f.Values) == 0 || f.Op == models.FilterEq && len(f.Values) != 1 {
+			return "", fmt.Errorf("%w: %s.%s has a wrong number of values", models.ErrInvalidQuery, f.Field, f.Op)
+		}
+		var alternatives []string
+		for _, raw := range f.Values {
+			for _, v := range metaValues(raw) {
+				doc, err := json.Marshal(map[string]interface{}{key: v})
+				if err != nil {
+					return "", err
+				}
+				alternatives = append(alternatives, fmt.Sprintf("d.metadata @> %s::jsonb", b.arg(string(doc))))
+			}
+		}
+		return "(" + strings.Join(alternatives, " OR ") + ")", nil
+
+	case models.FilterPrefix:
+		if len(f.Values) != 1 {
+			return "", fmt.Errorf("%w: %s.prefix expects one value", models.ErrInvalidQuery, f.Field)
+		}
+		return fmt.Sprintf(`d.metadata->>%s LIKE %s ESCAPE '\'`, b.arg(key), b.arg(escapeLike(f.Values[0])+"%")), nil
+
+	case models.FilterRange:
+		if len(f.Values) != 2 || f.Values[0] == "" && f.Values[1] == "" {
+			return "", fmt.Errorf("%w: %s.range needs at least one bound", models.ErrInvalidQuery, f.Field)
+		}
+		numeric := true
+		for _, bound := range f.Values {
+			if _, err := strconv.ParseFloat(bound, 64); bound != "" && err != nil {
+				numeric = false
+			}
+		}
+		column := fmt.Sprintf("(d.metadata->>%s)", b.arg(key))
+		if numeric {
+			column = fmt.Sprintf("CASE WHEN jsonb_typeof(d.metadata->%s) = 'number' THEN (d.metadata->>%s)::numeric END",
+				b.arg(key), b.arg(key))
+		}
+		var conds []string
+		for i, op := range []string{">=", "<="} {
+			if f.Values[i] == "" {
+				continue
+			}
+			var v interface{} = f.Values[i]
+			if numeric {
+				v, _ = strconv.ParseFloat(f.Values[i], 64)
+			}
+			conds = append(conds, fmt.Sprintf("%s %s %s", column, op, b.arg(v)))
+		}
+		return strings.Join(conds, " AND "), nil
+	}
+
+	return "", fmt.Errorf("%w: unknown operator %q", models.ErrInvalidQuery, f.Op)
+}
+
+// metaValues returns the typed values a raw filter value may stand for.
+func metaValues(raw string) []interface{} {
+	values := []interface{}{raw}
+	if n, err := strconv.ParseFloat(raw, 64); err == nil {
+		values = append(values, n)
+	} else if v, err := strconv.ParseBool(raw); err == nil {
+		values = append(values, v)
+	}
+	return values
+}
+
+func effectiveSort(sort []models.SortField) []models.SortField {
+	if len(sort) == 0 {
+		return defaultSort
+	}
+	return sort
+}
+
+// orderBy renders the ORDER BY clause, always ending with the id so that the
+// order is total. reverse flips every direction for backward paging.
+func orderBy(sort []models.SortField, reverse bool) (string, error) {
+	parts := make([]string, 0, len(sort)+1)
+	for _, s := range sort {
+		field, ok := documentFields[s.Field]
+		if !ok || !field.sortable {
+			return "", fmt.Errorf("%w: cannot sort by %q", models.ErrInvalidQuery, s.Field)
+		}
+		parts = append(parts, field.column+" "+direction(s.Desc != reverse))
+	}
+	parts = append(parts, "d.id "+direction(reverse))
+	return strings.Join(parts, ", "), nil
+}
+
+func direction(desc bool) string {
+	if desc {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+// keyset renders the condition selecting rows strictly after k in the given
+// sort order, or strictly before it when backward is set:
+// (a > $1) OR (a = $1 AND b > $2) OR (a = $1 AND b = $2 AND id > $3).
+func (b *sqlBuilder) keyset(sort []models.SortField, k *models.Keyset, backward bool) (string, error) {
+	if len(k.Values) != len(sort) {
+		return "", fmt.Errorf("%w: cursor does not match sort order", models.ErrInvalidQuery)
+	}
+	columns := make([]string, 0, len(sort)+1)
+	descs := make([]bool, 0, len(sort)+1)
+	params := make([]string, 0, len(sort)+1)
+	for i, s := range sort {
+		field := documentFields[s.Field]
+		v, err := parseFieldValue(field, k.Values[i])
+		if err != nil {
+			return "", fmt.Errorf("%w: bad cursor value: %v", models.ErrInvalidQuery, err)
+		}
+		columns = append(columns, field.column)
+		descs = append(descs, s.Desc)
+		params = append(params, b.arg(v))
+	}
+	columns = append(columns, "d.id")
+	descs = append(descs, false)
+	params = append(params, b.arg(k.ID))
+
+	var alternatives []string
+	for i := range columns {
+		var parts []string
+		for j := 0; j < i; j++ {
+			parts = append(parts, fmt.Sprintf("%s = %s", columns[j], params[j]))
+		}
+		op := ">"
+		if descs[i] != backward {
+			op = "<"
+		}
+		parts = append(parts, fmt.Sprintf("%s %s %s", columns[i], op, params[i]))
+		alternatives = append(alternatives, "("+strings.Join(parts, " AND ")+")")
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")", nil
+}
+
+func documentKeyset(doc models.Document, sort []models.SortField) *models.Keyset {
+	k := &models.Keyset{ID: doc.ID, Values: make([]string, len(sort))}
+	for i, s := range sort {
+		switch s.Field {
+		case "name":
+			k.Values[i] = doc.Name
+		case "mime":
+			k.Values[i] = doc.Mime
+		case "public":
+			k.Values[i] = strconv.FormatBool(doc.Public)
+		case "created":
+			k.Values[i] = doc.Created.Format(time.RFC3339Nano)
+		case "owner":
+			k.Values[i] = doc.Owner
+		}
+	}
+	return k
+}
+
+func parseFieldValue(field documentField, raw string) (interface{}, error) {
+	switch field.kind {
+	case boolField:
+		return strconv.ParseBool(raw)
+	case intField:
+		return strconv.Atoi(raw)
+	case tagField:
+		return strings.ToLower(strings.TrimSpace(raw)), nil
+	case timeField:
+		if t, err := time.Parse(time.RFC3339, raw); err == nil {
+			return t, nil
+		}
+		return time.Parse("2006-01-02", raw)
+	}
+	return raw, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func toStrings(values []interface{}) []string {
+	res := make([]string, len(values))
+	for i, v := range values {
+		res[i] = fmt.Sprint(v)
+	}
+	return res
+}
@@ -0,0 +1,211 @@
+package repository
+
+import (
+	"HttpServer/internal/models"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSQLBuilderFilter(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		filter models.DocumentFilter
+		cond   string
+		args   []interface{}
+	}{
+		{
+			name:   "equality",
+			filter: models.DocumentFilter{Field: "name", Values: []string{"report"}},
+			cond:   "d.name = $1",
+			args:   []interface{}{"report"},
+		},
+		{
+			name:   "typed value",
+			filter: models.DocumentFilter{Field: "public", Op: models.FilterEq, Values: []string{"true"}},
+			cond:   `d."public" = $1`,
+			args:   []interface{}{true},
+		},
+		{
+			name:   "prefix escapes wildcards",
+			filter: models.DocumentFilter{Field: "name", Op: models.FilterPrefix, Values: []string{`50%_a\`}},
+			cond:   `d.name LIKE $1 ESCAPE '\'`,
+			args:   []interface{}{`50\%\_a\\%`},
+		},
+		{
+			name:   "in",
+			filter: models.DocumentFilter{Field: "folder", Op: models.FilterIn, Values: []string{"1", "2"}},
+			cond:   "d.folder_id IN ($1, $2)",
+			args:   []interface{}{1, 2},
+		},
+		{
+			name:   "open range",
+			filter: models.DocumentFilter{Field: "created", Op: models.FilterRange, Values: []string{"2024-01-01", ""}},
+			cond:   "d.created >= $1",
+			args:   []interface{}{day},
+		},
+		{
+			name:   "closed range",
+			filter: models.DocumentFilter{Field: "name", Op: models.FilterRange, Values: []string{"a", "m"}},
+			cond:   "d.name >= $1 AND d.name <= $2",
+			args:   []interface{}{"a", "m"},
+		},
+		{
+			name:   "grantee",
+			filter: models.DocumentFilter{Field: "grantee", Values: []string{"bob"}},
+			cond:   "EXISTS (SELECT 1 FROM document_grants g WHERE g.document_id = d.id AND g.login = $1)",
+			args:   []interface{}{"bob"},
+		},
+		{
+			name:   "tag",
+			filter: models.DocumentFilter{Field: "tag", Values: []string{" Invoice "}},
+			cond:   "d.tags @> ARRAY[$1]::text[]",
+			args:   []interface{}{"invoice"},
+		},
+		{
+			name:   "any tag",
+			filter: models.DocumentFilter{Field: "tag", Op: models.FilterIn, Values: []string{"a", "B"}},
+			cond:   "d.tags && $1::text[]",
+			args:   []interface{}{[]string{"a", "b"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b sqlBuilder
+			cond, err := b.filter(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cond != tt.cond {
+				t.Errorf("got %s, want %s", cond, tt.cond)
+			}
+			if !reflect.DeepEqual(b.args, tt.args) {
+				t.Errorf("got args %#v, want %#v", b.args, tt.args)
+			}
+		})
+	}
+}
+
+func TestSQLBuilderFilterRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter models.DocumentFilter
+	}{
+		{"unknown field", models.DocumentFilter{Field: "d.id; DROP TABLE documents5", Values: []string{"1"}}},
+		{"unknown operator", models.DocumentFilter{Field: "name", Op: "like", Values: []string{"a"}}},
+		{"bad value", models.DocumentFilter{Field: "public", Values: []string{"yes please"}}},
+		{"prefix of a non-text field", models.DocumentFilter{Field: "created", Op: models.FilterPrefix, Values: []string{"2024"}}},
+		{"range without bounds", models.DocumentFilter{Field: "name", Op: models.FilterRange, Values: []string{"", ""}}},
+		{"range of a bool", models.DocumentFilter{Field: "public", Op: models.FilterRange, Values: []string{"false", "true"}}},
+		{"empty in", models.DocumentFilter{Field: "name", Op: models.FilterIn}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b sqlBuilder
+			if _, err := b.filter(tt.filter); !errors.Is(err, models.ErrInvalidQuery) {
+				t.Errorf("got error %v, want ErrInvalidQuery", err)
+			}
+		})
+	}
+}
+
+func TestOrderBy(t *testing.T) {
+	sort := []models.SortField{{Field: "name"}, {Field: "created", Desc: true}}
+	got, err := orderBy(sort, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "d.name ASC, d.created DESC, d.id ASC"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if got, _ = orderBy(sort, true); got != "d.name DESC, d.created ASC, d.id DESC" {
+		t.Errorf("reversed order is %s", got)
+	}
+	if _, err := orderBy([]models.SortField{{Field: "folder"}}, false); !errors.Is(err, models.ErrInvalidQuery) {
+		t.Errorf("sorting by folder gave %v, want ErrInvalidQuery", err)
+	}
+}
+
+func TestSQLBuilderMetaFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter models.DocumentFilter
+		cond   string
+		args   []interface{}
+	}{
+		{
+			name:   "text",
+			filter: models.DocumentFilter{Field: "meta.customer", Values: []string{"acme"}},
+			cond:   "(d.metadata @> $1::jsonb)",
+			args:   []interface{}{`{"customer":"acme"}`},
+		},
+		{
+			name:   "number matches as text and number",
+			filter: models.DocumentFilter{Field: "meta.total", Values: []string{"42"}},
+			cond:   "(d.metadata @> $1::jsonb OR d.metadata @> $2::jsonb)",
+			args:   []interface{}{`{"total":"42"}`, `{"total":42}`},
+		},
+		{
+			name:   "boolean",
+			filter: models.DocumentFilter{Field: "meta.paid", Op: models.FilterIn, Values: []string{"true", "x"}},
+			cond:   "(d.metadata @> $1::jsonb OR d.metadata @> $2::jsonb OR d.metadata @> $3::jsonb)",
+			args:   []interface{}{`{"paid":"true"}`, `{"paid":true}`, `{"paid":"x"}`},
+		},
+		{
+			name:   "prefix",
+			filter: models.DocumentFilter{Field: "meta.customer", Op: models.FilterPrefix, Values: []string{"ac_"}},
+			cond:   `d.metadata->>$1 LIKE $2 ESCAPE '\'`,
+			args:   []interface{}{"customer", `ac\_%`},
+		},
+		{
+			name:   "numeric range",
+			filter: models.DocumentFilter{Field: "meta.total", Op: models.FilterRange, Values: []string{"1.5", ""}},
+			cond:   "CASE WHEN jsonb_typeof(d.metadata->$2) = 'number' THEN (d.metadata->>$3)::numeric END >= $4",
+			args:   []interface{}{"total", "total", "total", 1.5},
+		},
+		{
+			name:   "text range",
+			filter: models.DocumentFilter{Field: "meta.code", Op: models.FilterRange, Values: []string{"a", "m"}},
+			cond:   "(d.metadata->>$1) >= $2 AND (d.metadata->>$1) <= $3",
+			args:   []interface{}{"code", "a", "m"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b sqlBuilder
+			cond, err := b.filter(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cond != tt.cond {
+				t.Errorf("got %s, want %s", cond, tt.cond)
+			}
+			if !reflect.DeepEqual(b.args, tt.args) {
+				t.Errorf("got args %#v, want %#v", b.args, tt.args)
+			}
+		})
+	}
+}
+
+func TestSQLBuilderMetaFilterRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter models.DocumentFilter
+	}{
+		{"invalid key", models.DocumentFilter{Field: "meta.a'b", Values: []string{"x"}}},
+		{"empty key", models.DocumentFilter{Field: "meta.", Values: []string{"x"}}},
+		{"two values for eq", models.DocumentFilter{Field: "meta.a", Values: []string{"x", "y"}}},
+		{"range without bounds", models.DocumentFilter{Field: "meta.a", Op: models.FilterRange, Values: []string{"", ""}}},
+		{"unknown operator", models.DocumentFilter{Field: "meta.a", Op: "like", Values: []string{"x"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b sqlBuilder
+			if _, err := b.filter(tt.filter); !errors.Is(err, models.ErrInvalidQuery) {
+				t.Errorf("got error %v, want ErrInvalidQuery", err)
+			}
+		})
+	}
+}
@@ -3,19 +3,87 @@ package repository
 import (
 	"HttpServer/internal/models"
 	"context"
+	"crypto/sha1"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/lib/pq"
 	"github.com/redis/go-redis/v9"
+	"strings"
 	"time"
 )
 
 type DocumentRepository interface {
-	FindDocuments(ctx context.Context, ownerLogin, filterLogin, key, value string, limit int) ([]models.Document, error)
+	FindDocuments(ctx context.Context, ownerLogin, filterLogin string, q models.DocumentQuery) (*models.DocumentPage, error)
 	FindDocumentByID(ctx context.Context, ownerLogin string, ID int) (*models.Document, error)
 	DeleteDoc(ctx context.Context, login string, id int) (bool, error)
-	SaveDocument(ctx context.Context, doc models.Document) error
+	UpdateDocument(ctx context.Context, login string, id int, patch models.DocumentPatch) (*models.Document, error)
+	SaveDocument(ctx context.Context, doc models.Document, v models.DocumentVersion, quota models.Quota) (int, error)
+	SearchDocuments(ctx context.Context, login, text string, limit int) ([]models.SearchResult, error)
+	ListVersions(ctx context.Context, login string, docID int) ([]models.DocumentVersion, error)
+	FindVersion(ctx context.Context, login string, docID, version int) (*models.DocumentVersion, error)
+	FindViewableVersion(ctx context.Context, login string, docID int) (*models.DocumentVersion, error)
+	ListCurrentVersions(ctx context.Context, mimes []string, afterID, limit int) ([]models.DocumentVersion, error)
+	ListAllVersions(ctx context.Context, afterID, afterVersion, limit int) ([]models.DocumentVersion, error)
+	SetVersionChecksum(ctx context.Context, docID, version int, sum string) error
+	FindUnversionedDocuments(ctx context.Context, afterID, limit int) ([]models.Document, error)
+	SaveFirstVersion(ctx context.Context, v models.DocumentVersion) (bool, error)
+	ListPendingScans(ctx context.Context, afterID, afterVersion, limit int) ([]models.DocumentVersion, error)
+	SetScanResult(ctx context.Context, docID, version int, status, result, storageKey string) (bool, error)
+	AddVersion(ctx context.Context, login string, v models.DocumentVersion, content string, maxVersions int, quota models.Quota) (*models.DocumentVersion, []string, error)
+	ListTrash(ctx context.Context, login string) ([]models.Document, error)
+	RestoreDoc(ctx context.Context, login string, id int) (bool, error)
+	EmptyTrash(ctx context.Context, login string) ([]string, error)
+	PurgeTrash(ctx context.Context, deletedBefore time.Time) ([]string, error)
+	FindPublicDocuments(ctx context.Context, q models.DocumentQuery) (*models.DocumentPage, error)
+	FindPublicDocumentByID(ctx context.Context, id int) (*models.PublicDocument, error)
+	FindPublicVersion(ctx context.Context, docID int) (*models.DocumentVersion, error)
+	ListGrants(ctx context.Context, login string, id int) ([]models.Grant, error)
+	AddGrants(ctx context.Context, login string, id int, grants []models.Grant) ([]models.Grant, error)
+	RemoveGrants(ctx context.Context, login string, id int, logins []string) ([]models.Grant, error)
+	TransferOwnership(ctx context.Context, owner string, id int, newOwner string, keep models.Permission) error
+	FindAccess(ctx context.Context, login string, id int) (string, models.Permission, error)
+	Batch(ctx context.Context, login string, req models.BatchRequest, check func(id int) error) (*models.BatchReport, error)
+	FindArchiveItems(ctx context.Context, login string, req models.ArchiveRequest, limit int) ([]models.ArchiveItem, error)
+	ListRetentionRules(ctx context.Context) ([]models.RetentionRule, error)
+	CreateRetentionRule(ctx context.Context, rule models.RetentionRule) (*models.RetentionRule, error)
+	DeleteRetentionRule(ctx context.Context, id int) (bool, error)
+	FindExpiringDocuments(ctx context.Context, before time.Time, limit int) ([]models.Document, error)
+	FindExpiredDocuments(ctx context.Context, notice time.Duration, afterID, limit int) ([]models.Document, error)
+	MarkExpiryNotified(ctx context.Context, ids []int) error
+	SetHold(ctx context.Context, login string, id int, hold models.Hold) (*models.Document, error)
+	ListAudit(ctx context.Context, documentID *int, limit int) ([]models.AuditEntry, error)
+}
+
+const documentColumns = `d.id, d.name, d.mime, d.file, d."public", coalesce(d.owner_login, ''), d.created,
+	ARRAY(SELECT g.login FROM document_grants g WHERE g.document_id = d.id ORDER BY g.login),
+	d.current_version, d.max_versions, d.deleted_at, d.folder_id, d.tags, d.metadata, ` + documentExpiry + `,
+	d.legal_hold, d.immutable_until,
+	coalesce((SELECT v.scan_status FROM document_versions v WHERE v.document_id = d.id AND v.version = d.current_version), '')`
+
+// documentExpiry is when the document of documents5 d expires, taking the
+// retention rules into account.
+const documentExpiry = `document_expiry(d.expires_at, d.created, d.tags, d.folder_id, d.mime)`
+
+// scanDocument scans documentColumns followed by any extra columns.
+func scanDocument(row pgx.Row, doc *models.Document, extra ...interface{}) error {
+	dest := []interface{}{&doc.ID, &doc.Name, &doc.Mime, &doc.File, &doc.Public, &doc.Owner, &doc.Created, &doc.Grant,
+		&doc.Version, &doc.MaxVersions, &doc.DeletedAt, &doc.FolderID, &doc.Tags, &doc.Metadata, &doc.ExpiresAt,
+		&doc.LegalHold, &doc.ImmutableUntil, &doc.ScanStatus}
+	return row.Scan(append(dest, extra...)...)
+}
+
+// publicDocument is the condition for documents of documents5 d that anyone,
+// including anonymous callers, may view and download.
+const publicDocument = `d."public" AND d.deleted_at IS NULL`
+
+// accessibleBy is the condition for documents of documents5 d on which the
+// login bound to param holds at least perm, either as the owner or through a
+// grant. Documents in the trash are never accessible.
+func accessibleBy(param string, perm models.Permission) string {
+	return fmt.Sprintf("document_access_level(d.id, d.owner_login, %s) >= %d AND d.deleted_at IS NULL", param, perm.Level())
 }
 
 type repo struct {
@@ -26,26 +94,83 @@ type repo struct {
 func NewDocumentRepository(db *pgxpool.Pool, redis *redis.Client) DocumentRepository {
 	return &repo{db: db, redis: redis}
 }
-func (r *repo) FindDocuments(ctx context.Context, ownerLogin, filterLogin, key, value string, limit int) ([]models.Document, error) {
-	cacheKey := fmt.Sprintf("documents:%s:%s:%d", ownerLogin, filterLogin, limit)
+func (r *repo) FindDocuments(ctx context.Context, ownerLogin, filterLogin string, q models.DocumentQuery) (*models.DocumentPage, error) {
+	rawQuery, err := json.Marshal(q)
+	if err != nil {
+		return nil, err
+	}
+	cacheKey := fmt.Sprintf("documents:%s:%s:%x", ownerLogin, filterLogin, sha1.Sum(rawQuery))
+
+	cachedPage, err := r.redis.Get(ctx, cacheKey).Result()
+	if err == nil {
+		var page models.DocumentPage
+		if err := json.Unmarshal([]byte(cachedPage), &page); err == nil {
+			return &page, nil
+		}
+	}
+
+	b := &sqlBuilder{}
+	conds := []string{
+		fmt.Sprintf("(d.owner_login = %s OR document_access_level(d.id, d.owner_login, %s) >= %d)",
+			b.arg(ownerLogin), b.arg(filterLogin), models.PermView.Level()),
+		"d.deleted_at IS NULL",
+	}
+	page, err := r.findPage(ctx, b, conds, q)
+	if err != nil {
+		return nil, err
+	}
 
-	cachedDocs, err := r.redis.Get(ctx, cacheKey).Result()
+	data, err := json.Marshal(page)
 	if err == nil {
-		var docs []models.Document
-		if err := json.Unmarshal([]byte(cachedDocs), &docs); err == nil {
-			return docs, nil
+		r.cacheFor(ctx, cacheKey, data, ownerLogin, filterLogin)
+	}
+
+	return page, nil
+}
+
+// FindPublicDocuments lists public documents. The result is not cached as
+// it does not belong to any user whose changes could invalidate it.
+func (r *repo) FindPublicDocuments(ctx context.Context, q models.DocumentQuery) (*models.DocumentPage, error) {
+	return r.findPage(ctx, &sqlBuilder{}, []string{publicDocument}, q)
+}
+
+// findPage returns one page of the documents matching conds, whose arguments
+// are already in b, narrowed down by the filters and the keyset of q.
+func (r *repo) findPage(ctx context.Context, b *sqlBuilder, conds []string, q models.DocumentQuery) (*models.DocumentPage, error) {
+	filterConds, err := b.filters(q.Filters)
+	if err != nil {
+		return nil, err
+	}
+	conds = append(conds, filterConds...)
+	where, filterArgs := strings.Join(conds, " AND "), len(b.args)
+
+	sort := effectiveSort(q.Sort)
+	backward := q.Before != nil
+	keyset := q.After
+	if backward {
+		keyset = q.Before
+	}
+	pageConds := conds
+	if keyset != nil {
+		cond, err := b.keyset(sort, keyset, backward)
+		if err != nil {
+			return nil, err
 		}
+		pageConds = append(pageConds[:len(conds):len(conds)], cond)
+	}
+	order, err := orderBy(sort, backward)
+	if err != nil {
+		return nil, err
 	}
 
 	var docs []models.Document
-	query := `SELECT id, name, mime, file, "public", owner_login, created, grants 
-          FROM documents5 
-          WHERE (owner_login = $1 OR $2 = ANY(grants)) 
-          ORDER BY name, created 
-          LIMIT $3`
-
-	params := []interface{}{ownerLogin, filterLogin, limit}
-	rows, err := r.db.Query(ctx, query, params...)
+	query := fmt.Sprintf(`SELECT %s 
+          FROM documents5 d 
+          WHERE %s 
+          ORDER BY %s 
+          LIMIT %s`, documentColumns, strings.Join(pageConds, " AND "), order, b.arg(q.Limit+1))
+
+	rows, err := r.db.Query(ctx, query, b.args...)
 	if err != nil {
 		return nil, err
 	}
@@ -53,8 +178,7 @@ func (r *repo) FindDocuments(ctx context.Context, ownerLogin, filterLogin, key,
 
 	for rows.Next() {
 		var doc models.Document
-		var doc2 string
-		if err := rows.Scan(&doc.ID, &doc.Name, &doc.Mime, &doc.File, &doc.Public, &doc2, &doc.Created, &doc.Grant); err != nil {
+		if err := scanDocument(rows, &doc); err != nil {
 			return nil, err
 		}
 		docs = append(docs, doc)
@@ -62,12 +186,38 @@ func (r *repo) FindDocuments(ctx context.Context, ownerLogin, filterLogin, key,
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
-	data, err := json.Marshal(docs)
-	if err == nil {
-		r.redis.Set(ctx, cacheKey, data, time.Minute*10)
+
+	hasMore := len(docs) > q.Limit
+	if hasMore {
+		docs = docs[:q.Limit]
+	}
+	if backward {
+		for i, j := 0, len(docs)-1; i < j; i, j = i+1, j-1 {
+			docs[i], docs[j] = docs[j], docs[i]
+		}
+	}
+
+	page := &models.DocumentPage{Docs: docs}
+	if len(docs) > 0 {
+		first, last := docs[0], docs[len(docs)-1]
+		if backward && hasMore || !backward && q.After != nil {
+			page.Prev = documentKeyset(first, sort)
+		}
+		if backward || hasMore {
+			page.Next = documentKeyset(last, sort)
+		}
 	}
 
-	return docs, nil
+	if q.WithTotal {
+		var total int
+		countQuery := fmt.Sprintf(`SELECT count(*) FROM documents5 d WHERE %s`, where)
+		if err := r.db.QueryRow(ctx, countQuery, b.args[:filterArgs]...).Scan(&total); err != nil {
+			return nil, err
+		}
+		page.Total = &total
+	}
+
+	return page, nil
 }
 
 func (r *repo) FindDocumentByID(ctx context.Context, ownerLogin string, ID int) (*models.Document, error) {
@@ -82,29 +232,31 @@ func (r *repo) FindDocumentByID(ctx context.Context, ownerLogin string, ID int)
 	}
 
 	var doc models.Document
-	var doc2 string
 	query := `
-        SELECT id, name, mime, file, "public", owner_login, created, grants
-        FROM documents5
-        WHERE id = $1 AND (owner_login = $2 OR $2 = ANY(grants));
+        SELECT ` + documentColumns + `
+        FROM documents5 d
+        WHERE d.id = $1 AND ` + accessibleBy("$2", models.PermView) + `;
     `
-	err = r.db.QueryRow(ctx, query, ID, ownerLogin).Scan(
-		&doc.ID, &doc.Name, &doc.Mime, &doc.File, &doc.Public, &doc2, &doc.Created, &doc.Grant,
-	)
+	err = scanDocument(r.db.QueryRow(ctx, query, ID, ownerLogin), &doc)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	data, err := json.Marshal(doc)
 	if err == nil {
-		r.redis.Set(ctx, cacheKey, data, time.Minute*10)
+		r.cacheFor(ctx, cacheKey, data, ownerLogin)
 	}
 
 	return &doc, nil
 }
 
+// DeleteDoc moves the document to the trash. It is removed for good by
+// EmptyTrash or PurgeTrash. Held documents cannot be deleted.
 func (r *repo) DeleteDoc(ctx context.Context, login string, id int) (bool, error) {
-	query := `delete from documents5 where (owner_login = $1 OR $1 = ANY(grants)) AND id=$2`
+	query := `UPDATE documents5 d SET deleted_at = now(), deleted_by = $1 WHERE ` + accessibleBy("$1", models.PermDelete) + ` AND NOT ` + heldDocument + ` AND d.id = $2`
 	res, err := r.db.Exec(ctx, query, login, id)
 	rowsAffected := res.RowsAffected()
 	if err != nil {
@@ -112,25 +264,97 @@ func (r *repo) DeleteDoc(ctx context.Context, login string, id int) (bool, error
 	}
 
 	if rowsAffected == 0 {
+		if err := r.changeError(ctx, login, "delete", id, models.PermDelete); errors.Is(err, models.ErrForbidden) || errors.Is(err, models.ErrImmutable) {
+			return false, err
+		}
 		return false, nil
 	}
 
-	r.redis.Del(ctx, fmt.Sprintf("document:%d:%s", id, login))
+	r.invalidateDocument(ctx, id)
 
 	return true, nil
 }
 
-func (r *repo) SaveDocument(ctx context.Context, doc models.Document) error {
+// UpdateDocument applies patch to a document the login may edit, unless it
+// is held.
+func (r *repo) UpdateDocument(ctx context.Context, login string, id int, patch models.DocumentPatch) (*models.Document, error) {
+	var metadata *string
+	if patch.Metadata != nil {
+		data, err := json.Marshal(patch.Metadata)
+		if err != nil {
+			return nil, err
+		}
+		raw := string(data)
+		metadata = &raw
+	}
+	var tags []string
+	if patch.Tags != nil {
+		tags = *patch.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+	}
+
 	query := `
-		INSERT INTO documents5 (name, mime, file, public, created, grant)
-		VALUES ($1, $2, $3, $4, $5, $6)
-	`
-	_, err := r.db.Exec(ctx, query, doc.Name, doc.Mime, doc.File, doc.Public, time.Now(), pq.Array(doc.Grant))
+		UPDATE documents5 d
+		SET name = coalesce($3, d.name),
+		    tags = coalesce($4::text[], d.tags),
+		    metadata = jsonb_strip_nulls(d.metadata || coalesce($5::jsonb, '{}')),
+		    expires_at = CASE WHEN $6 THEN $7 ELSE d.expires_at END,
+		    expiry_notified_at = CASE WHEN $6 THEN NULL ELSE d.expiry_notified_at END
+		WHERE d.id = $1 AND ` + accessibleBy("$2", models.PermEdit) + ` AND NOT ` + heldDocument + `
+		RETURNING ` + documentColumns
+	var doc models.Document
+	err := scanDocument(r.db.QueryRow(ctx, query, id, login, patch.Name, tags, metadata, patch.ExpiresAt.Set, patch.ExpiresAt.Time), &doc)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, r.changeError(ctx, login, "update", id, models.PermEdit)
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return nil, fmt.Errorf("%w: a document with this name already exists", models.ErrConflict)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to save document in database: %w", err)
+		return nil, fmt.Errorf("failed to update document: %w", err)
 	}
 
-	r.redis.FlushDB(ctx)
+	if audience, err := documentAudience(ctx, r.db, id); err == nil {
+		r.invalidateUsers(ctx, audience...)
+	}
+
+	return &doc, nil
+}
+
+// escapeHTML is the SQL expression for expr with the characters that are
+// special in HTML escaped, so that the <mark> tags are the only markup of a
+// headline.
+func escapeHTML(expr string) string {
+	return `replace(replace(replace(replace(` + expr + `, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;')`
+}
 
-	return nil
+func (r *repo) SearchDocuments(ctx context.Context, login, text string, limit int) ([]models.SearchResult, error) {
+	query := `
+		SELECT ` + documentColumns + `,
+		       ts_rank(d.search_vector, q) AS rank,
+		       ts_headline('simple', ` + escapeHTML(`d.name || ' ' || coalesce(d.content_text, '')`) + `, q,
+		                   'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=20, MinWords=5')
+		FROM documents5 d, websearch_to_tsquery('simple', $2) q
+		WHERE d.search_vector @@ q AND ` + accessibleBy("$1", models.PermView) + `
+		ORDER BY rank DESC, d.id
+		LIMIT $3
+	`
+	rows, err := r.db.Query(ctx, query, login, text, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []models.SearchResult
+	for rows.Next() {
+		var res models.SearchResult
+		if err := scanDocument(rows, &res.Document, &res.Rank, &res.Snippet); err != nil {
+			return nil, err
+		}
+		results = append(results, res)
+	}
+	return results, rows.Err()
 }
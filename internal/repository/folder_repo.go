@@ -0,0 +1,393 @@
+package repository
+
+import (
+	"HttpServer/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+)
+
+type FolderRepository interface {
+	CreateFolder(ctx context.Context, login string, f models.Folder) (*models.Folder, error)
+	FindFolder(ctx context.Context, login string, id int) (*models.Folder, error)
+	ListFolders(ctx context.Context, login string, parentID *int) ([]models.Folder, error)
+	UpdateFolder(ctx context.Context, login string, id int, change models.FolderChange) (*models.Folder, error)
+	FindFolderDocuments(ctx context.Context, login string, id int, q models.DocumentQuery) (*models.DocumentPage, error)
+	MoveDocument(ctx context.Context, login string, id int, folderID *int) error
+	ResolvePath(ctx context.Context, login string, names []string) (*models.Folder, *models.Document, error)
+	EnsureFolder(ctx context.Context, login string, parentID *int, name string) (*models.Folder, error)
+	ListFolderGrants(ctx context.Context, login string, id int) ([]models.Grant, error)
+	AddFolderGrants(ctx context.Context, login string, id int, grants []models.Grant) ([]models.Grant, error)
+	RemoveFolderGrants(ctx context.Context, login string, id int, logins []string) ([]models.Grant, error)
+}
+
+func NewFolderRepository(db *pgxpool.Pool, redis *redis.Client) FolderRepository {
+	return &repo{db: db, redis: redis}
+}
+
+const folderColumns = `f.id, f.name, f.parent_id, f.owner_login, f.created`
+
+func scanFolder(row pgx.Row, f *models.Folder) error {
+	return row.Scan(&f.ID, &f.Name, &f.ParentID, &f.Owner, &f.Created)
+}
+
+// inFolder is the condition for rows whose folder column, bound to param
+// together with login, is the given folder, or the top level of login when
+// the folder is NULL.
+func inFolder(column, owner, folder, login string) string {
+	return fmt.Sprintf("%s IS NOT DISTINCT FROM %s::int AND (%s::int IS NOT NULL OR %s = %s)", column, folder, folder, owner, login)
+}
+
+// folderAudience returns the owners of the folder and of its ancestors and
+// every login holding a grant on one of them: everyone whose view of the
+// documents below the folder depends on where it sits.
+func folderAudience(ctx context.Context, q querier, id *int) ([]string, error) {
+	if id == nil {
+		return nil, nil
+	}
+	rows, err := q.Query(ctx, `
+		WITH RECURSIVE chain AS (
+			SELECT f.id, f.parent_id, f.owner_login FROM folders f WHERE f.id = $1
+			UNION ALL
+			SELECT f.id, f.parent_id, f.owner_login FROM folders f JOIN chain c ON f.id = c.parent_id
+		)
+		SELECT owner_login FROM chain
+		UNION
+		SELECT g.login FROM folder_grants g JOIN chain c ON g.folder_id = c.id
+	`, *id)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// documentAudience returns everyone whose view of a document depends on its
+// attributes: its owner and grantees and the audience of its folder.
+func documentAudience(ctx context.Context, q querier, id int) ([]string, error) {
+	rows, err := q.Query(ctx, `
+		WITH RECURSIVE chain AS (
+			SELECT f.id, f.parent_id, f.owner_login FROM folders f JOIN documents5 d ON d.folder_id = f.id WHERE d.id = $1
+			UNION ALL
+			SELECT f.id, f.parent_id, f.owner_login FROM folders f JOIN chain c ON f.id = c.parent_id
+		)
+		SELECT owner_login FROM documents5 WHERE id = $1 AND owner_login IS NOT NULL
+		UNION
+		SELECT login FROM document_grants WHERE document_id = $1
+		UNION
+		SELECT owner_login FROM chain
+		UNION
+		SELECT g.login FROM folder_grants g JOIN chain c ON g.folder_id = c.id
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+func folderNameError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "23505":
+			return fmt.Errorf("%w: a folder with this name already exists", models.ErrInvalidQuery)
+		case "23514":
+			return fmt.Errorf("%w: invalid folder name", models.ErrInvalidQuery)
+		}
+	}
+	return fmt.Errorf("failed to save folder: %w", err)
+}
+
+// CreateFolder creates a folder owned by login, at the top level or inside a
+// folder the login may edit.
+func (r *repo) CreateFolder(ctx context.Context, login string, f models.Folder) (*models.Folder, error) {
+	if f.ParentID != nil {
+		if _, _, err := folderGrants.require(ctx, r.db, login, *f.ParentID, models.PermEdit); err != nil {
+			return nil, err
+		}
+	}
+	query := `
+		INSERT INTO folders (name, parent_id, owner_login)
+		VALUES ($1, $2, $3)
+		RETURNING id, created
+	`
+	if err := r.db.QueryRow(ctx, query, f.Name, f.ParentID, login).Scan(&f.ID, &f.Created); err != nil {
+		return nil, folderNameError(err)
+	}
+	f.Owner = login
+	return &f, nil
+}
+
+// EnsureFolder returns the folder with the given name inside the parent, or
+// at the top level of login, creating it when there is none.
+func (r *repo) EnsureFolder(ctx context.Context, login string, parentID *int, name string) (*models.Folder, error) {
+	query := `SELECT ` + folderColumns + ` FROM folders f WHERE f.name = $3 AND ` + inFolder("f.parent_id", "f.owner_login", "$2", "$1")
+	for attempt := 0; ; attempt++ {
+		var f models.Folder
+		err := scanFolder(r.db.QueryRow(ctx, query, login, parentID, name), &f)
+		if err == nil {
+			return &f, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+		created, err := r.CreateFolder(ctx, login, models.Folder{Name: name, ParentID: parentID})
+		// lost a race against someone creating the same folder
+		if errors.Is(err, models.ErrInvalidQuery) && attempt == 0 {
+			continue
+		}
+		return created, err
+	}
+}
+
+func (r *repo) FindFolder(ctx context.Context, login string, id int) (*models.Folder, error) {
+	if _, _, err := folderGrants.require(ctx, r.db, login, id, models.PermView); err != nil {
+		return nil, err
+	}
+	var f models.Folder
+	err := scanFolder(r.db.QueryRow(ctx, `SELECT `+folderColumns+` FROM folders f WHERE f.id = $1`, id), &f)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// ListFolders lists the subfolders of a folder. Without a parent it lists the
+// top-level folders of login together with the folders shared with it.
+func (r *repo) ListFolders(ctx context.Context, login string, parentID *int) ([]models.Folder, error) {
+	query := `
+		SELECT ` + folderColumns + ` FROM folders f
+		WHERE f.parent_id IS NULL AND f.owner_login = $1
+		   OR EXISTS (SELECT 1 FROM folder_grants g WHERE g.folder_id = f.id AND g.login = $1)
+		ORDER BY f.name, f.id
+	`
+	args := []interface{}{login}
+	if parentID != nil {
+		if _, _, err := folderGrants.require(ctx, r.db, login, *parentID, models.PermView); err != nil {
+			return nil, err
+		}
+		query = `SELECT ` + folderColumns + ` FROM folders f WHERE f.parent_id = $1 ORDER BY f.name, f.id`
+		args = []interface{}{*parentID}
+	}
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	folders := []models.Folder{}
+	for rows.Next() {
+		var f models.Folder
+		if err := scanFolder(rows, &f); err != nil {
+			return nil, err
+		}
+		folders = append(folders, f)
+	}
+	return folders, rows.Err()
+}
+
+// UpdateFolder renames and moves a folder. Renaming needs edit permission on
+// the folder; moving needs delete permission on it and edit permission on
+// the new parent, which must not be the folder itself or below it.
+func (r *repo) UpdateFolder(ctx context.Context, login string, id int, change models.FolderChange) (*models.Folder, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	perm := models.PermEdit
+	if change.ParentID != nil {
+		perm = models.PermDelete
+	}
+	if _, _, err := folderGrants.require(ctx, tx, login, id, perm); err != nil {
+		return nil, err
+	}
+	before, err := folderAudience(ctx, tx, &id)
+	if err != nil {
+		return nil, err
+	}
+
+	if change.Name != nil {
+		if _, err := tx.Exec(ctx, `UPDATE folders SET name = $2 WHERE id = $1`, id, *change.Name); err != nil {
+			return nil, folderNameError(err)
+		}
+	}
+	if change.ParentID != nil {
+		var parent *int
+		if *change.ParentID != 0 {
+			parent = change.ParentID
+			if _, _, err := folderGrants.require(ctx, tx, login, *parent, models.PermEdit); err != nil {
+				return nil, err
+			}
+			var cycle bool
+			err := tx.QueryRow(ctx, `
+				WITH RECURSIVE chain AS (
+					SELECT f.id, f.parent_id FROM folders f WHERE f.id = $1
+					UNION ALL
+					SELECT f.id, f.parent_id FROM folders f JOIN chain c ON f.id = c.parent_id
+				)
+				SELECT EXISTS (SELECT 1 FROM chain WHERE id = $2)
+			`, *parent, id).Scan(&cycle)
+			if err != nil {
+				return nil, err
+			}
+			if cycle {
+				return nil, fmt.Errorf("%w: cannot move a folder into itself", models.ErrInvalidQuery)
+			}
+		}
+		if _, err := tx.Exec(ctx, `UPDATE folders SET parent_id = $2 WHERE id = $1`, id, parent); err != nil {
+			return nil, folderNameError(err)
+		}
+	}
+
+	after, err := folderAudience(ctx, tx, &id)
+	if err != nil {
+		return nil, err
+	}
+	var f models.Folder
+	if err := scanFolder(tx.QueryRow(ctx, `SELECT `+folderColumns+` FROM folders f WHERE f.id = $1`, id), &f); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	r.invalidateUsers(ctx, append(before, after...)...)
+
+	return &f, nil
+}
+
+// FindFolderDocuments returns one page of the documents in a folder that
+// login may view.
+func (r *repo) FindFolderDocuments(ctx context.Context, login string, id int, q models.DocumentQuery) (*models.DocumentPage, error) {
+	if _, _, err := folderGrants.require(ctx, r.db, login, id, models.PermView); err != nil {
+		return nil, err
+	}
+	b := &sqlBuilder{}
+	conds := []string{
+		"d.folder_id = " + b.arg(id),
+		accessibleBy(b.arg(login), models.PermView),
+	}
+	return r.findPage(ctx, b, conds, q)
+}
+
+// MoveDocument puts a document into a folder, or back to the top level when
+// folderID is nil. Only the owner of the document may move it, and only
+// into a folder it may edit; grantees would otherwise hand the document to
+// whoever can see their own folders.
+func (r *repo) MoveDocument(ctx context.Context, login string, id int, folderID *int) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	owner, _, err := requireAccess(ctx, tx, login, id, models.PermOwner)
+	if err != nil {
+		return err
+	}
+	if folderID != nil {
+		if _, _, err := folderGrants.require(ctx, tx, login, *folderID, models.PermEdit); err != nil {
+			return err
+		}
+	}
+	var current *int
+	if err := tx.QueryRow(ctx, `SELECT folder_id FROM documents5 WHERE id = $1`, id).Scan(&current); err != nil {
+		return err
+	}
+	before, err := folderAudience(ctx, tx, current)
+	if err != nil {
+		return err
+	}
+	after, err := folderAudience(ctx, tx, folderID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE documents5 SET folder_id = $2 WHERE id = $1`, id, folderID); err != nil {
+		return fmt.Errorf("failed to move document: %w", err)
+	}
+	grants, err := documentGrants.list(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	affected := append(append([]string{owner, login}, before...), after...)
+	for _, g := range grants {
+		affected = append(affected, g.Login)
+	}
+	r.invalidateUsers(ctx, affected...)
+
+	return nil
+}
+
+// ResolvePath walks names from the top level of login down the folder tree.
+// The last name is looked up as a document first and as a folder otherwise;
+// of several documents with that name the newest wins.
+func (r *repo) ResolvePath(ctx context.Context, login string, names []string) (*models.Folder, *models.Document, error) {
+	if len(names) == 0 {
+		return nil, nil, models.ErrNotFound
+	}
+	folderQuery := `SELECT ` + folderColumns + ` FROM folders f WHERE f.name = $3 AND ` + inFolder("f.parent_id", "f.owner_login", "$2", "$1")
+
+	var parent *int
+	for _, name := range names[:len(names)-1] {
+		var f models.Folder
+		err := scanFolder(r.db.QueryRow(ctx, folderQuery, login, parent, name), &f)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, models.ErrNotFound
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		parent = &f.ID
+	}
+	name := names[len(names)-1]
+
+	docQuery := `
+		SELECT ` + documentColumns + ` FROM documents5 d
+		WHERE d.name = $3 AND ` + inFolder("d.folder_id", "d.owner_login", "$2", "$1") + `
+		  AND ` + accessibleBy("$1", models.PermView) + `
+		ORDER BY d.created DESC, d.id DESC
+		LIMIT 1
+	`
+	var doc models.Document
+	err := scanDocument(r.db.QueryRow(ctx, docQuery, login, parent, name), &doc)
+	if err == nil {
+		return nil, &doc, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, err
+	}
+
+	var f models.Folder
+	err = scanFolder(r.db.QueryRow(ctx, folderQuery, login, parent, name), &f)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return &f, nil, nil
+}
+
+func (r *repo) ListFolderGrants(ctx context.Context, login string, id int) ([]models.Grant, error) {
+	return r.listGrants(ctx, folderGrants, login, id)
+}
+
+func (r *repo) AddFolderGrants(ctx context.Context, login string, id int, grants []models.Grant) ([]models.Grant, error) {
+	return r.addGrants(ctx, folderGrants, login, id, grants)
+}
+
+func (r *repo) RemoveFolderGrants(ctx context.Context, login string, id int, logins []string) ([]models.Grant, error) {
+	return r.removeGrants(ctx, folderGrants, login, id, logins)
+}
@@ -0,0 +1,214 @@
+package repository
+
+import (
+	"HttpServer/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+	"os"
+	"testing"
+	"time"
+)
+
+// testRepo connects to the migrated database named by TEST_PG_DSN and skips
+// the test when it is not set. Cache invalidation goes to TEST_REDIS_ADDR;
+// without a Redis there it fails quietly, as it does in production.
+func testRepo(t *testing.T) *repo {
+	t.Helper()
+	dsn := os.Getenv("TEST_PG_DSN")
+	if dsn == "" {
+		t.Skip("TEST_PG_DSN is not set")
+	}
+	db, err := pgxpool.New(context.Background(), dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+	addr := os.Getenv("TEST_REDIS_ADDR")
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: addr, MaxRetries: -1})
+	t.Cleanup(func() { rdb.Close() })
+	return &repo{db: db, redis: rdb}
+}
+
+// testLogins returns logins that no other test run uses.
+func testLogins(names ...string) map[string]string {
+	suffix := time.Now().UnixNano()
+	logins := make(map[string]string, len(names))
+	for _, name := range names {
+		logins[name] = fmt.Sprintf("%s-%d", name, suffix)
+	}
+	return logins
+}
+
+func testDocument(t *testing.T, r *repo, owner string, folderID *int) int {
+	t.Helper()
+	doc := models.Document{Name: "report.pdf", Mime: "application/pdf", Owner: owner, FolderID: folderID}
+	v := models.DocumentVersion{Filename: "report.pdf", Mime: "application/pdf", ScanStatus: models.ScanPending,
+		StorageKey: fmt.Sprintf("test/%s/%d", owner, time.Now().UnixNano()), CreatedBy: owner}
+	id, err := r.SaveDocument(context.Background(), doc, v, models.Quota{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func testFolder(t *testing.T, r *repo, owner, name string, parentID *int) *models.Folder {
+	t.Helper()
+	f, err := r.CreateFolder(context.Background(), owner, models.Folder{Name: name, ParentID: parentID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestAccessLevels(t *testing.T) {
+	r := testRepo(t)
+	ctx := context.Background()
+	u := testLogins("owner", "viewer", "editor", "reader", "stranger")
+
+	parent := testFolder(t, r, u["owner"], "parent", nil)
+	child := testFolder(t, r, u["owner"], "child", &parent.ID)
+	doc := testDocument(t, r, u["owner"], &child.ID)
+
+	if _, err := r.AddGrants(ctx, u["owner"], doc, []models.Grant{
+		{Login: u["viewer"], Permission: models.PermView},
+		{Login: u["editor"], Permission: models.PermEdit},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// a grant on the parent folder reaches the document two levels down
+	if _, err := r.AddFolderGrants(ctx, u["owner"], parent.ID, []models.Grant{
+		{Login: u["reader"], Permission: models.PermDownload},
+		{Login: u["viewer"], Permission: models.PermShare},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		login  string
+		folder models.Permission
+		doc    models.Permission
+		err    error
+	}{
+		{login: u["owner"], folder: models.PermOwner, doc: models.PermOwner},
+		{login: u["viewer"], folder: models.PermShare, doc: models.PermShare},
+		{login: u["editor"], folder: "", doc: models.PermEdit},
+		{login: u["reader"], folder: models.PermDownload, doc: models.PermDownload},
+		{login: u["stranger"], folder: "", err: models.ErrNotFound},
+	}
+	for _, tt := range tests {
+		_, perm, err := folderAccessLevel(ctx, r.db, tt.login, child.ID)
+		if err != nil {
+			t.Fatalf("%s: folder access: %v", tt.login, err)
+		}
+		if perm != tt.folder {
+			t.Errorf("%s: folder permission %q, want %q", tt.login, perm, tt.folder)
+		}
+		owner, perm, err := r.FindAccess(ctx, tt.login, doc)
+		if !errors.Is(err, tt.err) {
+			t.Fatalf("%s: document access error %v, want %v", tt.login, err, tt.err)
+		}
+		if err != nil {
+			continue
+		}
+		if owner != u["owner"] || perm != tt.doc {
+			t.Errorf("%s: document owner %q permission %q, want %q %q", tt.login, owner, perm, u["owner"], tt.doc)
+		}
+	}
+}
+
+func TestGrantLevels(t *testing.T) {
+	r := testRepo(t)
+	ctx := context.Background()
+	u := testLogins("owner", "sharer", "editor", "other")
+	doc := testDocument(t, r, u["owner"], nil)
+
+	if _, err := r.AddGrants(ctx, u["owner"], doc, []models.Grant{
+		{Login: u["sharer"], Permission: models.PermShare},
+		{Login: u["editor"], Permission: models.PermEdit},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		login string
+		grant models.Grant
+		err   error
+	}{
+		{name: "editor cannot share", login: u["editor"], grant: models.Grant{Login: u["other"], Permission: models.PermView}, err: models.ErrForbidden},
+		{name: "sharer cannot grant above its level", login: u["sharer"], grant: models.Grant{Login: u["other"], Permission: models.PermDelete}, err: models.ErrForbidden},
+		{name: "nobody grants ownership", login: u["owner"], grant: models.Grant{Login: u["other"], Permission: models.PermOwner}, err: models.ErrInvalidQuery},
+		{name: "sharer grants up to its level", login: u["sharer"], grant: models.Grant{Login: u["other"], Permission: models.PermShare}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := r.AddGrants(ctx, tt.login, doc, []models.Grant{tt.grant})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestMoveDocument(t *testing.T) {
+	r := testRepo(t)
+	ctx := context.Background()
+	u := testLogins("owner", "editor", "stranger")
+
+	shared := testFolder(t, r, u["owner"], "shared", nil)
+	own := testFolder(t, r, u["editor"], "mine", nil)
+	foreign := testFolder(t, r, u["stranger"], "theirs", nil)
+	viewOnly := testFolder(t, r, u["stranger"], "readable", nil)
+	if _, err := r.AddFolderGrants(ctx, u["stranger"], viewOnly.ID, []models.Grant{
+		{Login: u["owner"], Permission: models.PermView},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	doc := testDocument(t, r, u["owner"], &shared.ID)
+	if _, err := r.AddGrants(ctx, u["owner"], doc, []models.Grant{
+		{Login: u["editor"], Permission: models.PermEdit},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		login  string
+		folder *int
+		err    error
+	}{
+		{name: "edit grantee into its own folder", login: u["editor"], folder: &own.ID, err: models.ErrForbidden},
+		{name: "edit grantee to the top level", login: u["editor"], folder: nil, err: models.ErrForbidden},
+		{name: "stranger", login: u["stranger"], folder: &foreign.ID, err: models.ErrNotFound},
+		{name: "owner into an invisible folder", login: u["owner"], folder: &foreign.ID, err: models.ErrNotFound},
+		{name: "owner into a view-only folder", login: u["owner"], folder: &viewOnly.ID, err: models.ErrForbidden},
+		{name: "owner to the top level", login: u["owner"], folder: nil},
+		{name: "owner back into its folder", login: u["owner"], folder: &shared.ID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := r.MoveDocument(ctx, tt.login, doc, tt.folder)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error %v, want %v", err, tt.err)
+			}
+			var folderID *int
+			if err := r.db.QueryRow(ctx, `SELECT folder_id FROM documents5 WHERE id = $1`, doc).Scan(&folderID); err != nil {
+				t.Fatal(err)
+			}
+			want := &shared.ID
+			if tt.err == nil {
+				want = tt.folder
+			}
+			if (folderID == nil) != (want == nil) || folderID != nil && *folderID != *want {
+				t.Errorf("document is in folder %v, want %v", folderID, want)
+			}
+		})
+	}
+}
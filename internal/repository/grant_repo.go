@@ -0,0 +1,290 @@
+package repository
+
+import (
+	"HttpServer/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// grantScope describes the grants of one kind of object: the table they are
+// stored in and how the access of a login to such an object is determined.
+type grantScope struct {
+	kind   string
+	table  string
+	column string
+	access func(ctx context.Context, q querier, login string, id int) (string, models.Permission, error)
+}
+
+var (
+	documentGrants = grantScope{kind: "document", table: "document_grants", column: "document_id", access: accessLevel}
+	folderGrants   = grantScope{kind: "folder", table: "folder_grants", column: "folder_id", access: folderAccessLevel}
+)
+
+// accessLevel returns the owner of a live document and the permission the
+// login holds on it. A missing document yields ErrNotFound. Inside a
+// transaction the document row is locked.
+func accessLevel(ctx context.Context, q querier, login string, id int) (string, models.Permission, error) {
+	query := `
+		SELECT coalesce(d.owner_login, ''), document_access_level(d.id, d.owner_login, $2)
+		FROM documents5 d
+		WHERE d.id = $1 AND d.deleted_at IS NULL
+	`
+	return scanAccess(ctx, q, query, login, id)
+}
+
+// folderAccessLevel is accessLevel for folders. Grants and ownership of
+// parent folders count for the folder.
+func folderAccessLevel(ctx context.Context, q querier, login string, id int) (string, models.Permission, error) {
+	query := `SELECT f.owner_login, folder_access_level(f.id, $2) FROM folders f WHERE f.id = $1`
+	return scanAccess(ctx, q, query, login, id)
+}
+
+func scanAccess(ctx context.Context, q querier, query, login string, id int) (string, models.Permission, error) {
+	if _, ok := q.(pgx.Tx); ok {
+		query += " FOR UPDATE"
+	}
+	var owner string
+	var level int
+	err := q.QueryRow(ctx, query, id, login).Scan(&owner, &level)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", "", models.ErrNotFound
+	}
+	if err != nil {
+		return "", "", err
+	}
+	return owner, models.PermissionFromLevel(level), nil
+}
+
+// require fails with ErrNotFound when the login cannot see the object at
+// all and with ErrForbidden when it can but lacks perm.
+func (s grantScope) require(ctx context.Context, q querier, login string, id int, perm models.Permission) (string, models.Permission, error) {
+	owner, held, err := s.access(ctx, q, login, id)
+	if err != nil {
+		return "", "", err
+	}
+	if held.Level() < models.PermView.Level() {
+		return "", "", models.ErrNotFound
+	}
+	if held.Level() < perm.Level() {
+		return "", "", fmt.Errorf("%w: %s permission required", models.ErrForbidden, perm)
+	}
+	return owner, held, nil
+}
+
+// requireAccess is require for documents.
+func requireAccess(ctx context.Context, q querier, login string, id int, perm models.Permission) (string, models.Permission, error) {
+	return documentGrants.require(ctx, q, login, id, perm)
+}
+
+// accessError explains why an operation that needs perm matched no
+// document. When the login actually holds perm the document exists but
+// whatever else was looked up does not, so ErrNotFound is returned.
+func (r *repo) accessError(ctx context.Context, login string, id int, perm models.Permission) error {
+	if _, _, err := requireAccess(ctx, r.db, login, id, perm); err != nil {
+		return err
+	}
+	return models.ErrNotFound
+}
+
+// FindAccess returns the owner of a document and the permission the login
+// holds on it. It fails with ErrNotFound if the login cannot see it.
+func (r *repo) FindAccess(ctx context.Context, login string, id int) (string, models.Permission, error) {
+	return requireAccess(ctx, r.db, login, id, models.PermView)
+}
+
+func (s grantScope) list(ctx context.Context, q querier, id int) ([]models.Grant, error) {
+	query := fmt.Sprintf(`SELECT login, level FROM %s WHERE %s = $1 ORDER BY login`, s.table, s.column)
+	rows, err := q.Query(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	grants := []models.Grant{}
+	for rows.Next() {
+		var g models.Grant
+		var level int
+		if err := rows.Scan(&g.Login, &level); err != nil {
+			return nil, err
+		}
+		g.Permission = models.PermissionFromLevel(level)
+		grants = append(grants, g)
+	}
+	return grants, rows.Err()
+}
+
+func (r *repo) ListGrants(ctx context.Context, login string, id int) ([]models.Grant, error) {
+	return r.listGrants(ctx, documentGrants, login, id)
+}
+
+func (r *repo) AddGrants(ctx context.Context, login string, id int, grants []models.Grant) ([]models.Grant, error) {
+	return r.addGrants(ctx, documentGrants, login, id, grants)
+}
+
+// RemoveGrants revokes grants on a document that is not held.
+func (r *repo) RemoveGrants(ctx context.Context, login string, id int, logins []string) ([]models.Grant, error) {
+	change := r.mutableChange(ctx, login, "remove_grants", id, removeGrantsChange(ctx, documentGrants, id, logins))
+	return r.changeGrants(ctx, documentGrants, login, id, change)
+}
+
+func (r *repo) listGrants(ctx context.Context, s grantScope, login string, id int) ([]models.Grant, error) {
+	if _, _, err := s.require(ctx, r.db, login, id, models.PermShare); err != nil {
+		return nil, err
+	}
+	return s.list(ctx, r.db, id)
+}
+
+// addGrants creates or changes grants. The caller needs share permission and
+// can neither hand out nor change a grant above its own level.
+func (r *repo) addGrants(ctx context.Context, s grantScope, login string, id int, grants []models.Grant) ([]models.Grant, error) {
+	return r.changeGrants(ctx, s, login, id, addGrantsChange(ctx, s, login, id, grants))
+}
+
+// removeGrants revokes grants. The caller needs share permission and cannot
+// revoke a grant above its own level.
+func (r *repo) removeGrants(ctx context.Context, s grantScope, login string, id int, logins []string) ([]models.Grant, error) {
+	return r.changeGrants(ctx, s, login, id, removeGrantsChange(ctx, s, id, logins))
+}
+
+type grantChange func(tx pgx.Tx, owner string, held models.Permission) error
+
+func addGrantsChange(ctx context.Context, s grantScope, login string, id int, grants []models.Grant) grantChange {
+	return func(tx pgx.Tx, owner string, held models.Permission) error {
+		for _, g := range grants {
+			if g.Login == owner {
+				return fmt.Errorf("%w: %s owns the %s", models.ErrInvalidQuery, g.Login, s.kind)
+			}
+			if !g.Permission.Valid() || g.Permission == models.PermOwner {
+				return fmt.Errorf("%w: invalid permission %q", models.ErrInvalidQuery, g.Permission)
+			}
+			if g.Permission.Level() > held.Level() {
+				return fmt.Errorf("%w: cannot grant %s", models.ErrForbidden, g.Permission)
+			}
+			var current int
+			query := fmt.Sprintf(`SELECT coalesce(max(level), 0) FROM %s WHERE %s = $1 AND login = $2`, s.table, s.column)
+			if err := tx.QueryRow(ctx, query, id, g.Login).Scan(&current); err != nil {
+				return err
+			}
+			if current > held.Level() {
+				return fmt.Errorf("%w: cannot change the grant of %s", models.ErrForbidden, g.Login)
+			}
+			query = fmt.Sprintf(`
+				INSERT INTO %[1]s (%[2]s, login, level, granted_by)
+				VALUES ($1, $2, $3, $4)
+				ON CONFLICT (%[2]s, login) DO UPDATE SET level = EXCLUDED.level, granted_by = EXCLUDED.granted_by
+			`, s.table, s.column)
+			if _, err := tx.Exec(ctx, query, id, g.Login, g.Permission.Level(), login); err != nil {
+				return fmt.Errorf("failed to save grant: %w", err)
+			}
+		}
+		return nil
+	}
+}
+
+func removeGrantsChange(ctx context.Context, s grantScope, id int, logins []string) grantChange {
+	return func(tx pgx.Tx, owner string, held models.Permission) error {
+		var above bool
+		query := fmt.Sprintf(`
+			WITH gone AS (DELETE FROM %s WHERE %s = $1 AND login = ANY($2) RETURNING level)
+			SELECT coalesce(bool_or(level > $3), false) FROM gone
+		`, s.table, s.column)
+		if err := tx.QueryRow(ctx, query, id, logins, held.Level()).Scan(&above); err != nil {
+			return fmt.Errorf("failed to remove grants: %w", err)
+		}
+		if above {
+			return fmt.Errorf("%w: cannot revoke a grant above your own", models.ErrForbidden)
+		}
+		return nil
+	}
+}
+
+// changeGrants runs change in a transaction after checking that the login
+// may share the object, then invalidates the cached views of the owner and
+// of every login that held or now holds a grant.
+func (r *repo) changeGrants(ctx context.Context, s grantScope, login string, id int, change grantChange) ([]models.Grant, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	after, affected, err := changeGrantsTx(ctx, tx, s, login, id, change)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	r.invalidateUsers(ctx, affected...)
+
+	return after, nil
+}
+
+// changeGrantsTx is changeGrants inside the caller's transaction. It returns
+// the resulting grants and the logins whose cached views must be dropped
+// once the transaction commits.
+func changeGrantsTx(ctx context.Context, tx pgx.Tx, s grantScope, login string, id int, change grantChange) ([]models.Grant, []string, error) {
+	owner, held, err := s.require(ctx, tx, login, id, models.PermShare)
+	if err != nil {
+		return nil, nil, err
+	}
+	before, err := s.list(ctx, tx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := change(tx, owner, held); err != nil {
+		return nil, nil, err
+	}
+	after, err := s.list(ctx, tx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	affected := []string{owner, login}
+	for _, g := range append(before, after...) {
+		affected = append(affected, g.Login)
+	}
+	return after, affected, nil
+}
+
+// TransferOwnership replaces the owner of a document. A grant the new owner
+// held is dropped, and the previous owner gets a grant of level keep unless
+// keep is empty. Held documents keep their owner.
+func (r *repo) TransferOwnership(ctx context.Context, owner string, id int, newOwner string, keep models.Permission) error {
+	_, err := r.changeGrants(ctx, documentGrants, owner, id, r.mutableChange(ctx, owner, "transfer", id, func(tx pgx.Tx, current string, held models.Permission) error {
+		if held != models.PermOwner {
+			return fmt.Errorf("%w: only the owner can transfer a document", models.ErrForbidden)
+		}
+		if _, err := tx.Exec(ctx, `UPDATE documents5 SET owner_login = $2 WHERE id = $1`, id, newOwner); err != nil {
+			return fmt.Errorf("failed to change owner: %w", err)
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM document_grants WHERE document_id = $1 AND login = $2`, id, newOwner); err != nil {
+			return fmt.Errorf("failed to change owner: %w", err)
+		}
+		if keep == "" {
+			return nil
+		}
+		_, err := tx.Exec(ctx, `
+			INSERT INTO document_grants (document_id, login, level, granted_by)
+			VALUES ($1, $2, $3, $2)
+		`, id, owner, keep.Level())
+		if err != nil {
+			return fmt.Errorf("failed to keep access: %w", err)
+		}
+		return nil
+	}))
+	if err == nil {
+		r.invalidateUsers(ctx, newOwner)
+	}
+	return err
+}
@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"HttpServer/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"log"
+	"strings"
+	"time"
+)
+
+// heldDocument is the condition for documents of documents5 d that are
+// under legal hold or still immutable. They can be neither deleted nor
+// changed, and their versions and grants stay as they are.
+const heldDocument = `(d.legal_hold OR d.immutable_until > now())`
+
+func holdError(legalHold bool, immutableUntil *time.Time) error {
+	if legalHold {
+		return fmt.Errorf("%w: under legal hold", models.ErrImmutable)
+	}
+	return fmt.Errorf("%w: immutable until %s", models.ErrImmutable, immutableUntil.UTC().Format(time.RFC3339))
+}
+
+// requireMutable fails with ErrImmutable when document id is held, after
+// recording the attempt of login to perform action on it. The record is
+// written outside of q, so it is kept when the caller rolls back.
+func (r *repo) requireMutable(ctx context.Context, q querier, login, action string, id int) error {
+	var legalHold, held bool
+	var immutableUntil *time.Time
+	err := q.QueryRow(ctx, `
+		SELECT d.legal_hold, d.immutable_until, `+heldDocument+` FROM documents5 d WHERE d.id = $1
+	`, id).Scan(&legalHold, &immutableUntil, &held)
+	if errors.Is(err, pgx.ErrNoRows) || err == nil && !held {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	herr := holdError(legalHold, immutableUntil)
+	entry := models.AuditEntry{Login: login, Action: action, DocumentID: &id, Outcome: models.AuditDenied, Detail: herr.Error()}
+	if err := audit(context.WithoutCancel(ctx), r.db, entry); err != nil {
+		log.Printf("failed to audit %s of document %d by %s: %v", action, id, login, err)
+	}
+	return herr
+}
+
+// changeError is accessError for operations that also fail on held
+// documents.
+func (r *repo) changeError(ctx context.Context, login, action string, id int, perm models.Permission) error {
+	if _, _, err := requireAccess(ctx, r.db, login, id, perm); err != nil {
+		return err
+	}
+	if err := r.requireMutable(ctx, r.db, login, action, id); err != nil {
+		return err
+	}
+	return models.ErrNotFound
+}
+
+// mutableChange makes change fail on held documents.
+func (r *repo) mutableChange(ctx context.Context, login, action string, id int, change grantChange) grantChange {
+	return func(tx pgx.Tx, owner string, held models.Permission) error {
+		if err := r.requireMutable(ctx, tx, login, action, id); err != nil {
+			return err
+		}
+		return change(tx, owner, held)
+	}
+}
+
+func audit(ctx context.Context, q querier, e models.AuditEntry) error {
+	_, err := q.Exec(ctx, `
+		INSERT INTO audit_log (login, action, document_id, outcome, detail) VALUES ($1, $2, $3, $4, $5)
+	`, e.Login, e.Action, e.DocumentID, e.Outcome, e.Detail)
+	return err
+}
+
+// SetHold changes the protection of a document, whether or not it is in the
+// trash. An immutability period that has not ended yet cannot be shortened.
+func (r *repo) SetHold(ctx context.Context, login string, id int, hold models.Hold) (*models.Document, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var immutableUntil *time.Time
+	err = tx.QueryRow(ctx, `SELECT immutable_until FROM documents5 WHERE id = $1 FOR UPDATE`, id).Scan(&immutableUntil)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if hold.ImmutableUntil != nil && immutableUntil != nil && immutableUntil.After(time.Now()) && hold.ImmutableUntil.Before(*immutableUntil) {
+		herr := fmt.Errorf("%w: immutable until %s, which cannot be shortened", models.ErrImmutable, immutableUntil.UTC().Format(time.RFC3339))
+		entry := models.AuditEntry{Login: login, Action: "hold", DocumentID: &id, Outcome: models.AuditDenied, Detail: herr.Error()}
+		if err := audit(ctx, r.db, entry); err != nil {
+			log.Printf("failed to audit hold of document %d by %s: %v", id, login, err)
+		}
+		return nil, herr
+	}
+
+	query := `
+		UPDATE documents5 d
+		SET legal_hold = coalesce($2, d.legal_hold), immutable_until = coalesce($3, d.immutable_until)
+		WHERE d.id = $1
+		RETURNING ` + documentColumns
+	var doc models.Document
+	if err := scanDocument(tx.QueryRow(ctx, query, id, hold.LegalHold, hold.ImmutableUntil), &doc); err != nil {
+		return nil, fmt.Errorf("failed to set hold: %w", err)
+	}
+	entry := models.AuditEntry{Login: login, Action: "hold", DocumentID: &id, Outcome: models.AuditOK, Detail: holdDetail(hold)}
+	if err := audit(ctx, tx, entry); err != nil {
+		return nil, fmt.Errorf("failed to audit hold: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	r.invalidateDocument(ctx, id)
+
+	return &doc, nil
+}
+
+func holdDetail(hold models.Hold) string {
+	var parts []string
+	if hold.LegalHold != nil {
+		parts = append(parts, fmt.Sprintf("legal_hold=%t", *hold.LegalHold))
+	}
+	if hold.ImmutableUntil != nil {
+		parts = append(parts, "immutable_until="+hold.ImmutableUntil.UTC().Format(time.RFC3339))
+	}
+	return strings.Join(parts, " ")
+}
+
+// ListAudit returns the latest audit entries, of one document if documentID
+// is set.
+func (r *repo) ListAudit(ctx context.Context, documentID *int, limit int) ([]models.AuditEntry, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, login, action, document_id, outcome, detail, created
+		FROM audit_log
+		WHERE $1::int IS NULL OR document_id = $1
+		ORDER BY id DESC
+		LIMIT $2
+	`, documentID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var e models.AuditEntry
+		if err := rows.Scan(&e.ID, &e.Login, &e.Action, &e.DocumentID, &e.Outcome, &e.Detail, &e.Created); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
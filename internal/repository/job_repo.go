@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"HttpServer/internal/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// jobTTL is how long the state of a job can be polled after its last
+// update.
+const jobTTL = 24 * time.Hour
+
+type JobRepository interface {
+	SaveJob(ctx context.Context, job *models.Job) error
+	FindJob(ctx context.Context, id string) (*models.Job, error)
+}
+
+type jobrepo struct {
+	redis *redis.Client
+}
+
+func NewJobRepository(redis *redis.Client) JobRepository {
+	return &jobrepo{redis: redis}
+}
+
+func jobKey(id string) string {
+	return fmt.Sprintf("job:%s", id)
+}
+
+func (j *jobrepo) SaveJob(ctx context.Context, job *models.Job) error {
+	job.Updated = time.Now()
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return j.redis.Set(ctx, jobKey(job.ID), data, jobTTL).Err()
+}
+
+func (j *jobrepo) FindJob(ctx context.Context, id string) (*models.Job, error) {
+	data, err := j.redis.Get(ctx, jobKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var job models.Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
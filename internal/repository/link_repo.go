@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"HttpServer/internal/models"
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type LinkRepository interface {
+	CreateLink(ctx context.Context, login string, link models.ShareLink, tokenHash string) (*models.ShareLink, error)
+	ListLinks(ctx context.Context, login string, docID int) ([]models.ShareLink, error)
+	RevokeLink(ctx context.Context, login string, docID, linkID int) (bool, error)
+	FindLink(ctx context.Context, tokenHash string, docID int) (*models.ShareLink, error)
+	UseLink(ctx context.Context, linkID int) (*models.DocumentVersion, error)
+	DenyLink(ctx context.Context, linkID int) error
+}
+
+type linkrepo struct {
+	db *pgxpool.Pool
+}
+
+func NewLinkRepository(db *pgxpool.Pool) LinkRepository {
+	return &linkrepo{db: db}
+}
+
+const linkColumns = `l.id, l.document_id, l.created_by, l.created, l.expires_at, l.max_downloads, l.downloads, l.denied,
+	l.last_access, coalesce(l.password_hash, ''), l.revoked_at`
+
+func scanLink(row pgx.Row, l *models.ShareLink) error {
+	err := row.Scan(&l.ID, &l.DocumentID, &l.CreatedBy, &l.Created, &l.ExpiresAt, &l.MaxDownloads, &l.Downloads, &l.Denied,
+		&l.LastAccess, &l.PasswordHash, &l.RevokedAt)
+	l.HasPassword = l.PasswordHash != ""
+	return err
+}
+
+func (lr *linkrepo) CreateLink(ctx context.Context, login string, link models.ShareLink, tokenHash string) (*models.ShareLink, error) {
+	if _, _, err := requireAccess(ctx, lr.db, login, link.DocumentID, models.PermShare); err != nil {
+		return nil, err
+	}
+	query := `
+		INSERT INTO share_links (token_hash, document_id, created_by, expires_at, max_downloads, password_hash)
+		VALUES ($1, $2, $3, $4, $5, nullif($6, ''))
+		RETURNING id, created
+	`
+	err := lr.db.QueryRow(ctx, query, tokenHash, link.DocumentID, login, link.ExpiresAt, link.MaxDownloads, link.PasswordHash).
+		Scan(&link.ID, &link.Created)
+	if err != nil {
+		return nil, err
+	}
+	link.CreatedBy = login
+	link.HasPassword = link.PasswordHash != ""
+	return &link, nil
+}
+
+func (lr *linkrepo) ListLinks(ctx context.Context, login string, docID int) ([]models.ShareLink, error) {
+	if _, _, err := requireAccess(ctx, lr.db, login, docID, models.PermShare); err != nil {
+		return nil, err
+	}
+	rows, err := lr.db.Query(ctx, `SELECT `+linkColumns+` FROM share_links l WHERE l.document_id = $1 ORDER BY l.id`, docID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []models.ShareLink{}
+	for rows.Next() {
+		var l models.ShareLink
+		if err := scanLink(rows, &l); err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
+
+func (lr *linkrepo) RevokeLink(ctx context.Context, login string, docID, linkID int) (bool, error) {
+	if _, _, err := requireAccess(ctx, lr.db, login, docID, models.PermShare); err != nil {
+		return false, err
+	}
+	res, err := lr.db.Exec(ctx, `
+		UPDATE share_links SET revoked_at = now()
+		WHERE id = $1 AND document_id = $2 AND revoked_at IS NULL
+	`, linkID, docID)
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() > 0, nil
+}
+
+// FindLink returns the link with the token hash if it points at docID and
+// the document is still live. Expiry and limits are checked by UseLink.
+func (lr *linkrepo) FindLink(ctx context.Context, tokenHash string, docID int) (*models.ShareLink, error) {
+	query := `
+		SELECT ` + linkColumns + `
+		FROM share_links l
+		JOIN documents5 d ON d.id = l.document_id
+		WHERE l.token_hash = $1 AND l.document_id = $2 AND d.deleted_at IS NULL
+	`
+	var l models.ShareLink
+	err := scanLink(lr.db.QueryRow(ctx, query, tokenHash, docID), &l)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// UseLink counts a download if the link is still usable and returns the
+// current version of its document. The check and the count happen in one
+// statement so that concurrent downloads cannot exceed the limit.
+func (lr *linkrepo) UseLink(ctx context.Context, linkID int) (*models.DocumentVersion, error) {
+	query := `
+		WITH used AS (
+			UPDATE share_links
+			SET downloads = downloads + 1, last_access = now()
+			WHERE id = $1 AND revoked_at IS NULL
+			  AND (expires_at IS NULL OR expires_at > now())
+			  AND (max_downloads IS NULL OR downloads < max_downloads)
+			RETURNING document_id
+		)
+		SELECT ` + versionColumns + `
+		FROM used
+		JOIN documents5 d ON d.id = used.document_id AND d.deleted_at IS NULL
+		JOIN document_versions v ON v.document_id = d.id AND v.version = d.current_version
+	`
+	var v models.DocumentVersion
+	err := scanVersion(lr.db.QueryRow(ctx, query, linkID), &v)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, models.ErrGone
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (lr *linkrepo) DenyLink(ctx context.Context, linkID int) error {
+	_, err := lr.db.Exec(ctx, `UPDATE share_links SET denied = denied + 1, last_access = now() WHERE id = $1`, linkID)
+	return err
+}
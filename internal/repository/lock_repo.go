@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"HttpServer/internal/models"
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+type LockRepository interface {
+	// AcquireLock locks a document for lock.Owner until lock.Expires, or
+	// extends the lock the owner already holds. It fails with ErrLocked
+	// while another user holds the lock.
+	AcquireLock(ctx context.Context, lock models.DocumentLock) (*models.DocumentLock, error)
+	FindLock(ctx context.Context, docID int) (*models.DocumentLock, error)
+	// ReleaseLock removes the lock of owner, or any lock if owner is empty.
+	// It fails with ErrLocked when another user holds the lock.
+	ReleaseLock(ctx context.Context, docID int, owner string) (bool, error)
+}
+
+type lockrepo struct {
+	redis *redis.Client
+}
+
+func NewLockRepository(redis *redis.Client) LockRepository {
+	return &lockrepo{redis: redis}
+}
+
+func lockKey(docID int) string {
+	return fmt.Sprintf("doclock:%d", docID)
+}
+
+// acquireLock sets the lock unless someone else holds it. The time it was
+// first acquired is kept when its owner extends it.
+var acquireLock = redis.NewScript(`
+local owner = redis.call('HGET', KEYS[1], 'owner')
+if owner and owner ~= ARGV[1] then
+	return 0
+end
+if not owner then
+	redis.call('HSET', KEYS[1], 'owner', ARGV[1], 'acquired', ARGV[2])
+end
+redis.call('HSET', KEYS[1], 'expires', ARGV[3])
+redis.call('PEXPIREAT', KEYS[1], ARGV[4])
+return 1
+`)
+
+// releaseLock deletes the lock if it is held by ARGV[1] or ARGV[1] is empty.
+// It returns -1 if someone else holds the lock.
+var releaseLock = redis.NewScript(`
+local owner = redis.call('HGET', KEYS[1], 'owner')
+if not owner then
+	return 0
+end
+if ARGV[1] ~= '' and owner ~= ARGV[1] then
+	return -1
+end
+redis.call('DEL', KEYS[1])
+return 1
+`)
+
+func (l *lockrepo) AcquireLock(ctx context.Context, lock models.DocumentLock) (*models.DocumentLock, error) {
+	ok, err := acquireLock.Run(ctx, l.redis, []string{lockKey(lock.DocumentID)}, lock.Owner,
+		lock.Acquired.Format(time.RFC3339Nano), lock.Expires.Format(time.RFC3339Nano), lock.Expires.UnixMilli()).Int()
+	if err != nil {
+		return nil, err
+	}
+	held, err := l.FindLock(ctx, lock.DocumentID)
+	if ok == 0 {
+		return nil, lockedError(held, err)
+	}
+	return held, err
+}
+
+func (l *lockrepo) FindLock(ctx context.Context, docID int) (*models.DocumentLock, error) {
+	fields, err := l.redis.HGetAll(ctx, lockKey(docID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if fields["owner"] == "" {
+		return nil, fmt.Errorf("%w: document %d is not locked", models.ErrNotFound, docID)
+	}
+	lock := models.DocumentLock{DocumentID: docID, Owner: fields["owner"]}
+	if lock.Acquired, err = time.Parse(time.RFC3339Nano, fields["acquired"]); err != nil {
+		return nil, fmt.Errorf("invalid lock of document %d: %w", docID, err)
+	}
+	if lock.Expires, err = time.Parse(time.RFC3339Nano, fields["expires"]); err != nil {
+		return nil, fmt.Errorf("invalid lock of document %d: %w", docID, err)
+	}
+	return &lock, nil
+}
+
+func (l *lockrepo) ReleaseLock(ctx context.Context, docID int, owner string) (bool, error) {
+	res, err := releaseLock.Run(ctx, l.redis, []string{lockKey(docID)}, owner).Int()
+	if err != nil {
+		return false, err
+	}
+	if res < 0 {
+		return false, lockedError(l.FindLock(ctx, docID))
+	}
+	return res == 1, nil
+}
+
+// lockedError describes the lock that got in the way. The lock may have
+// expired since, in which case it is no longer known who held it.
+func lockedError(held *models.DocumentLock, err error) error {
+	if err != nil {
+		return models.ErrLocked
+	}
+	return fmt.Errorf("%w: locked by %s until %s", models.ErrLocked, held.Owner, held.Expires.Format(time.RFC3339))
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"HttpServer/internal/models"
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type NotificationRepository interface {
+	SaveNotifications(ctx context.Context, notes []models.Notification) error
+	// ListNotifications returns the latest notifications of login, unread
+	// ones only if unread is set.
+	ListNotifications(ctx context.Context, login string, unread bool, limit int) ([]models.Notification, error)
+	MarkNotificationRead(ctx context.Context, login string, id int) (bool, error)
+}
+
+type notificationrepo struct {
+	db *pgxpool.Pool
+}
+
+func NewNotificationRepository(db *pgxpool.Pool) NotificationRepository {
+	return &notificationrepo{db: db}
+}
+
+func (n *notificationrepo) SaveNotifications(ctx context.Context, notes []models.Notification) error {
+	rows := make([][]interface{}, len(notes))
+	for i, note := range notes {
+		rows[i] = []interface{}{note.Login, note.Kind, note.DocumentID, note.Message}
+	}
+	_, err := n.db.CopyFrom(ctx, pgx.Identifier{"notifications"}, []string{"login", "kind", "document_id", "message"}, pgx.CopyFromRows(rows))
+	if err != nil {
+		return fmt.Errorf("failed to save notifications: %w", err)
+	}
+	return nil
+}
+
+func (n *notificationrepo) ListNotifications(ctx context.Context, login string, unread bool, limit int) ([]models.Notification, error) {
+	rows, err := n.db.Query(ctx, `
+		SELECT id, login, kind, document_id, message, created, read_at
+		FROM notifications
+		WHERE login = $1 AND (NOT $2 OR read_at IS NULL)
+		ORDER BY id DESC
+		LIMIT $3
+	`, login, unread, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notes := []models.Notification{}
+	for rows.Next() {
+		var note models.Notification
+		if err := rows.Scan(&note.ID, &note.Login, &note.Kind, &note.DocumentID, &note.Message, &note.Created, &note.ReadAt); err != nil {
+			return nil, err
+		}
+		notes = append(notes, note)
+	}
+	return notes, rows.Err()
+}
+
+func (n *notificationrepo) MarkNotificationRead(ctx context.Context, login string, id int) (bool, error) {
+	res, err := n.db.Exec(ctx, `
+		UPDATE notifications SET read_at = coalesce(read_at, now()) WHERE id = $1 AND login = $2
+	`, id, login)
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() > 0, nil
+}
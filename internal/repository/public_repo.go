@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"HttpServer/internal/models"
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+)
+
+// FindPublicDocumentByID returns the public projection of a public document.
+func (r *repo) FindPublicDocumentByID(ctx context.Context, id int) (*models.PublicDocument, error) {
+	query := `SELECT ` + documentColumns + ` FROM documents5 d WHERE d.id = $1 AND ` + publicDocument
+	var doc models.Document
+	err := scanDocument(r.db.QueryRow(ctx, query, id), &doc)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	public := doc.PublicView()
+	return &public, nil
+}
+
+// FindPublicVersion returns the current version of a public document. Older
+// versions are only available to users with access to the document.
+func (r *repo) FindPublicVersion(ctx context.Context, docID int) (*models.DocumentVersion, error) {
+	query := `
+		SELECT ` + versionColumns + `
+		FROM documents5 d
+		JOIN document_versions v ON v.document_id = d.id AND v.version = d.current_version
+		WHERE d.id = $1 AND ` + publicDocument
+	var v models.DocumentVersion
+	err := scanVersion(r.db.QueryRow(ctx, query, docID), &v)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
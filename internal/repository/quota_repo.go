@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"HttpServer/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// QuotaRepository reads usage, which triggers keep current, and stores the
+// quota overrides of users.
+type QuotaRepository interface {
+	GetUsage(ctx context.Context, login string) (*models.Usage, error)
+	// FindOverride returns an empty override for users without one.
+	FindOverride(ctx context.Context, login string) (*models.QuotaOverride, error)
+	SaveOverride(ctx context.Context, login string, o models.QuotaOverride) error
+	DeleteOverride(ctx context.Context, login string) error
+}
+
+type quotarepo struct {
+	db *pgxpool.Pool
+}
+
+func NewQuotaRepository(db *pgxpool.Pool) QuotaRepository {
+	return &quotarepo{db: db}
+}
+
+func (q *quotarepo) GetUsage(ctx context.Context, login string) (*models.Usage, error) {
+	var u models.Usage
+	err := q.db.QueryRow(ctx, `
+		SELECT coalesce(max(bytes), 0), coalesce(max(documents), 0) FROM user_usage WHERE login = $1
+	`, login).Scan(&u.Bytes, &u.Documents)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage: %w", err)
+	}
+	return &u, nil
+}
+
+func (q *quotarepo) FindOverride(ctx context.Context, login string) (*models.QuotaOverride, error) {
+	var o models.QuotaOverride
+	err := q.db.QueryRow(ctx, `
+		SELECT max_bytes, max_documents, max_file_size FROM user_quotas WHERE login = $1
+	`, login).Scan(&o.MaxBytes, &o.MaxDocuments, &o.MaxFileSize)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return &o, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get quota: %w", err)
+	}
+	return &o, nil
+}
+
+func (q *quotarepo) SaveOverride(ctx context.Context, login string, o models.QuotaOverride) error {
+	_, err := q.db.Exec(ctx, `
+		INSERT INTO user_quotas (login, max_bytes, max_documents, max_file_size)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (login) DO UPDATE
+		SET max_bytes = EXCLUDED.max_bytes, max_documents = EXCLUDED.max_documents, max_file_size = EXCLUDED.max_file_size
+	`, login, o.MaxBytes, o.MaxDocuments, o.MaxFileSize)
+	if err != nil {
+		return fmt.Errorf("failed to save quota: %w", err)
+	}
+	return nil
+}
+
+func (q *quotarepo) DeleteOverride(ctx context.Context, login string) error {
+	if _, err := q.db.Exec(ctx, `DELETE FROM user_quotas WHERE login = $1`, login); err != nil {
+		return fmt.Errorf("failed to delete quota: %w", err)
+	}
+	return nil
+}
+
+// lockUsage locks the usage of login until tx ends, so that concurrent
+// uploads of one user are checked against the quota one after another.
+func lockUsage(ctx context.Context, tx pgx.Tx, login string) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO user_usage (login) VALUES ($1)
+		ON CONFLICT (login) DO UPDATE SET login = EXCLUDED.login
+	`, login)
+	if err != nil {
+		return fmt.Errorf("failed to lock usage: %w", err)
+	}
+	return nil
+}
+
+// checkUsage fails with ErrQuotaExceeded when the changes tx made leave
+// login beyond its quota, which rolls them back.
+func checkUsage(ctx context.Context, tx pgx.Tx, login string, quota models.Quota) error {
+	var u models.Usage
+	err := tx.QueryRow(ctx, `SELECT bytes, documents FROM user_usage WHERE login = $1`, login).Scan(&u.Bytes, &u.Documents)
+	if err != nil {
+		return fmt.Errorf("failed to check usage: %w", err)
+	}
+	if quota.MaxBytes > 0 && u.Bytes > quota.MaxBytes {
+		return fmt.Errorf("%w: the storage quota of %d bytes is used up", models.ErrQuotaExceeded, quota.MaxBytes)
+	}
+	if quota.MaxDocuments > 0 && u.Documents > quota.MaxDocuments {
+		return fmt.Errorf("%w: the quota of %d documents is used up", models.ErrQuotaExceeded, quota.MaxDocuments)
+	}
+	return nil
+}
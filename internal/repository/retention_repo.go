@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"HttpServer/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"time"
+)
+
+const retentionColumns = `r.id, r.tag, r.folder_id, r.mime, r.days, coalesce(r.created_by, ''), r.created`
+
+func scanRetentionRule(row pgx.Row, rule *models.RetentionRule) error {
+	return row.Scan(&rule.ID, &rule.Tag, &rule.FolderID, &rule.Mime, &rule.Days, &rule.CreatedBy, &rule.Created)
+}
+
+func (r *repo) ListRetentionRules(ctx context.Context) ([]models.RetentionRule, error) {
+	rows, err := r.db.Query(ctx, `SELECT `+retentionColumns+` FROM retention_rules r ORDER BY r.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []models.RetentionRule{}
+	for rows.Next() {
+		var rule models.RetentionRule
+		if err := scanRetentionRule(rows, &rule); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+func (r *repo) CreateRetentionRule(ctx context.Context, rule models.RetentionRule) (*models.RetentionRule, error) {
+	query := `
+		INSERT INTO retention_rules AS r (tag, folder_id, mime, days, created_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING ` + retentionColumns
+	var saved models.RetentionRule
+	err := scanRetentionRule(r.db.QueryRow(ctx, query, rule.Tag, rule.FolderID, rule.Mime, rule.Days, rule.CreatedBy), &saved)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		return nil, fmt.Errorf("%w: folder %d does not exist", models.ErrInvalidQuery, *rule.FolderID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save retention rule: %w", err)
+	}
+	r.invalidateAllUsers(ctx)
+	return &saved, nil
+}
+
+func (r *repo) DeleteRetentionRule(ctx context.Context, id int) (bool, error) {
+	res, err := r.db.Exec(ctx, `DELETE FROM retention_rules WHERE id = $1`, id)
+	if err != nil {
+		return false, err
+	}
+	if res.RowsAffected() == 0 {
+		return false, nil
+	}
+	r.invalidateAllUsers(ctx)
+	return true, nil
+}
+
+// FindExpiringDocuments returns documents that expire before the given time
+// and whose owners were not told yet. Held documents do not expire.
+func (r *repo) FindExpiringDocuments(ctx context.Context, before time.Time, limit int) ([]models.Document, error) {
+	query := `
+		SELECT ` + documentColumns + ` FROM documents5 d
+		WHERE d.deleted_at IS NULL AND d.expiry_notified_at IS NULL AND NOT ` + heldDocument + ` AND ` + documentExpiry + ` < $1
+		ORDER BY d.id
+		LIMIT $2`
+	return r.queryDocuments(ctx, query, before, limit)
+}
+
+// FindExpiredDocuments returns documents past their expiry that are not in
+// the trash yet, by id after afterID. Held documents are left alone until
+// their hold ends. A document only expires once its owner was told at least
+// notice before, so one that a new rule expires at once is kept for the
+// notice.
+func (r *repo) FindExpiredDocuments(ctx context.Context, notice time.Duration, afterID, limit int) ([]models.Document, error) {
+	query := `
+		SELECT ` + documentColumns + ` FROM documents5 d
+		WHERE d.deleted_at IS NULL AND d.id > $1 AND NOT ` + heldDocument + ` AND ` + documentExpiry + ` <= now()
+		  AND d.expiry_notified_at + make_interval(secs => $3) <= now()
+		ORDER BY d.id
+		LIMIT $2`
+	return r.queryDocuments(ctx, query, afterID, limit, notice.Seconds())
+}
+
+func (r *repo) MarkExpiryNotified(ctx context.Context, ids []int) error {
+	_, err := r.db.Exec(ctx, `UPDATE documents5 SET expiry_notified_at = now() WHERE id = ANY($1)`, ids)
+	return err
+}
+
+func (r *repo) queryDocuments(ctx context.Context, query string, args ...interface{}) ([]models.Document, error) {
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var docs []models.Document
+	for rows.Next() {
+		var doc models.Document
+		if err := scanDocument(rows, &doc); err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
+}
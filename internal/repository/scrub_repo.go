@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"HttpServer/internal/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ScrubRepository keeps the reports of storage scrubs.
+type ScrubRepository interface {
+	// StartScrub records a new running scrub. It fails with ErrConflict
+	// while another scrub is running.
+	StartScrub(ctx context.Context) (*models.ScrubReport, error)
+	SaveScrubReport(ctx context.Context, report *models.ScrubReport) error
+	// ListScrubReports returns the latest reports without their problems.
+	ListScrubReports(ctx context.Context, limit int) ([]models.ScrubReport, error)
+	FindScrubReport(ctx context.Context, id int) (*models.ScrubReport, error)
+}
+
+type scrubrepo struct {
+	db *pgxpool.Pool
+}
+
+func NewScrubRepository(db *pgxpool.Pool) ScrubRepository {
+	return &scrubrepo{db: db}
+}
+
+// scrubStale is how long a running scrub may go without saving progress
+// before it is taken for crashed and another one may start.
+const scrubStale = "10 minutes"
+
+func (s *scrubrepo) StartScrub(ctx context.Context) (*models.ScrubReport, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// serializes concurrent starts, which would not see each other's rows
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('scrub_reports'))`); err != nil {
+		return nil, err
+	}
+	var report models.ScrubReport
+	err = tx.QueryRow(ctx, `
+		INSERT INTO scrub_reports (started)
+		SELECT now()
+		WHERE NOT EXISTS (SELECT 1 FROM scrub_reports WHERE finished IS NULL AND updated > now() - interval '`+scrubStale+`')
+		RETURNING id, started, updated
+	`).Scan(&report.ID, &report.Started, &report.Updated)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w: a scrub is running", models.ErrConflict)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to start scrub: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func (s *scrubrepo) SaveScrubReport(ctx context.Context, report *models.ScrubReport) error {
+	problems, err := json.Marshal(report.Problems)
+	if err != nil {
+		return err
+	}
+	if report.Problems == nil {
+		problems = []byte("[]")
+	}
+	err = s.db.QueryRow(ctx, `
+		UPDATE scrub_reports
+		SET updated = now(), finished = $2, versions = $3, recorded = $4, blobs = $5,
+		    missing = $6, corrupted = $7, orphaned = $8, problems = $9, error = $10, unverified = $11
+		WHERE id = $1
+		RETURNING updated
+	`, report.ID, report.Finished, report.Versions, report.Recorded, report.Blobs,
+		report.Missing, report.Corrupted, report.Orphaned, string(problems), report.Error, report.Unverified).Scan(&report.Updated)
+	if err != nil {
+		return fmt.Errorf("failed to save scrub report: %w", err)
+	}
+	return nil
+}
+
+const scrubColumns = `id, started, updated, finished, versions, recorded, unverified, blobs, missing, corrupted, orphaned, error`
+
+func scrubDest(r *models.ScrubReport) []interface{} {
+	return []interface{}{&r.ID, &r.Started, &r.Updated, &r.Finished, &r.Versions, &r.Recorded, &r.Unverified, &r.Blobs,
+		&r.Missing, &r.Corrupted, &r.Orphaned, &r.Error}
+}
+
+func (s *scrubrepo) ListScrubReports(ctx context.Context, limit int) ([]models.ScrubReport, error) {
+	rows, err := s.db.Query(ctx, `SELECT `+scrubColumns+` FROM scrub_reports ORDER BY id DESC LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []models.ScrubReport{}
+	for rows.Next() {
+		var r models.ScrubReport
+		if err := rows.Scan(scrubDest(&r)...); err != nil {
+			return nil, err
+		}
+		reports = append(reports, r)
+	}
+	return reports, rows.Err()
+}
+
+func (s *scrubrepo) FindScrubReport(ctx context.Context, id int) (*models.ScrubReport, error) {
+	var r models.ScrubReport
+	err := s.db.QueryRow(ctx, `SELECT `+scrubColumns+`, problems FROM scrub_reports WHERE id = $1`, id).
+		Scan(append(scrubDest(&r), &r.Problems)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"HttpServer/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+// inTrashOf is the condition for trashed documents that the login bound to
+// param either owns or deleted.
+func inTrashOf(param string) string {
+	return fmt.Sprintf("d.deleted_at IS NOT NULL AND (d.owner_login = %[1]s OR d.deleted_by = %[1]s)", param)
+}
+
+// ownedTrashOf is the condition for trashed documents that the login bound
+// to param owns. Only those may be removed for good by the login; whoever
+// trashed a document of someone else may restore it but not purge it.
+func ownedTrashOf(param string) string {
+	return fmt.Sprintf("d.deleted_at IS NOT NULL AND d.owner_login = %s", param)
+}
+
+func (r *repo) ListTrash(ctx context.Context, login string) ([]models.Document, error) {
+	query := `SELECT ` + documentColumns + ` FROM documents5 d WHERE ` + inTrashOf("$1") + ` ORDER BY d.deleted_at DESC`
+	rows, err := r.db.Query(ctx, query, login)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var docs []models.Document
+	for rows.Next() {
+		var doc models.Document
+		if err := scanDocument(rows, &doc); err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
+}
+
+func (r *repo) RestoreDoc(ctx context.Context, login string, id int) (bool, error) {
+	query := `UPDATE documents5 d SET deleted_at = NULL, deleted_by = NULL WHERE d.id = $2 AND ` + inTrashOf("$1")
+	res, err := r.db.Exec(ctx, query, login, id)
+	if err != nil {
+		return false, err
+	}
+	if res.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	r.invalidateDocument(ctx, id)
+
+	return true, nil
+}
+
+// EmptyTrash permanently removes the trashed documents the login owns and
+// returns the storage keys of all their versions. Documents of others that
+// the login trashed stay until their owner empties the trash or they are
+// purged. Held documents stay in the trash, and the attempt to remove them
+// is audited.
+func (r *repo) EmptyTrash(ctx context.Context, login string) ([]string, error) {
+	rows, err := r.db.Query(ctx, `SELECT d.id FROM documents5 d WHERE `+ownedTrashOf("$1")+` AND `+heldDocument, login)
+	if err != nil {
+		return nil, err
+	}
+	held, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range held {
+		if err := r.requireMutable(ctx, r.db, login, "empty_trash", id); err != nil && !errors.Is(err, models.ErrImmutable) {
+			return nil, err
+		}
+	}
+	return r.purge(ctx, ownedTrashOf("$1")+` AND NOT `+heldDocument, login)
+}
+
+// PurgeTrash permanently removes documents that have been in the trash since
+// before deletedBefore and returns the storage keys of all their versions.
+// Held documents stay in the trash and are retried on every run until their
+// hold ends. The denied purge is audited with an empty login, once per time
+// the document was trashed rather than on every run.
+func (r *repo) PurgeTrash(ctx context.Context, deletedBefore time.Time) ([]string, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT d.id FROM documents5 d
+		WHERE d.deleted_at < $1 AND `+heldDocument+` AND NOT EXISTS (
+			SELECT 1 FROM audit_log a
+			WHERE a.document_id = d.id AND a.action = 'purge_trash' AND a.outcome = $2 AND a.created >= d.deleted_at
+		)
+	`, deletedBefore, models.AuditDenied)
+	if err != nil {
+		return nil, err
+	}
+	held, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range held {
+		if err := r.requireMutable(ctx, r.db, "", "purge_trash", id); err != nil && !errors.Is(err, models.ErrImmutable) {
+			return nil, err
+		}
+	}
+	return r.purge(ctx, `d.deleted_at < $1 AND NOT `+heldDocument, deletedBefore)
+}
+
+func (r *repo) purge(ctx context.Context, cond string, args ...interface{}) ([]string, error) {
+	// every part of the statement sees the same snapshot, so the versions are
+	// still there for the outer select even though the cascade removes them
+	query := `
+		WITH gone AS (DELETE FROM documents5 d WHERE ` + cond + ` RETURNING d.id)
+		SELECT v.storage_key FROM document_versions v JOIN gone ON gone.id = v.document_id
+	`
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to purge documents: %w", err)
+	}
+	keys, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to purge documents: %w", err)
+	}
+	return keys, nil
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"HttpServer/internal/models"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPurgeTrashAuditsHeldDocuments(t *testing.T) {
+	r := testRepo(t)
+	ctx := context.Background()
+	u := testLogins("owner")
+	doc := testDocument(t, r, u["owner"], nil)
+
+	if ok, err := r.DeleteDoc(ctx, u["owner"], doc); err != nil || !ok {
+		t.Fatalf("trashing gave %v, %v", ok, err)
+	}
+	hold := true
+	if _, err := r.SetHold(ctx, u["owner"], doc, models.Hold{LegalHold: &hold}); err != nil {
+		t.Fatal(err)
+	}
+	// the second run finds the denial audited already
+	for run := 0; run < 2; run++ {
+		if _, err := r.PurgeTrash(ctx, time.Now().Add(time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var exists bool
+	if err := r.db.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM documents5 WHERE id = $1)`, doc).Scan(&exists); err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Fatal("held document was purged")
+	}
+	entries, err := r.ListAudit(ctx, &doc, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	denied := 0
+	for _, e := range entries {
+		if e.Action == "purge_trash" && e.Outcome == models.AuditDenied {
+			denied++
+		}
+	}
+	if denied != 1 {
+		t.Errorf("%d denied purges audited, want 1: %+v", denied, entries)
+	}
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"HttpServer/internal/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// uploadLockTTL bounds how long a crashed writer can block an upload.
+const uploadLockTTL = time.Hour
+
+type UploadRepository interface {
+	// SaveUpload stores the upload until its Expires time.
+	SaveUpload(ctx context.Context, upload *models.Upload) error
+	FindUpload(ctx context.Context, id string) (*models.Upload, error)
+	DeleteUpload(ctx context.Context, id string) error
+	// LockUpload reserves the upload for one writer. It fails with
+	// ErrConflict while another writer holds the lock.
+	LockUpload(ctx context.Context, id string) (unlock func(), err error)
+}
+
+type uploadrepo struct {
+	redis *redis.Client
+}
+
+func NewUploadRepository(redis *redis.Client) UploadRepository {
+	return &uploadrepo{redis: redis}
+}
+
+func uploadKey(id string) string {
+	return fmt.Sprintf("upload:%s", id)
+}
+
+func (u *uploadrepo) SaveUpload(ctx context.Context, upload *models.Upload) error {
+	ttl := time.Until(upload.Expires)
+	if ttl <= 0 {
+		return u.DeleteUpload(ctx, upload.ID)
+	}
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	return u.redis.Set(ctx, uploadKey(upload.ID), data, ttl).Err()
+}
+
+func (u *uploadrepo) FindUpload(ctx context.Context, id string) (*models.Upload, error) {
+	data, err := u.redis.Get(ctx, uploadKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var upload models.Upload
+	if err := json.Unmarshal(data, &upload); err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+func (u *uploadrepo) DeleteUpload(ctx context.Context, id string) error {
+	return u.redis.Del(ctx, uploadKey(id)).Err()
+}
+
+func (u *uploadrepo) LockUpload(ctx context.Context, id string) (func(), error) {
+	key := uploadKey(id) + ":lock"
+	ok, err := u.redis.SetNX(ctx, key, 1, uploadLockTTL).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: the upload is being written by another request", models.ErrConflict)
+	}
+	return func() {
+		u.redis.Del(context.WithoutCancel(ctx), key)
+	}, nil
+}
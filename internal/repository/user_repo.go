@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -14,6 +15,7 @@ type UserRepository interface {
 	SaveToken(ctx context.Context, login string, token string) error
 	DeleteToken(ctx context.Context, token string) (bool, error)
 	GetLoginFromToken(ctx context.Context, token string) (string, error)
+	GetRole(ctx context.Context, login string) (string, error)
 }
 
 type userrepo struct {
@@ -101,3 +103,17 @@ func (u *userrepo) GetLoginFromToken(ctx context.Context, token string) (string,
 	}
 	return login, nil
 }
+
+// GetRole returns the role of the user, or an empty string when there is no
+// such user.
+func (u *userrepo) GetRole(ctx context.Context, login string) (string, error) {
+	var role string
+	err := u.db.QueryRow(ctx, `SELECT role FROM users WHERE login = $1`, login).Scan(&role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return role, nil
+}
@@ -0,0 +1,368 @@
+package repository
+
+import (
+	"HttpServer/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+const versionColumns = `v.document_id, v.version, v.filename, coalesce(v.mime, ''), v.size, coalesce(v.sha256, ''),
+	coalesce(v.sha256_source, ''), v.scan_status, coalesce(v.scan_result, ''), v.storage_key, coalesce(v.created_by, ''), v.created`
+
+func scanVersion(row pgx.Row, v *models.DocumentVersion) error {
+	return row.Scan(versionDest(v)...)
+}
+
+func versionDest(v *models.DocumentVersion) []interface{} {
+	return []interface{}{&v.DocumentID, &v.Version, &v.Filename, &v.Mime, &v.Size, &v.SHA256, &v.SHA256Source, &v.ScanStatus, &v.ScanResult,
+		&v.StorageKey, &v.CreatedBy, &v.Created}
+}
+
+// SaveDocument inserts the document owned by doc.Owner together with its
+// first version and returns the new document id. A document saved into a
+// folder needs edit permission on the folder. The document must fit into
+// the owner's quota.
+func (r *repo) SaveDocument(ctx context.Context, doc models.Document, v models.DocumentVersion, quota models.Quota) (int, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	if doc.FolderID != nil {
+		if _, _, err := folderGrants.require(ctx, tx, doc.Owner, *doc.FolderID, models.PermEdit); err != nil {
+			return 0, err
+		}
+	}
+	audience, err := folderAudience(ctx, tx, doc.FolderID)
+	if err != nil {
+		return 0, err
+	}
+	if err := lockUsage(ctx, tx, doc.Owner); err != nil {
+		return 0, err
+	}
+
+	query := `
+		INSERT INTO documents5 (name, mime, file, public, owner_login, created, content_text, current_version, max_versions, folder_id, tags, metadata, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, 1, $8, $9, $10, $11, $12)
+		RETURNING id
+	`
+	var id int
+	err = tx.QueryRow(ctx, query, doc.Name, doc.Mime, doc.File, doc.Public, doc.Owner, time.Now(), doc.Content, doc.MaxVersions, doc.FolderID,
+		[]string(doc.Tags), doc.Metadata, doc.ExpiresAt).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save document in database: %w", err)
+	}
+
+	// logins listed at upload may download the document
+	_, err = tx.Exec(ctx, `
+		INSERT INTO document_grants (document_id, login, level)
+		SELECT $1, g, $3 FROM unnest($2::text[]) g WHERE g <> $4
+		ON CONFLICT DO NOTHING
+	`, id, []string(doc.Grant), models.PermDownload.Level(), doc.Owner)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save document grants: %w", err)
+	}
+
+	v.DocumentID, v.Version = id, 1
+	if err := insertVersion(ctx, tx, &v); err != nil {
+		return 0, err
+	}
+	if err := checkUsage(ctx, tx, doc.Owner, quota); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	r.invalidateUsers(ctx, append(append([]string{doc.Owner}, doc.Grant...), audience...)...)
+
+	return id, nil
+}
+
+func insertVersion(ctx context.Context, tx pgx.Tx, v *models.DocumentVersion) error {
+	query := `
+		INSERT INTO document_versions (document_id, version, filename, mime, size, sha256, sha256_source, scan_status, scan_result, storage_key, created_by)
+		VALUES ($1, $2, $3, $4, $5, nullif($6, ''), nullif($7, ''), $8, nullif($9, ''), $10, $11)
+		RETURNING created
+	`
+	err := tx.QueryRow(ctx, query, v.DocumentID, v.Version, v.Filename, v.Mime, v.Size, v.SHA256, v.SHA256Source, v.ScanStatus, v.ScanResult,
+		v.StorageKey, v.CreatedBy).Scan(&v.Created)
+	if err != nil {
+		return fmt.Errorf("failed to save document version: %w", err)
+	}
+	return nil
+}
+
+func (r *repo) ListVersions(ctx context.Context, login string, docID int) ([]models.DocumentVersion, error) {
+	var exists bool
+	query := `SELECT EXISTS(SELECT 1 FROM documents5 d WHERE d.id = $1 AND ` + accessibleBy("$2", models.PermView) + `)`
+	if err := r.db.QueryRow(ctx, query, docID, login).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, models.ErrNotFound
+	}
+
+	query = `SELECT ` + versionColumns + ` FROM document_versions v WHERE v.document_id = $1 ORDER BY v.version DESC`
+	rows, err := r.db.Query(ctx, query, docID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []models.DocumentVersion
+	for rows.Next() {
+		var v models.DocumentVersion
+		if err := scanVersion(rows, &v); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// FindVersion returns the given version of a document, or its current
+// version when version is zero.
+func (r *repo) FindVersion(ctx context.Context, login string, docID, version int) (*models.DocumentVersion, error) {
+	return r.findVersion(ctx, login, docID, version, models.PermDownload)
+}
+
+// FindViewableVersion returns the current version of a document the login
+// may view but not necessarily download, for previews.
+func (r *repo) FindViewableVersion(ctx context.Context, login string, docID int) (*models.DocumentVersion, error) {
+	return r.findVersion(ctx, login, docID, 0, models.PermView)
+}
+
+func (r *repo) findVersion(ctx context.Context, login string, docID, version int, perm models.Permission) (*models.DocumentVersion, error) {
+	query := `
+		SELECT ` + versionColumns + `
+		FROM documents5 d
+		JOIN document_versions v ON v.document_id = d.id
+		WHERE d.id = $1 AND ` + accessibleBy("$2", perm) + `
+		  AND v.version = CASE WHEN $3 = 0 THEN d.current_version ELSE $3 END
+	`
+	var v models.DocumentVersion
+	err := scanVersion(r.db.QueryRow(ctx, query, docID, login, version), &v)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, r.accessError(ctx, login, docID, perm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// ListCurrentVersions pages through the current versions of all documents,
+// trashed ones included, whose type is one of mimes, in document id order
+// starting after afterID.
+func (r *repo) ListCurrentVersions(ctx context.Context, mimes []string, afterID, limit int) ([]models.DocumentVersion, error) {
+	query := `
+		SELECT ` + versionColumns + `
+		FROM documents5 d
+		JOIN document_versions v ON v.document_id = d.id AND v.version = d.current_version
+		WHERE d.id > $1 AND v.mime = ANY($2)
+		ORDER BY d.id
+		LIMIT $3
+	`
+	rows, err := r.db.Query(ctx, query, afterID, mimes, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []models.DocumentVersion
+	for rows.Next() {
+		var v models.DocumentVersion
+		if err := scanVersion(rows, &v); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// ListAllVersions pages through every version of every document, trashed
+// ones included, in (document id, version) order starting after the given
+// version.
+func (r *repo) ListAllVersions(ctx context.Context, afterID, afterVersion, limit int) ([]models.DocumentVersion, error) {
+	query := `
+		SELECT ` + versionColumns + `
+		FROM document_versions v
+		WHERE (v.document_id, v.version) > ($1, $2)
+		ORDER BY v.document_id, v.version
+		LIMIT $3
+	`
+	rows, err := r.db.Query(ctx, query, afterID, afterVersion, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.DocumentVersion, error) {
+		var v models.DocumentVersion
+		err := scanVersion(row, &v)
+		return v, err
+	})
+}
+
+// FindUnversionedDocuments pages through file documents saved before
+// versions existed, which have no version yet, in id order.
+func (r *repo) FindUnversionedDocuments(ctx context.Context, afterID, limit int) ([]models.Document, error) {
+	query := `
+		SELECT ` + documentColumns + `
+		FROM documents5 d
+		WHERE d.current_version = 0 AND d.file AND d.id > $1
+		ORDER BY d.id
+		LIMIT $2
+	`
+	return r.queryDocuments(ctx, query, afterID, limit)
+}
+
+// SaveFirstVersion makes v version 1 of a document that has no version. It
+// reports false if the document got one meanwhile.
+func (r *repo) SaveFirstVersion(ctx context.Context, v models.DocumentVersion) (bool, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	res, err := tx.Exec(ctx, `UPDATE documents5 SET current_version = 1 WHERE id = $1 AND current_version = 0`, v.DocumentID)
+	if err != nil {
+		return false, fmt.Errorf("failed to update document: %w", err)
+	}
+	if res.RowsAffected() == 0 {
+		return false, nil
+	}
+	v.Version = 1
+	if err := insertVersion(ctx, tx, &v); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false, err
+	}
+
+	r.invalidateDocument(ctx, v.DocumentID)
+
+	return true, nil
+}
+
+// SetVersionChecksum records the checksum computed of the blob of a version
+// that has none yet.
+func (r *repo) SetVersionChecksum(ctx context.Context, docID, version int, sum string) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE document_versions SET sha256 = $3, sha256_source = 'computed' WHERE document_id = $1 AND version = $2 AND sha256 IS NULL
+	`, docID, version, sum)
+	return err
+}
+
+// ListPendingScans pages through the versions that were not scanned yet,
+// like ListAllVersions.
+func (r *repo) ListPendingScans(ctx context.Context, afterID, afterVersion, limit int) ([]models.DocumentVersion, error) {
+	query := `
+		SELECT ` + versionColumns + `
+		FROM document_versions v
+		WHERE v.scan_status = 'pending' AND (v.document_id, v.version) > ($1, $2)
+		ORDER BY v.document_id, v.version
+		LIMIT $3
+	`
+	rows, err := r.db.Query(ctx, query, afterID, afterVersion, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.DocumentVersion, error) {
+		var v models.DocumentVersion
+		err := scanVersion(row, &v)
+		return v, err
+	})
+}
+
+// SetScanResult records the scan of a pending version, whose content may
+// have moved to storageKey. It reports false if the version is gone or was
+// scanned meanwhile.
+func (r *repo) SetScanResult(ctx context.Context, docID, version int, status, result, storageKey string) (bool, error) {
+	res, err := r.db.Exec(ctx, `
+		UPDATE document_versions SET scan_status = $3, scan_result = nullif($4, ''), storage_key = $5
+		WHERE document_id = $1 AND version = $2 AND scan_status = 'pending'
+	`, docID, version, status, result, storageKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to save scan result: %w", err)
+	}
+	if res.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	r.invalidateDocument(ctx, docID)
+
+	return true, nil
+}
+
+// AddVersion makes v the current version of its document and drops the
+// oldest versions beyond the retention limit: the document's own
+// max_versions if set, maxVersions otherwise. It returns the storage keys of
+// the dropped versions so that their blobs can be removed. What remains must
+// fit into quota, the quota of the document's owner. Held documents get no
+// new versions.
+func (r *repo) AddVersion(ctx context.Context, login string, v models.DocumentVersion, content string, maxVersions int, quota models.Quota) (*models.DocumentVersion, []string, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		UPDATE documents5 d
+		SET current_version = current_version + 1, mime = $3, content_text = $4
+		WHERE d.id = $1 AND ` + accessibleBy("$2", models.PermEdit) + ` AND NOT ` + heldDocument + `
+		RETURNING current_version, coalesce(max_versions, $5), coalesce(owner_login, '')
+	`
+	var limit int
+	var owner string
+	err = tx.QueryRow(ctx, query, v.DocumentID, login, v.Mime, content, maxVersions).Scan(&v.Version, &limit, &owner)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, r.changeError(ctx, login, "add_version", v.DocumentID, models.PermEdit)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to update document: %w", err)
+	}
+	// documents without an owner count against nobody's quota
+	if owner != "" {
+		if err := lockUsage(ctx, tx, owner); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := insertVersion(ctx, tx, &v); err != nil {
+		return nil, nil, err
+	}
+
+	var pruned []string
+	if limit > 0 {
+		rows, err := tx.Query(ctx, `
+			DELETE FROM document_versions
+			WHERE document_id = $1 AND version <= $2
+			RETURNING storage_key
+		`, v.DocumentID, v.Version-limit)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to prune versions: %w", err)
+		}
+		pruned, err = pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to prune versions: %w", err)
+		}
+	}
+	if owner != "" {
+		if err := checkUsage(ctx, tx, owner, quota); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	r.invalidateDocument(ctx, v.DocumentID)
+
+	return &v, pruned, nil
+}
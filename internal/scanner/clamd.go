@@ -0,0 +1,129 @@
+// Package scanner checks content for malware with a clamd compatible
+// daemon.
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+var errClamd = errors.New("clamd failed")
+
+// Result is the verdict on scanned content. Signature names what was found
+// in infected content.
+type Result struct {
+	Infected  bool
+	Signature string
+}
+
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (*Result, error)
+}
+
+// chunkSize must stay below the StreamMaxLength of clamd.
+const chunkSize = 64 << 10
+
+type clamd struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamd scans with the INSTREAM command of the clamd listening on
+// address: a socket path, optionally prefixed with unix:, or host:port,
+// optionally prefixed with tcp:. A scan that takes longer than timeout
+// fails.
+func NewClamd(address string, timeout time.Duration) Scanner {
+	c := &clamd{network: "tcp", address: address, timeout: timeout}
+	switch {
+	case strings.HasPrefix(address, "unix:"):
+		c.network, c.address = "unix", strings.TrimPrefix(address, "unix:")
+	case strings.HasPrefix(address, "tcp:"):
+		c.address = strings.TrimPrefix(address, "tcp:")
+	case strings.HasPrefix(address, "/"):
+		c.network = "unix"
+	}
+	return c
+}
+
+// Scan streams r to clamd in length-prefixed chunks and reads the verdict.
+func (c *clamd) Scan(ctx context.Context, r io.Reader) (*Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	if err := c.send(conn, r); err != nil {
+		// clamd hangs up on streams above its limit, and says why; if it
+		// did not, there is nothing to wait for
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		if res, replyErr := readReply(conn); res != nil || errors.Is(replyErr, errClamd) {
+			return res, replyErr
+		}
+		return nil, err
+	}
+	return readReply(conn)
+}
+
+func (c *clamd) send(conn net.Conn, r io.Reader) error {
+	w := bufio.NewWriterSize(conn, chunkSize+4)
+	if _, err := w.WriteString("zINSTREAM\x00"); err != nil {
+		return fmt.Errorf("failed to send to clamd: %w", err)
+	}
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if err := binary.Write(w, binary.BigEndian, uint32(n)); err != nil {
+				return fmt.Errorf("failed to send to clamd: %w", err)
+			}
+			if _, err := w.Write(buf[:n]); err != nil {
+				return fmt.Errorf("failed to send to clamd: %w", err)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read content: %w", err)
+		}
+	}
+	if err := binary.Write(w, binary.BigEndian, uint32(0)); err != nil {
+		return fmt.Errorf("failed to send to clamd: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to send to clamd: %w", err)
+	}
+	return nil
+}
+
+// readReply parses replies such as "stream: OK", "stream: Eicar-Signature
+// FOUND" and "INSTREAM size limit exceeded. ERROR".
+func readReply(conn net.Conn) (*Result, error) {
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && (err != io.EOF || reply == "") {
+		return nil, fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	verdict := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case verdict == "OK":
+		return &Result{}, nil
+	case strings.HasSuffix(verdict, " FOUND"):
+		return &Result{Infected: true, Signature: strings.TrimSuffix(verdict, " FOUND")}, nil
+	}
+	return nil, fmt.Errorf("%w: %s", errClamd, reply)
+}
@@ -0,0 +1,65 @@
+package scanner
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestReadReply(t *testing.T) {
+	tests := []struct {
+		reply string
+		want  *Result
+	}{
+		{"stream: OK\x00", &Result{}},
+		{"stream: OK\n", &Result{}},
+		{"stream: OK", &Result{}},
+		{"stream: Win.Test.EICAR_HDB-1 FOUND\x00", &Result{Infected: true, Signature: "Win.Test.EICAR_HDB-1"}},
+		{"INSTREAM size limit exceeded. ERROR\x00", nil},
+		{"stream: lstat() failed. ERROR\x00", nil},
+		{"UNKNOWN COMMAND\n", nil},
+	}
+	for _, tt := range tests {
+		server, client := net.Pipe()
+		go func() {
+			server.Write([]byte(tt.reply))
+			server.Close()
+		}()
+		got, err := readReply(client)
+		client.Close()
+		if tt.want == nil {
+			if !errors.Is(err, errClamd) {
+				t.Errorf("%q: got %v, %v, want errClamd", tt.reply, got, err)
+			}
+			continue
+		}
+		if err != nil || *got != *tt.want {
+			t.Errorf("%q: got %v, %v, want %v", tt.reply, got, err, tt.want)
+		}
+	}
+}
+
+func TestReadReplyWithoutReply(t *testing.T) {
+	server, client := net.Pipe()
+	server.Close()
+	if _, err := readReply(client); err == nil || errors.Is(err, errClamd) {
+		t.Errorf("a closed connection gave %v, want a read error", err)
+	}
+}
+
+func TestNewClamdAddress(t *testing.T) {
+	tests := []struct {
+		address, network, addr string
+	}{
+		{"127.0.0.1:3310", "tcp", "127.0.0.1:3310"},
+		{"tcp:clamav:3310", "tcp", "clamav:3310"},
+		{"unix:/run/clamd.sock", "unix", "/run/clamd.sock"},
+		{"/run/clamd.sock", "unix", "/run/clamd.sock"},
+	}
+	for _, tt := range tests {
+		c := NewClamd(tt.address, 0).(*clamd)
+		if c.network != tt.network || c.address != tt.addr {
+			t.Errorf("%s: got %s %s, want %s %s", tt.address, c.network, c.address, tt.network, tt.addr)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"HttpServer/internal/models"
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strings"
+	"unicode"
+)
+
+const maxArchiveItems = 1000
+
+// ArchiveEntries resolves what an archive of the request holds, checking
+// access to every document. Entries are named after the documents and keep
+// the folder structure below a requested folder.
+func (s *dockserv) ArchiveEntries(ctx context.Context, token string, req models.ArchiveRequest) ([]models.ArchiveEntry, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	selections := 0
+	if len(req.IDs) > 0 {
+		selections++
+	}
+	if req.FolderID != nil {
+		selections++
+	}
+	if len(req.Filters) > 0 {
+		selections++
+	}
+	if selections != 1 {
+		return nil, fmt.Errorf("%w: give exactly one of ids, folder_id and filters", models.ErrInvalidQuery)
+	}
+
+	items, err := s.docsRepository.FindArchiveItems(ctx, login, req, maxArchiveItems)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]models.ArchiveEntry, 0, len(items))
+	used := make(map[string]bool, len(items))
+	for _, it := range items {
+		var parts []string
+		if it.Path != "" {
+			for _, folder := range strings.Split(it.Path, "/") {
+				parts = append(parts, safeEntryName(folder, "folder"))
+			}
+		}
+		name := safeEntryName(it.Document.Name, fmt.Sprintf("document-%d", it.Document.ID))
+		if path.Ext(name) == "" {
+			name += path.Ext(safeEntryName(it.Version.Filename, ""))
+		}
+		entries = append(entries, models.ArchiveEntry{
+			Name:    uniqueEntryName(path.Join(append(parts, name)...), used),
+			Version: it.Version,
+		})
+	}
+	return entries, nil
+}
+
+// safeEntryName turns a document or folder name into a single path element
+// that cannot escape the archive root or confuse unpackers.
+func safeEntryName(name, fallback string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r == '/' || r == '\\' || r == ':':
+			return '_'
+		case unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimLeft(strings.TrimSpace(name), ".")
+	if r := []rune(name); len(r) > 200 {
+		name = string(r[:200])
+	}
+	if name == "" {
+		return fallback
+	}
+	return name
+}
+
+// uniqueEntryName appends a counter to names that are already taken, keeping
+// the extension: report.pdf, report (2).pdf, ...
+func uniqueEntryName(name string, used map[string]bool) string {
+	unique := name
+	ext := path.Ext(name)
+	for i := 2; used[strings.ToLower(unique)]; i++ {
+		unique = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), i, ext)
+	}
+	used[strings.ToLower(unique)] = true
+	return unique
+}
+
+// WriteArchive streams a ZIP of the entries to w one blob at a time. Once the
+// archive has started an error can no longer be reported to the client, so
+// blobs that cannot be read are skipped and logged.
+func (s *dockserv) WriteArchive(ctx context.Context, entries []models.ArchiveEntry, w io.Writer) error {
+	zw := zip.NewWriter(w)
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		_, rc, err := s.openBlob(ctx, &e.Version)
+		if err != nil {
+			log.Printf("skipping %s in archive: %v", e.Name, err)
+			continue
+		}
+		method := zip.Deflate
+		if precompressed(e.Version.Mime) {
+			method = zip.Store
+		}
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     e.Name,
+			Method:   method,
+			Modified: e.Version.Created,
+		})
+		if err == nil {
+			_, err = io.Copy(fw, rc)
+		}
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", e.Name, err)
+		}
+	}
+	return zw.Close()
+}
+
+// precompressed reports whether deflating content of mimeType is a waste.
+func precompressed(mimeType string) bool {
+	switch {
+	case strings.HasPrefix(mimeType, "image/") && mimeType != "image/bmp" && mimeType != "image/svg+xml",
+		strings.HasPrefix(mimeType, "video/"), strings.HasPrefix(mimeType, "audio/"),
+		mimeType == "application/zip", mimeType == "application/gzip", mimeType == "application/x-gzip",
+		strings.HasPrefix(mimeType, "application/vnd.openxmlformats-officedocument."):
+		return true
+	}
+	return false
+}
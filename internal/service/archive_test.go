@@ -0,0 +1,42 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSafeEntryName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"report.pdf", "report.pdf"},
+		{"../../etc/passwd", "_.._etc_passwd"},
+		{`..\..\boot.ini`, `_.._boot.ini`},
+		{"/abs/path", "_abs_path"},
+		{"C:evil", "C_evil"},
+		{".hidden", "hidden"},
+		{"..", "doc"},
+		{"  spaced  ", "spaced"},
+		{"new\nline\x00", "newline"},
+		{"", "doc"},
+		{strings.Repeat("ж", 300), strings.Repeat("ж", 200)},
+	}
+	for _, tt := range tests {
+		if got := safeEntryName(tt.name, "doc"); got != tt.want {
+			t.Errorf("safeEntryName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestUniqueEntryName(t *testing.T) {
+	used := map[string]bool{}
+	var got []string
+	for _, name := range []string{"report.pdf", "Report.pdf", "report.pdf", "notes"} {
+		got = append(got, uniqueEntryName(name, used))
+	}
+	want := []string{"report.pdf", "Report (2).pdf", "report (3).pdf", "notes"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
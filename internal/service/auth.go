@@ -1,6 +1,7 @@
 package service
 
 import (
+	"HttpServer/internal/models"
 	"HttpServer/internal/repository"
 	"HttpServer/internal/utils"
 	"context"
@@ -14,6 +15,8 @@ type AuthService interface {
 	Authenticate(ctx context.Context, login, password string) (string, error)
 	GetLoginFromToken(ctx context.Context, token string) (string, error)
 	DeleteToken(ctx context.Context, token string) (bool, error)
+	UserExists(ctx context.Context, login string) (bool, error)
+	GetRole(ctx context.Context, login string) (string, error)
 }
 
 type authstvc struct {
@@ -76,3 +79,18 @@ func (h *authstvc) DeleteToken(ctx context.Context, token string) (bool, error)
 	}
 	return st, nil
 }
+func (s *authstvc) UserExists(ctx context.Context, login string) (bool, error) {
+	return s.userRepo.UserExists(ctx, login)
+}
+
+// GetRole returns the role of the user, defaulting to models.RoleUser.
+func (s *authstvc) GetRole(ctx context.Context, login string) (string, error) {
+	role, err := s.userRepo.GetRole(ctx, login)
+	if err != nil {
+		return "", fmt.Errorf("failed to get role of %s: %w", login, err)
+	}
+	if role == "" {
+		role = models.RoleUser
+	}
+	return role, nil
+}
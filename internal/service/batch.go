@@ -0,0 +1,62 @@
+package service
+
+import (
+	"HttpServer/internal/models"
+	"context"
+	"fmt"
+)
+
+const maxBatchSize = 500
+
+// Batch applies one action to many documents at once. Duplicate ids are
+// handled once.
+func (s *dockserv) Batch(ctx context.Context, token string, req models.BatchRequest) (*models.BatchReport, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.IDs) == 0 {
+		return nil, fmt.Errorf("%w: no documents given", models.ErrInvalidQuery)
+	}
+	if len(req.IDs) > maxBatchSize {
+		return nil, fmt.Errorf("%w: at most %d documents per batch", models.ErrInvalidQuery, maxBatchSize)
+	}
+	seen := make(map[int]bool, len(req.IDs))
+	ids := req.IDs[:0:0]
+	for _, id := range req.IDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	req.IDs = ids
+
+	switch req.Action {
+	case models.BatchDelete:
+	case models.BatchSetPublic:
+		if req.Public == nil {
+			return nil, fmt.Errorf("%w: public is required", models.ErrInvalidQuery)
+		}
+	case models.BatchAddGrants:
+		if err := s.checkGrantees(ctx, login, req.Grants); err != nil {
+			return nil, err
+		}
+	case models.BatchRemoveGrants:
+		if len(req.Logins) == 0 {
+			return nil, fmt.Errorf("%w: no logins given", models.ErrInvalidQuery)
+		}
+	case models.BatchAddTags, models.BatchRemoveTags:
+		if len(req.Tags) == 0 {
+			return nil, fmt.Errorf("%w: no tags given", models.ErrInvalidQuery)
+		}
+		if req.Tags, err = models.NormalizeTags(req.Tags); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown action %q", models.ErrInvalidQuery, req.Action)
+	}
+	// documents checked out by someone else fail like any other item
+	return s.docsRepository.Batch(ctx, login, req, func(id int) error {
+		return s.checkLock(ctx, login, id)
+	})
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"HttpServer/internal/models"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// cursorPayload is what an opaque cursor carries. Scope binds the cursor to
+// the filters and sort order it was issued for.
+type cursorPayload struct {
+	Key      models.Keyset `json:"k"`
+	Backward bool          `json:"b,omitempty"`
+	Scope    string        `json:"s"`
+}
+
+type cursorCodec struct {
+	secret []byte
+}
+
+func (c cursorCodec) encode(k *models.Keyset, backward bool, q models.DocumentQuery) (string, error) {
+	if k == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(cursorPayload{Key: *k, Backward: backward, Scope: cursorScope(q)})
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(c.sign(payload)), nil
+}
+
+// decode verifies the cursor signature and fills q.After or q.Before.
+func (c cursorCodec) decode(cursor string, q *models.DocumentQuery) error {
+	payload, sig, ok := strings.Cut(cursor, ".")
+	if !ok {
+		return fmt.Errorf("%w: malformed cursor", models.ErrInvalidQuery)
+	}
+	rawSig, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(rawSig, c.sign(payload)) {
+		return fmt.Errorf("%w: invalid cursor", models.ErrInvalidQuery)
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return fmt.Errorf("%w: malformed cursor", models.ErrInvalidQuery)
+	}
+	var p cursorPayload
+	if err := json.Unmarshal(data, &p); err != nil {
+		return fmt.Errorf("%w: malformed cursor", models.ErrInvalidQuery)
+	}
+	if p.Scope != cursorScope(*q) {
+		return fmt.Errorf("%w: cursor does not match the query", models.ErrInvalidQuery)
+	}
+	if p.Backward {
+		q.Before = &p.Key
+	} else {
+		q.After = &p.Key
+	}
+	return nil
+}
+
+func (c cursorCodec) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)[:16]
+}
+
+func cursorScope(q models.DocumentQuery) string {
+	data, _ := json.Marshal(struct {
+		Filters []models.DocumentFilter
+		Sort    []models.SortField
+	}{q.Filters, q.Sort})
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:8])
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"HttpServer/internal/models"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	c := cursorCodec{secret: []byte("secret")}
+	q := models.DocumentQuery{
+		Filters: []models.DocumentFilter{{Field: "name", Op: models.FilterPrefix, Values: []string{"rep"}}},
+		Sort:    []models.SortField{{Field: "created", Desc: true}},
+	}
+	k := &models.Keyset{Values: []string{"2024-01-01T00:00:00Z"}, ID: 42}
+	for _, backward := range []bool{false, true} {
+		cursor, err := c.encode(k, backward, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := q
+		if err := c.decode(cursor, &got); err != nil {
+			t.Fatal(err)
+		}
+		pos := got.After
+		if backward {
+			pos = got.Before
+		}
+		if !reflect.DeepEqual(pos, k) || (got.After != nil) == (got.Before != nil) {
+			t.Errorf("backward %v: decoded after %v, before %v", backward, got.After, got.Before)
+		}
+	}
+
+	if cursor, err := c.encode(nil, false, q); err != nil || cursor != "" {
+		t.Errorf("no position gave %q, %v, want no cursor", cursor, err)
+	}
+}
+
+func TestCursorRejects(t *testing.T) {
+	c := cursorCodec{secret: []byte("secret")}
+	q := models.DocumentQuery{Sort: []models.SortField{{Field: "name"}}}
+	cursor, err := c.encode(&models.Keyset{Values: []string{"a"}, ID: 1}, false, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, sig, _ := strings.Cut(cursor, ".")
+	forged, err := cursorCodec{secret: []byte("other")}.encode(&models.Keyset{Values: []string{"a"}, ID: 1}, false, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+		q      models.DocumentQuery
+	}{
+		{"no signature", payload, q},
+		{"bad signature encoding", payload + ".!!", q},
+		{"changed payload", "x" + payload + "." + sig, q},
+		{"other secret", forged, q},
+		{"other sort order", cursor, models.DocumentQuery{Sort: []models.SortField{{Field: "name", Desc: true}}}},
+		{"other filters", cursor, models.DocumentQuery{
+			Sort:    q.Sort,
+			Filters: []models.DocumentFilter{{Field: "public", Values: []string{"true"}}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := tt.q
+			if err := c.decode(tt.cursor, &q); !errors.Is(err, models.ErrInvalidQuery) {
+				t.Errorf("got error %v, want ErrInvalidQuery", err)
+			}
+			if q.After != nil || q.Before != nil {
+				t.Error("a rejected cursor set a position")
+			}
+		})
+	}
+}
@@ -3,54 +3,287 @@ package service
 import (
 	"HttpServer/internal/models"
 	"HttpServer/internal/repository"
+	"HttpServer/internal/scanner"
+	"HttpServer/internal/storage"
+	"bytes"
 	"context"
 	"fmt"
-	"os"
-	"path/filepath"
+	"io"
+	"strings"
+	"time"
 )
 
+// DocumentService is what users do with documents, folders and uploads.
 type DocumentService interface {
-	GetDocuments(ctx context.Context, token, filterLogin, key, value string, limit int) ([]models.Document, error)
+	GetDocuments(ctx context.Context, token, filterLogin string, q models.DocumentQuery) (*models.DocumentList, error)
 	GetDocumentById(ctx context.Context, token string, id int) (*models.Document, error)
+	GetPublicDocument(ctx context.Context, id int) (*models.PublicDocument, error)
 	DeleteDoc(ctx context.Context, token string, id int) (bool, error)
-	UploadDocument(ctx context.Context, doc models.Document, fileData []byte, filename string) error
+	UpdateDocument(ctx context.Context, token string, id int, patch models.DocumentPatch) (*models.Document, error)
+	UploadDocument(ctx context.Context, token string, doc models.Document, fileData []byte, filename string) (*models.Document, error)
+	TransferOwnership(ctx context.Context, token string, id int, newOwner string, keep models.Permission) error
+	Batch(ctx context.Context, token string, req models.BatchRequest) (*models.BatchReport, error)
+	ArchiveEntries(ctx context.Context, token string, req models.ArchiveRequest) ([]models.ArchiveEntry, error)
+	WriteArchive(ctx context.Context, entries []models.ArchiveEntry, w io.Writer) error
+	ImportArchive(ctx context.Context, token string, src io.Reader, opts models.ImportOptions) (*models.Job, error)
+	GetJob(ctx context.Context, token, id string) (*models.Job, error)
+	CreateUpload(ctx context.Context, token string, length int64, doc models.Document, filename, metadata string) (*models.Upload, error)
+	GetUpload(ctx context.Context, token, id string) (*models.Upload, error)
+	WriteUpload(ctx context.Context, token, id string, offset int64, chunk io.Reader, sum *models.Checksum) (*models.Upload, error)
+	DeleteUpload(ctx context.Context, token, id string) error
+	GetUsage(ctx context.Context, token string) (*models.QuotaReport, error)
+	ListNotifications(ctx context.Context, token string, unread bool) ([]models.Notification, error)
+	MarkNotificationRead(ctx context.Context, token string, id int) (bool, error)
+	SearchDocuments(ctx context.Context, token, text string, limit int) ([]models.SearchResult, error)
+	ListPublicDocuments(ctx context.Context, q models.DocumentQuery) (*models.PublicDocumentList, error)
+	UpdateContent(ctx context.Context, token string, id int, fileData []byte, filename, mime string) (*models.DocumentVersion, error)
+	ListVersions(ctx context.Context, token string, id int) ([]models.DocumentVersion, error)
+	OpenVersion(ctx context.Context, token string, id, version int) (*models.DocumentVersion, io.ReadCloser, error)
+	RestoreVersion(ctx context.Context, token string, id, version int) (*models.DocumentVersion, error)
+	ListTrash(ctx context.Context, token string) ([]models.Document, error)
+	RestoreDoc(ctx context.Context, token string, id int) (bool, error)
+	EmptyTrash(ctx context.Context, token string) (int, error)
+	ListGrants(ctx context.Context, token string, id int) ([]models.Grant, error)
+	AddGrants(ctx context.Context, token string, id int, grants []models.Grant) ([]models.Grant, error)
+	RemoveGrants(ctx context.Context, token string, id int, logins []string) ([]models.Grant, error)
+	CreateLink(ctx context.Context, token string, docID int, expiresAt *time.Time, maxDownloads *int, password string) (*models.ShareLink, error)
+	ListLinks(ctx context.Context, token string, docID int) ([]models.ShareLink, error)
+	RevokeLink(ctx context.Context, token string, docID, linkID int) (bool, error)
+	OpenShared(ctx context.Context, linkToken, password string, docID int) (*models.DocumentVersion, io.ReadCloser, error)
+	OpenThumbnail(ctx context.Context, token string, id, size int) (string, io.ReadCloser, error)
+	CreateFolder(ctx context.Context, token, name string, parentID *int) (*models.Folder, error)
+	GetFolder(ctx context.Context, token string, id int) (*models.Folder, error)
+	ListFolders(ctx context.Context, token string) ([]models.Folder, error)
+	UpdateFolder(ctx context.Context, token string, id int, change models.FolderChange) (*models.Folder, error)
+	ListFolderChildren(ctx context.Context, token string, id int, q models.DocumentQuery) (*models.FolderChildren, error)
+	MoveDocument(ctx context.Context, token string, id int, folderID *int) error
+	ResolvePath(ctx context.Context, token, path string) (*models.Folder, *models.Document, error)
+	ListFolderGrants(ctx context.Context, token string, id int) ([]models.Grant, error)
+	AddFolderGrants(ctx context.Context, token string, id int, grants []models.Grant) ([]models.Grant, error)
+	RemoveFolderGrants(ctx context.Context, token string, id int, logins []string) ([]models.Grant, error)
 }
+
+// LockService checks documents out for editing.
+type LockService interface {
+	LockDocument(ctx context.Context, token string, id int, ttl time.Duration) (*models.DocumentLock, error)
+	GetLock(ctx context.Context, token string, id int) (*models.DocumentLock, error)
+	UnlockDocument(ctx context.Context, token string, id int, force bool) (bool, error)
+}
+
+// AdminService manages quotas, retention rules and legal holds and reads
+// the audit log. Only admins may use it.
+type AdminService interface {
+	GetUserQuota(ctx context.Context, token, login string) (*models.QuotaReport, error)
+	SetUserQuota(ctx context.Context, token, login string, o models.QuotaOverride) (*models.QuotaReport, error)
+	ResetUserQuota(ctx context.Context, token, login string) (*models.QuotaReport, error)
+	ListRetentionRules(ctx context.Context, token string) ([]models.RetentionRule, error)
+	CreateRetentionRule(ctx context.Context, token string, rule models.RetentionRule) (*models.RetentionRule, error)
+	DeleteRetentionRule(ctx context.Context, token string, id int) (bool, error)
+	SetHold(ctx context.Context, token string, id int, hold models.Hold) (*models.Document, error)
+	ListAudit(ctx context.Context, token string, documentID *int, limit int) ([]models.AuditEntry, error)
+}
+
+// ScrubService checks stored content against its versions. Only admins may
+// start scrubs or read their reports.
+type ScrubService interface {
+	Scrub(ctx context.Context) (*models.ScrubReport, error)
+	StartScrub(ctx context.Context, token string) (*models.ScrubReport, error)
+	ListScrubReports(ctx context.Context, token string) ([]models.ScrubReport, error)
+	GetScrubReport(ctx context.Context, token string, id int) (*models.ScrubReport, error)
+}
+
+// MaintenanceService runs the background jobs: purges, expiry, pending
+// scans and the admin commands that rework stored documents.
+type MaintenanceService interface {
+	PurgeUploads(ctx context.Context) error
+	ExpireDocuments(ctx context.Context) error
+	ScanPending(ctx context.Context) error
+	BackfillVersions(ctx context.Context, files map[int]string) (int, []int, error)
+	PurgeTrash(ctx context.Context) error
+	RegenerateThumbnails(ctx context.Context) (int, error)
+}
+
+// DocumentServices are the APIs of the document service, which share one
+// implementation.
+type DocumentServices struct {
+	Documents   DocumentService
+	Locks       LockService
+	Admin       AdminService
+	Scrubs      ScrubService
+	Maintenance MaintenanceService
+}
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+type DocumentConfig struct {
+	// CursorSecret signs pagination cursors.
+	CursorSecret []byte
+	// MaxVersions is how many versions of a document are kept unless the
+	// document sets its own limit. Zero keeps every version.
+	MaxVersions int
+	// TrashRetention is how long deleted documents stay in the trash.
+	TrashRetention time.Duration
+	// UploadPolicies are the upload policies by user role. Roles without
+	// one get DefaultUploadPolicy.
+	UploadPolicies      map[string]UploadPolicy
+	DefaultUploadPolicy UploadPolicy
+	// ThumbnailSizes are the bounding boxes, in pixels, of the thumbnails
+	// made of image uploads.
+	ThumbnailSizes []int
+	// Import limits archive imports.
+	Import    ImportLimits
+	Resumable ResumableConfig
+	// Quotas are the quotas by user role. Roles without one get
+	// DefaultQuota.
+	Quotas       map[string]models.Quota
+	DefaultQuota models.Quota
+	Retention    RetentionConfig
+	Integrity    IntegrityConfig
+	Scan         ScanConfig
+	Lock         LockConfig
+}
+
+// DocumentDeps are the stores and services the document service works
+// with. Without a Scanner, uploads stay pending.
+type DocumentDeps struct {
+	Documents     repository.DocumentRepository
+	Links         repository.LinkRepository
+	Folders       repository.FolderRepository
+	Jobs          repository.JobRepository
+	Uploads       repository.UploadRepository
+	Quotas        repository.QuotaRepository
+	Notifications repository.NotificationRepository
+	Scrubs        repository.ScrubRepository
+	Locks         repository.LockRepository
+	Auth          AuthService
+	Storage       storage.Storage
+	Scanner       scanner.Scanner
+}
+
 type dockserv struct {
 	docsRepository repository.DocumentRepository
+	links          repository.LinkRepository
+	folders        repository.FolderRepository
+	jobs           repository.JobRepository
+	uploads        repository.UploadRepository
+	quotas         repository.QuotaRepository
+	notifications  repository.NotificationRepository
+	scrubs         repository.ScrubRepository
+	locks          repository.LockRepository
 	authService    AuthService
+	storage        storage.Storage
+	scanner        scanner.Scanner
+	cursors        cursorCodec
+	cfg            DocumentConfig
 }
 
-func NewDocumentService(repo repository.DocumentRepository, auth AuthService) DocumentService {
-	return &dockserv{
-		docsRepository: repo,
-		authService:    auth,
+func NewDocumentServices(deps DocumentDeps, cfg DocumentConfig) DocumentServices {
+	s := &dockserv{
+		docsRepository: deps.Documents,
+		links:          deps.Links,
+		folders:        deps.Folders,
+		jobs:           deps.Jobs,
+		uploads:        deps.Uploads,
+		quotas:         deps.Quotas,
+		notifications:  deps.Notifications,
+		scrubs:         deps.Scrubs,
+		locks:          deps.Locks,
+		authService:    deps.Auth,
+		storage:        deps.Storage,
+		scanner:        deps.Scanner,
+		cursors:        cursorCodec{secret: cfg.CursorSecret},
+		cfg:            cfg,
 	}
+	return DocumentServices{Documents: s, Locks: s, Admin: s, Scrubs: s, Maintenance: s}
 }
 
-func (s *dockserv) GetDocuments(ctx context.Context, token string, filterLogin string, key string, value string, limit int) ([]models.Document, error) {
+// GetDocuments lists the documents the caller owns or may view. Admins may
+// list those of another user by passing filterLogin.
+func (s *dockserv) GetDocuments(ctx context.Context, token string, filterLogin string, q models.DocumentQuery) (*models.DocumentList, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if filterLogin != "" && filterLogin != login {
+		if _, err := s.requireAdmin(ctx, token); err != nil {
+			return nil, err
+		}
+		login = filterLogin
+	}
+	return s.listPage(q, func(q models.DocumentQuery) (*models.DocumentPage, error) {
+		return s.docsRepository.FindDocuments(ctx, login, login, q)
+	})
+}
 
-	var ownerLogin string
-	if filterLogin == "" {
-		var err error
-		ownerLogin, err = s.authService.GetLoginFromToken(ctx, token)
-		if err != nil {
+// ListPublicDocuments lists the public projections of public documents.
+// Filters on what the projection leaves out are refused, as they would let
+// anyone probe it.
+func (s *dockserv) ListPublicDocuments(ctx context.Context, q models.DocumentQuery) (*models.PublicDocumentList, error) {
+	for _, f := range q.Filters {
+		if f.Field == "grantee" || f.Field == "folder" || strings.HasPrefix(f.Field, models.MetaFieldPrefix) {
+			return nil, fmt.Errorf("%w: public documents cannot be filtered by %s", models.ErrInvalidQuery, f.Field)
+		}
+	}
+	list, err := s.listPage(q, func(q models.DocumentQuery) (*models.DocumentPage, error) {
+		return s.docsRepository.FindPublicDocuments(ctx, q)
+	})
+	if err != nil {
+		return nil, err
+	}
+	public := &models.PublicDocumentList{
+		Docs:       make([]models.PublicDocument, len(list.Docs)),
+		NextCursor: list.NextCursor,
+		PrevCursor: list.PrevCursor,
+		Total:      list.Total,
+	}
+	for i, doc := range list.Docs {
+		public.Docs[i] = doc.PublicView()
+	}
+	return public, nil
+}
+
+// listPage applies the page size limits and the cursor of q, fetches the
+// page and turns its keysets into opaque cursors.
+func (s *dockserv) listPage(q models.DocumentQuery, fetch func(q models.DocumentQuery) (*models.DocumentPage, error)) (*models.DocumentList, error) {
+	if q.Limit <= 0 {
+		q.Limit = defaultPageSize
+	}
+	if q.Limit > maxPageSize {
+		q.Limit = maxPageSize
+	}
+	if q.Cursor != "" {
+		if err := s.cursors.decode(q.Cursor, &q); err != nil {
 			return nil, err
 		}
-		filterLogin = ownerLogin
-	} else {
-		ownerLogin = filterLogin
 	}
-	docs, err := s.docsRepository.FindDocuments(ctx, ownerLogin, filterLogin, key, value, limit)
+	page, err := fetch(q)
 	if err != nil {
 		return nil, err
 	}
-	return docs, nil
+	next, err := s.cursors.encode(page.Next, false, q)
+	if err != nil {
+		return nil, err
+	}
+	prev, err := s.cursors.encode(page.Prev, true, q)
+	if err != nil {
+		return nil, err
+	}
+	return &models.DocumentList{
+		Docs:       page.Docs,
+		NextCursor: next,
+		PrevCursor: prev,
+		Total:      page.Total,
+	}, nil
 }
-func (s *dockserv) GetDocumentById(ctx context.Context, token string, id int) (*models.Document, error) {
 
-	login, err := s.authService.GetLoginFromToken(ctx, token)
+// GetDocumentById returns a document the caller has access to.
+func (s *dockserv) GetDocumentById(ctx context.Context, token string, id int) (*models.Document, error) {
+	login, err := s.login(ctx, token)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get login from token: %w", err)
+		return nil, err
 	}
 	doc, err := s.docsRepository.FindDocumentByID(ctx, login, id)
 	if err != nil {
@@ -58,10 +291,19 @@ func (s *dockserv) GetDocumentById(ctx context.Context, token string, id int) (*
 	}
 	return doc, nil
 }
+
+// GetPublicDocument returns the public projection of a public document to
+// anyone, including callers without a token.
+func (s *dockserv) GetPublicDocument(ctx context.Context, id int) (*models.PublicDocument, error) {
+	return s.docsRepository.FindPublicDocumentByID(ctx, id)
+}
 func (s *dockserv) DeleteDoc(ctx context.Context, token string, id int) (bool, error) {
-	login, err := s.authService.GetLoginFromToken(ctx, token)
+	login, err := s.login(ctx, token)
 	if err != nil {
-		return false, fmt.Errorf("failed to get login from token: %w", err)
+		return false, err
+	}
+	if err := s.checkLock(ctx, login, id); err != nil {
+		return false, err
 	}
 	st, err := s.docsRepository.DeleteDoc(ctx, login, id)
 	if err != nil {
@@ -69,15 +311,139 @@ func (s *dockserv) DeleteDoc(ctx context.Context, token string, id int) (bool, e
 	}
 	return st, nil
 }
-func (s *dockserv) UploadDocument(ctx context.Context, doc models.Document, fileData []byte, filename string) error {
-	savePath := filepath.Join("uploads", filename)
-	if err := os.WriteFile(savePath, fileData, 0644); err != nil {
-		return fmt.Errorf("failed to save file: %w", err)
+
+// UpdateDocument renames a document and changes its tags and metadata.
+func (s *dockserv) UpdateDocument(ctx context.Context, token string, id int, patch models.DocumentPatch) (*models.Document, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if patch.Name == nil && patch.Tags == nil && patch.Metadata == nil && !patch.ExpiresAt.Set {
+		return nil, fmt.Errorf("%w: nothing to change", models.ErrInvalidQuery)
+	}
+	if err := checkExpiry(patch.ExpiresAt.Time); err != nil {
+		return nil, err
+	}
+	if patch.Name != nil && strings.TrimSpace(*patch.Name) == "" {
+		return nil, fmt.Errorf("%w: empty name", models.ErrInvalidQuery)
+	}
+	if patch.Tags != nil {
+		tags, err := models.NormalizeTags(*patch.Tags)
+		if err != nil {
+			return nil, err
+		}
+		patch.Tags = &tags
+	}
+	if err := models.ValidateMetadata(patch.Metadata, true); err != nil {
+		return nil, err
+	}
+	if err := s.checkLock(ctx, login, id); err != nil {
+		return nil, err
+	}
+	return s.docsRepository.UpdateDocument(ctx, login, id, patch)
+}
+
+// UploadDocument stores a new document owned by the caller.
+func (s *dockserv) UploadDocument(ctx context.Context, token string, doc models.Document, fileData []byte, filename string) (*models.Document, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return s.uploadAs(ctx, login, doc, bytes.NewReader(fileData), int64(len(fileData)), filename)
+}
+
+// uploadAs stores size bytes of content as a new document owned by login.
+func (s *dockserv) uploadAs(ctx context.Context, login string, doc models.Document, content io.ReadSeeker, size int64, filename string) (*models.Document, error) {
+	tags, err := models.NormalizeTags(doc.Tags)
+	if err != nil {
+		return nil, err
+	}
+	doc.Tags = tags
+	if err := models.ValidateMetadata(doc.Metadata, false); err != nil {
+		return nil, err
+	}
+	if doc.Metadata == nil {
+		doc.Metadata = map[string]interface{}{}
+	}
+	if err := checkExpiry(doc.ExpiresAt); err != nil {
+		return nil, err
+	}
+	if err := s.checkUploadGrantees(ctx, login, doc.Grant); err != nil {
+		return nil, err
+	}
+	head, err := readHead(content)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Mime, err = s.checkUpload(ctx, login, head, filename, doc.Mime); err != nil {
+		return nil, err
+	}
+	quota, err := s.quotaFor(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkFileSize(quota, size); err != nil {
+		return nil, err
+	}
+	v, err := s.storeBlob(ctx, content, filename, doc.Mime, login)
+	if err != nil {
+		return nil, err
 	}
+	doc.Owner = login
 	doc.File = true
+	if doc.Content, err = readText(content, doc.Mime, filename); err != nil {
+		s.deleteBlobs(ctx, []string{v.StorageKey})
+		return nil, err
+	}
 
-	if err := s.docsRepository.SaveDocument(ctx, doc); err != nil {
+	id, err := s.docsRepository.SaveDocument(ctx, doc, *v, quota)
+	if err != nil {
+		s.deleteBlobs(ctx, []string{v.StorageKey})
+		return nil, err
+	}
+	doc.ID, doc.Version = id, 1
+	return &doc, nil
+}
+
+// TransferOwnership makes another existing user the owner of a document.
+// Only the current owner may do this.
+func (s *dockserv) TransferOwnership(ctx context.Context, token string, id int, newOwner string, keep models.Permission) error {
+	login, err := s.login(ctx, token)
+	if err != nil {
 		return err
 	}
-	return nil
+	if newOwner == "" || newOwner == login {
+		return fmt.Errorf("%w: a new owner is required", models.ErrInvalidQuery)
+	}
+	if keep != "" && (!keep.Valid() || keep == models.PermOwner) {
+		return fmt.Errorf("%w: invalid permission %q", models.ErrInvalidQuery, keep)
+	}
+	exists, err := s.authService.UserExists(ctx, newOwner)
+	if err != nil {
+		return fmt.Errorf("failed to check user %s: %w", newOwner, err)
+	}
+	if !exists {
+		return fmt.Errorf("%w: user %s does not exist", models.ErrInvalidQuery, newOwner)
+	}
+	if err := s.checkLock(ctx, login, id); err != nil {
+		return err
+	}
+	return s.docsRepository.TransferOwnership(ctx, login, id, newOwner, keep)
+}
+
+func (s *dockserv) SearchDocuments(ctx context.Context, token, text string, limit int) ([]models.SearchResult, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, fmt.Errorf("%w: empty search query", models.ErrInvalidQuery)
+	}
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	return s.docsRepository.SearchDocuments(ctx, login, text, limit)
 }
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"HttpServer/internal/models"
+	"HttpServer/internal/repository"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// publicDocs is a repository with a single page of public documents.
+type publicDocs struct {
+	repository.DocumentRepository
+	docs []models.Document
+}
+
+func (p publicDocs) FindPublicDocuments(context.Context, models.DocumentQuery) (*models.DocumentPage, error) {
+	return &models.DocumentPage{Docs: p.docs}, nil
+}
+
+func TestListPublicDocuments(t *testing.T) {
+	folder := 7
+	s := &dockserv{docsRepository: publicDocs{docs: []models.Document{{
+		ID:        1,
+		Name:      "report.pdf",
+		Public:    true,
+		Owner:     "alice",
+		Grant:     []string{"bob"},
+		Tags:      []string{"q1"},
+		Metadata:  map[string]interface{}{"customer": "acme"},
+		FolderID:  &folder,
+		LegalHold: true,
+	}}}}
+
+	list, err := s.ListPublicDocuments(context.Background(), models.DocumentQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Docs) != 1 || list.Docs[0].ID != 1 || list.Docs[0].Owner != "alice" {
+		t.Fatalf("got %+v", list.Docs)
+	}
+	data, err := json.Marshal(list.Docs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, hidden := range []string{"grant", "bob", "metadata", "acme", "folder_id", "legal_hold"} {
+		if strings.Contains(string(data), hidden) {
+			t.Errorf("public projection %s shows %q", data, hidden)
+		}
+	}
+
+	for _, field := range []string{"grantee", "folder", "meta.customer"} {
+		q := models.DocumentQuery{Filters: []models.DocumentFilter{{Field: field, Values: []string{"x"}}}}
+		if _, err := s.ListPublicDocuments(context.Background(), q); !errors.Is(err, models.ErrInvalidQuery) {
+			t.Errorf("filter on %s: got %v, want ErrInvalidQuery", field, err)
+		}
+	}
+}
+
+// knownUsers is an AuthService that knows a fixed set of users.
+type knownUsers struct {
+	AuthService
+	users []string
+}
+
+func (k knownUsers) UserExists(_ context.Context, login string) (bool, error) {
+	for _, u := range k.users {
+		if u == login {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func TestUploadChecksGrantees(t *testing.T) {
+	s := &dockserv{authService: knownUsers{users: []string{"alice", "bob"}}}
+	for _, grant := range [][]string{{"mallory"}, {"bob", "mallory"}, {"alice"}} {
+		doc := models.Document{Name: "a.txt", Grant: grant}
+		_, err := s.uploadAs(context.Background(), "alice", doc, strings.NewReader("hello"), 5, "a.txt")
+		if !errors.Is(err, models.ErrInvalidQuery) {
+			t.Errorf("grant to %v: got %v, want ErrInvalidQuery", grant, err)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxExtractedText caps how much text of a single file goes into the search
+// index.
+const maxExtractedText = 1 << 20
+
+var (
+	htmlSkipRe = regexp.MustCompile(`(?is)<(script|style)[^>]*>.*?</(script|style)>`)
+	htmlTagRe  = regexp.MustCompile(`(?s)<[^>]*>`)
+	spacesRe   = regexp.MustCompile(`\s+`)
+)
+
+// maxExtractSource is how much of a file is read to extract its text.
+const maxExtractSource = 4 * maxExtractedText
+
+// readText extracts the searchable text of content from its start. Only the
+// first maxExtractSource bytes of long files are indexed.
+func readText(content io.ReadSeeker, mimeType, filename string) (string, error) {
+	if textFormat(mimeType, filename) == "" {
+		return "", nil
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	data, err := io.ReadAll(io.LimitReader(content, maxExtractSource))
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	if len(data) == maxExtractSource {
+		// do not let a rune cut in half make the text look binary
+		for i := 0; i < utf8.UTFMax && !utf8.Valid(data); i++ {
+			data = data[:len(data)-1]
+		}
+	}
+	return extractText(mimeType, filename, data), nil
+}
+
+// extractText returns the searchable text of a file, or an empty string for
+// formats it does not understand.
+func extractText(mimeType, filename string, data []byte) string {
+	if !utf8.Valid(data) {
+		return ""
+	}
+	var text string
+	switch textFormat(mimeType, filename) {
+	case "html":
+		text = htmlSkipRe.ReplaceAllString(string(data), " ")
+		text = html.UnescapeString(htmlTagRe.ReplaceAllString(text, " "))
+	case "csv":
+		text = extractCSV(data)
+	case "json":
+		text = extractJSON(data)
+	case "text":
+		text = string(data)
+	default:
+		return ""
+	}
+	text = strings.TrimSpace(spacesRe.ReplaceAllString(text, " "))
+	if len(text) > maxExtractedText {
+		text = text[:maxExtractedText]
+		for !utf8.ValidString(text) {
+			text = text[:len(text)-1]
+		}
+	}
+	return text
+}
+
+func textFormat(mimeType, filename string) string {
+	mediaType, _, _ := mime.ParseMediaType(mimeType)
+	switch mediaType {
+	case "text/html", "application/xhtml+xml":
+		return "html"
+	case "text/csv":
+		return "csv"
+	case "application/json":
+		return "json"
+	case "text/plain", "text/markdown", "text/x-markdown":
+		return "text"
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".html", ".htm":
+		return "html"
+	case ".csv":
+		return "csv"
+	case ".json":
+		return "json"
+	case ".txt", ".md", ".markdown":
+		return "text"
+	}
+	return ""
+}
+
+func extractCSV(data []byte) string {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	var sb strings.Builder
+	for {
+		record, err := r.Read()
+		if err != nil {
+			break
+		}
+		sb.WriteString(strings.Join(record, " "))
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+func extractJSON(data []byte) string {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return ""
+	}
+	var sb strings.Builder
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, item := range v {
+				sb.WriteString(k)
+				sb.WriteByte(' ')
+				walk(item)
+			}
+		case []interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		case string:
+			sb.WriteString(v)
+			sb.WriteByte(' ')
+		}
+	}
+	walk(v)
+	return sb.String()
+}
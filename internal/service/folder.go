@@ -0,0 +1,151 @@
+package service
+
+import (
+	"HttpServer/internal/models"
+	"context"
+	"fmt"
+	"strings"
+)
+
+func validFolderName(name string) error {
+	if strings.TrimSpace(name) == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("%w: invalid folder name %q", models.ErrInvalidQuery, name)
+	}
+	return nil
+}
+
+func (s *dockserv) CreateFolder(ctx context.Context, token, name string, parentID *int) (*models.Folder, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if err := validFolderName(name); err != nil {
+		return nil, err
+	}
+	return s.folders.CreateFolder(ctx, login, models.Folder{Name: name, ParentID: parentID})
+}
+
+func (s *dockserv) GetFolder(ctx context.Context, token string, id int) (*models.Folder, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return s.folders.FindFolder(ctx, login, id)
+}
+
+// ListFolders lists the caller's top-level and shared folders.
+func (s *dockserv) ListFolders(ctx context.Context, token string) ([]models.Folder, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return s.folders.ListFolders(ctx, login, nil)
+}
+
+func (s *dockserv) UpdateFolder(ctx context.Context, token string, id int, change models.FolderChange) (*models.Folder, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if change.Name == nil && change.ParentID == nil {
+		return nil, fmt.Errorf("%w: nothing to change", models.ErrInvalidQuery)
+	}
+	if change.Name != nil {
+		if err := validFolderName(*change.Name); err != nil {
+			return nil, err
+		}
+	}
+	return s.folders.UpdateFolder(ctx, login, id, change)
+}
+
+// ListFolderChildren returns a page of the documents in a folder. The
+// subfolders come with the first page only.
+func (s *dockserv) ListFolderChildren(ctx context.Context, token string, id int, q models.DocumentQuery) (*models.FolderChildren, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	folder, err := s.folders.FindFolder(ctx, login, id)
+	if err != nil {
+		return nil, err
+	}
+	children := &models.FolderChildren{Folder: *folder}
+	if q.Cursor == "" {
+		if children.Folders, err = s.folders.ListFolders(ctx, login, &id); err != nil {
+			return nil, err
+		}
+	}
+	children.Docs, err = s.listPage(q, func(q models.DocumentQuery) (*models.DocumentPage, error) {
+		return s.folders.FindFolderDocuments(ctx, login, id, q)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return children, nil
+}
+
+// MoveDocument puts a document into a folder. A nil or zero folderID moves
+// it back to the top level.
+func (s *dockserv) MoveDocument(ctx context.Context, token string, id int, folderID *int) error {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return err
+	}
+	if folderID != nil && *folderID == 0 {
+		folderID = nil
+	}
+	if err := s.checkLock(ctx, login, id); err != nil {
+		return err
+	}
+	return s.folders.MoveDocument(ctx, login, id, folderID)
+}
+
+// ResolvePath looks up a slash separated path such as reports/2024/q1.pdf
+// starting from the caller's top-level folders. Exactly one of the returned
+// folder and document is set.
+func (s *dockserv) ResolvePath(ctx context.Context, token, path string) (*models.Folder, *models.Document, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return nil, nil, err
+	}
+	var names []string
+	for _, name := range strings.Split(path, "/") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil, fmt.Errorf("%w: empty path", models.ErrInvalidQuery)
+	}
+	return s.folders.ResolvePath(ctx, login, names)
+}
+
+func (s *dockserv) ListFolderGrants(ctx context.Context, token string, id int) ([]models.Grant, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return s.folders.ListFolderGrants(ctx, login, id)
+}
+
+func (s *dockserv) AddFolderGrants(ctx context.Context, token string, id int, grants []models.Grant) ([]models.Grant, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkGrantees(ctx, login, grants); err != nil {
+		return nil, err
+	}
+	return s.folders.AddFolderGrants(ctx, login, id, grants)
+}
+
+func (s *dockserv) RemoveFolderGrants(ctx context.Context, token string, id int, logins []string) ([]models.Grant, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if len(logins) == 0 {
+		return nil, fmt.Errorf("%w: no logins given", models.ErrInvalidQuery)
+	}
+	return s.folders.RemoveFolderGrants(ctx, login, id, logins)
+}
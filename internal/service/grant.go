@@ -0,0 +1,77 @@
+package service
+
+import (
+	"HttpServer/internal/models"
+	"context"
+	"fmt"
+)
+
+func (s *dockserv) ListGrants(ctx context.Context, token string, id int) ([]models.Grant, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return s.docsRepository.ListGrants(ctx, login, id)
+}
+
+func (s *dockserv) AddGrants(ctx context.Context, token string, id int, grants []models.Grant) ([]models.Grant, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkGrantees(ctx, login, grants); err != nil {
+		return nil, err
+	}
+	if err := s.checkLock(ctx, login, id); err != nil {
+		return nil, err
+	}
+	return s.docsRepository.AddGrants(ctx, login, id, grants)
+}
+
+func (s *dockserv) RemoveGrants(ctx context.Context, token string, id int, logins []string) ([]models.Grant, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if len(logins) == 0 {
+		return nil, fmt.Errorf("%w: no logins given", models.ErrInvalidQuery)
+	}
+	if err := s.checkLock(ctx, login, id); err != nil {
+		return nil, err
+	}
+	return s.docsRepository.RemoveGrants(ctx, login, id, logins)
+}
+
+// checkGrantees makes sure every grant names an existing user other than the
+// caller.
+func (s *dockserv) checkGrantees(ctx context.Context, login string, grants []models.Grant) error {
+	if len(grants) == 0 {
+		return fmt.Errorf("%w: no grants given", models.ErrInvalidQuery)
+	}
+	for _, g := range grants {
+		if g.Login == login {
+			return fmt.Errorf("%w: cannot change your own grant", models.ErrInvalidQuery)
+		}
+		exists, err := s.authService.UserExists(ctx, g.Login)
+		if err != nil {
+			return fmt.Errorf("failed to check user %s: %w", g.Login, err)
+		}
+		if !exists {
+			return fmt.Errorf("%w: user %s does not exist", models.ErrInvalidQuery, g.Login)
+		}
+	}
+	return nil
+}
+
+// checkUploadGrantees is checkGrantees for the logins listed at upload,
+// which get download permission.
+func (s *dockserv) checkUploadGrantees(ctx context.Context, login string, logins []string) error {
+	if len(logins) == 0 {
+		return nil
+	}
+	grants := make([]models.Grant, len(logins))
+	for i, l := range logins {
+		grants[i] = models.Grant{Login: l, Permission: models.PermDownload}
+	}
+	return s.checkGrantees(ctx, login, grants)
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"HttpServer/internal/models"
+	"context"
+	"fmt"
+	"time"
+)
+
+// SetHold places a document under legal hold or makes it immutable for a
+// while, or releases a legal hold. Only admins may do this.
+func (s *dockserv) SetHold(ctx context.Context, token string, id int, hold models.Hold) (*models.Document, error) {
+	login, err := s.requireAdmin(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if hold.LegalHold == nil && hold.ImmutableUntil == nil {
+		return nil, fmt.Errorf("%w: legal_hold or immutable_until required", models.ErrInvalidQuery)
+	}
+	if hold.ImmutableUntil != nil && !hold.ImmutableUntil.After(time.Now()) {
+		return nil, fmt.Errorf("%w: immutable_until must be in the future", models.ErrInvalidQuery)
+	}
+	return s.docsRepository.SetHold(ctx, login, id, hold)
+}
+
+// ListAudit returns the latest audit entries, of one document if documentID
+// is set. Only admins may do this.
+func (s *dockserv) ListAudit(ctx context.Context, token string, documentID *int, limit int) ([]models.AuditEntry, error) {
+	if _, err := s.requireAdmin(ctx, token); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	return s.docsRepository.ListAudit(ctx, documentID, limit)
+}
@@ -0,0 +1,396 @@
+package service
+
+import (
+	"HttpServer/internal/models"
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// ImportLimits bound the work an uploaded archive can cause, whatever its
+// headers claim.
+type ImportLimits struct {
+	// MaxArchiveSize is the size of the uploaded archive itself.
+	MaxArchiveSize int64
+	MaxEntries     int
+	MaxEntrySize   int64
+	// MaxTotalSize is the size of all entries together once unpacked.
+	MaxTotalSize int64
+	// MaxRatio is the highest compression ratio accepted for an entry of
+	// more than a megabyte.
+	MaxRatio int64
+}
+
+var errUnsafePath = errors.New("unsafe path")
+
+// archiveEntry is a regular file of an archive.
+type archiveEntry struct {
+	name       string
+	compressed int64 // zero when unknown
+	r          io.Reader
+}
+
+// ImportArchive stores the uploaded ZIP or tar.gz and expands it into
+// documents in the background. The returned job can be polled with GetJob.
+func (s *dockserv) ImportArchive(ctx context.Context, token string, src io.Reader, opts models.ImportOptions) (*models.Job, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Tags, err = models.NormalizeTags(opts.Tags); err != nil {
+		return nil, err
+	}
+	if len(opts.Grants) > 0 {
+		if err := s.checkGrantees(ctx, login, opts.Grants); err != nil {
+			return nil, err
+		}
+	}
+	if opts.FolderID != nil {
+		if _, err := s.folders.FindFolder(ctx, login, *opts.FolderID); err != nil {
+			return nil, err
+		}
+	}
+
+	tmp, err := os.CreateTemp("", "import-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to store archive: %w", err)
+	}
+	n, err := io.Copy(tmp, io.LimitReader(src, s.cfg.Import.MaxArchiveSize+1))
+	if err == nil && n > s.cfg.Import.MaxArchiveSize {
+		err = fmt.Errorf("%w: the archive is larger than %d bytes", models.ErrInvalidQuery, s.cfg.Import.MaxArchiveSize)
+	}
+	if err == nil {
+		err = checkArchiveFormat(tmp)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate job id: %w", err)
+	}
+	job := &models.Job{
+		ID:        hex.EncodeToString(id),
+		Kind:      "import",
+		Owner:     login,
+		Status:    models.JobPending,
+		Documents: []int{},
+		Created:   time.Now(),
+	}
+	if err := s.jobs.SaveJob(ctx, job); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, fmt.Errorf("failed to create job: %w", err)
+	}
+
+	// The job is updated by the import from now on.
+	started := *job
+	go func() {
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+		s.runImport(context.WithoutCancel(ctx), job, tmp, opts)
+	}()
+	return &started, nil
+}
+
+// GetJob returns a job started by the caller.
+func (s *dockserv) GetJob(ctx context.Context, token, id string) (*models.Job, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	job, err := s.jobs.FindJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Owner != login {
+		return nil, models.ErrNotFound
+	}
+	return job, nil
+}
+
+func checkArchiveFormat(f *os.File) error {
+	magic := make([]byte, 4)
+	if _, err := f.ReadAt(magic, 0); err != nil {
+		return fmt.Errorf("%w: not a ZIP or tar.gz archive", models.ErrUnsupported)
+	}
+	if !bytes.HasPrefix(magic, []byte("PK\x03\x04")) && !bytes.HasPrefix(magic, []byte{0x1f, 0x8b}) {
+		return fmt.Errorf("%w: not a ZIP or tar.gz archive", models.ErrUnsupported)
+	}
+	return nil
+}
+
+func (s *dockserv) runImport(ctx context.Context, job *models.Job, f *os.File, opts models.ImportOptions) {
+	job.Status = models.JobRunning
+	s.saveJob(ctx, job)
+
+	folders := map[string]*int{"": opts.FolderID}
+	var total int64
+	err := walkArchive(f, s.cfg.Import, func(total int) {
+		job.Total = total
+	}, func(e archiveEntry) error {
+		if skipEntry(e.name) {
+			if job.Total > 0 {
+				job.Total--
+			}
+			return nil
+		}
+		if job.Processed >= s.cfg.Import.MaxEntries {
+			return fmt.Errorf("the archive has more than %d files", s.cfg.Import.MaxEntries)
+		}
+		job.Processed++
+		data, err := readEntry(e, s.cfg.Import)
+		if err == nil {
+			if total += int64(len(data)); total > s.cfg.Import.MaxTotalSize {
+				return fmt.Errorf("the archive unpacks to more than %d bytes", s.cfg.Import.MaxTotalSize)
+			}
+			var doc *models.Document
+			if doc, err = s.importEntry(ctx, job.Owner, e.name, data, opts, folders); err == nil {
+				job.Documents = append(job.Documents, doc.ID)
+			}
+		}
+		if err != nil {
+			job.Failed++
+			job.Errors = append(job.Errors, models.JobError{Item: e.name, Error: err.Error()})
+		}
+		s.saveJob(ctx, job)
+		return nil
+	})
+	if err != nil {
+		job.Status, job.Error = models.JobFailed, err.Error()
+	} else {
+		job.Status = models.JobDone
+	}
+	s.saveJob(ctx, job)
+}
+
+func (s *dockserv) saveJob(ctx context.Context, job *models.Job) {
+	if err := s.jobs.SaveJob(ctx, job); err != nil {
+		log.Printf("failed to save job %s: %v", job.ID, err)
+	}
+}
+
+// skipEntry reports whether an entry is metadata added by the archiver,
+// such as macOS resource forks, rather than a file of the user.
+func skipEntry(name string) bool {
+	name = strings.ReplaceAll(name, `\`, "/")
+	base := path.Base(name)
+	return base == ".DS_Store" || strings.HasPrefix(base, "._") ||
+		name == "__MACOSX" || strings.HasPrefix(name, "__MACOSX/")
+}
+
+// importEntry turns one archive entry into a document.
+func (s *dockserv) importEntry(ctx context.Context, login, name string, data []byte, opts models.ImportOptions, folders map[string]*int) (*models.Document, error) {
+	dirs, base, err := importPath(name)
+	if err != nil {
+		return nil, err
+	}
+	folderID := opts.FolderID
+	if opts.KeepFolders {
+		if folderID, err = s.importFolder(ctx, login, dirs, folders); err != nil {
+			return nil, err
+		}
+	}
+	doc := models.Document{
+		Name:     base,
+		Public:   opts.Public,
+		FolderID: folderID,
+		Tags:     opts.Tags,
+	}
+	saved, err := s.uploadAs(ctx, login, doc, bytes.NewReader(data), int64(len(data)), base)
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.Grants) > 0 {
+		if _, err := s.docsRepository.AddGrants(ctx, login, saved.ID, opts.Grants); err != nil {
+			return saved, fmt.Errorf("document %d was created but not shared: %w", saved.ID, err)
+		}
+	}
+	return saved, nil
+}
+
+// importFolder returns the folder for the directories of an entry, creating
+// the missing ones. folders caches what was resolved already.
+func (s *dockserv) importFolder(ctx context.Context, login string, dirs []string, folders map[string]*int) (*int, error) {
+	for i := range dirs {
+		key := strings.Join(dirs[:i+1], "/")
+		if _, ok := folders[key]; ok {
+			continue
+		}
+		if err := validFolderName(dirs[i]); err != nil {
+			return nil, err
+		}
+		f, err := s.folders.EnsureFolder(ctx, login, folders[strings.Join(dirs[:i], "/")], dirs[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to create folder %s: %w", key, err)
+		}
+		folders[key] = &f.ID
+	}
+	return folders[strings.Join(dirs, "/")], nil
+}
+
+// importPath splits an entry name into its directories and base name,
+// refusing names that would escape the target, the zip-slip attack.
+func importPath(name string) ([]string, string, error) {
+	name = strings.ReplaceAll(name, `\`, "/")
+	if strings.HasPrefix(name, "/") || len(name) > 1 && name[1] == ':' {
+		return nil, "", errUnsafePath
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return nil, "", errUnsafePath
+		}
+	}
+	clean := path.Clean(name)
+	if clean == "." || clean == "" {
+		return nil, "", errUnsafePath
+	}
+	parts := strings.Split(clean, "/")
+	return parts[:len(parts)-1], parts[len(parts)-1], nil
+}
+
+// readEntry reads an entry, never more than the size limit, and rejects
+// entries that decompress suspiciously well.
+func readEntry(e archiveEntry, limits ImportLimits) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(e.r, limits.MaxEntrySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read entry: %w", err)
+	}
+	size := int64(len(data))
+	if size > limits.MaxEntrySize {
+		return nil, fmt.Errorf("the file is larger than %d bytes", limits.MaxEntrySize)
+	}
+	if e.compressed > 0 && size > 1<<20 && size/e.compressed > limits.MaxRatio {
+		return nil, fmt.Errorf("the file is compressed suspiciously well")
+	}
+	return data, nil
+}
+
+// tarHeaderSize bounds what a tar archive adds to the content of an entry:
+// its header, an extended header and the padding to the next block.
+const tarHeaderSize = 4 << 10
+
+// walkArchive calls fn for every regular file of a ZIP or tar.gz archive.
+// For ZIP archives the number of files is known up front and passed to
+// total first. A tar.gz archive is a single stream that is decompressed to
+// skip entries as well, so every entry counts against the limits, not only
+// the files passed to fn.
+func walkArchive(f *os.File, limits ImportLimits, total func(int), fn func(archiveEntry) error) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	magic := make([]byte, 2)
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(bufio.NewReader(f))
+		if err != nil {
+			return fmt.Errorf("invalid gzip stream: %w", err)
+		}
+		defer gz.Close()
+		limit := limits.MaxTotalSize + int64(limits.MaxEntries+1)*tarHeaderSize
+		tooLarge := fmt.Errorf("the archive unpacks to more than %d bytes", limits.MaxTotalSize)
+		tr := tar.NewReader(&limitedReader{r: gz, n: limit, err: tooLarge})
+		for entries := 0; ; entries++ {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if errors.Is(err, tooLarge) {
+				return err
+			}
+			if err != nil {
+				return fmt.Errorf("invalid tar archive: %w", err)
+			}
+			if entries >= limits.MaxEntries {
+				return fmt.Errorf("the archive has more than %d entries", limits.MaxEntries)
+			}
+			if hdr.Typeflag != tar.TypeReg {
+				continue
+			}
+			if err := fn(archiveEntry{name: hdr.Name, r: tr}); err != nil {
+				return err
+			}
+		}
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(f, info.Size())
+	if err != nil {
+		return fmt.Errorf("invalid zip archive: %w", err)
+	}
+	var files []*zip.File
+	for _, zf := range zr.File {
+		if zf.Mode().IsRegular() {
+			files = append(files, zf)
+		}
+	}
+	total(len(files))
+	for _, zf := range files {
+		rc, err := zf.Open()
+		if err != nil {
+			if err := fn(archiveEntry{name: zf.Name, r: errReader{err}}); err != nil {
+				return err
+			}
+			continue
+		}
+		err = fn(archiveEntry{name: zf.Name, compressed: max(int64(zf.CompressedSize64), 1), r: rc})
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// limitedReader reads at most n bytes from r and fails with err after them,
+// unlike io.LimitReader, which ends as if the stream did.
+type limitedReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		return 0, l.err
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
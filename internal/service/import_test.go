@@ -0,0 +1,202 @@
+package service
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestImportPath(t *testing.T) {
+	tests := []struct {
+		name string
+		dirs []string
+		base string
+	}{
+		{"report.pdf", []string{}, "report.pdf"},
+		{"a/b/report.pdf", []string{"a", "b"}, "report.pdf"},
+		{`a\b\report.pdf`, []string{"a", "b"}, "report.pdf"},
+		{"./a//report.pdf", []string{"a"}, "report.pdf"},
+	}
+	for _, tt := range tests {
+		dirs, base, err := importPath(tt.name)
+		if err != nil {
+			t.Errorf("importPath(%q): %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(dirs, tt.dirs) || base != tt.base {
+			t.Errorf("importPath(%q) = %q, %q, want %q, %q", tt.name, dirs, base, tt.dirs, tt.base)
+		}
+	}
+
+	for _, name := range []string{"../evil", "a/../../evil", `..\evil`, "/etc/passwd", `C:\evil`, "c:evil", ".", ""} {
+		if _, _, err := importPath(name); !errors.Is(err, errUnsafePath) {
+			t.Errorf("importPath(%q) gave %v, want errUnsafePath", name, err)
+		}
+	}
+}
+
+func TestSkipEntry(t *testing.T) {
+	for name, want := range map[string]bool{
+		"report.pdf":           false,
+		"a/.DS_Store":          true,
+		"a/._report.pdf":       true,
+		"__MACOSX/report.pdf":  true,
+		"__MACOSX":             true,
+		`a\.DS_Store`:          true,
+		"__MACOSX_not/ok.txt":  false,
+		"a/report._draft.docx": false,
+	} {
+		if got := skipEntry(name); got != want {
+			t.Errorf("skipEntry(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestReadEntry(t *testing.T) {
+	limits := ImportLimits{MaxEntrySize: 4 << 20, MaxRatio: 100}
+	tests := []struct {
+		name       string
+		size       int
+		compressed int64
+		ok         bool
+	}{
+		{"small", 100, 1, true},
+		{"unknown compression", 2 << 20, 0, true},
+		{"plausible ratio", 2 << 20, 1 << 20, true},
+		{"bomb", 2 << 20, 1 << 10, false},
+		{"too large", 4<<20 + 1, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := archiveEntry{name: "x", compressed: tt.compressed, r: bytes.NewReader(make([]byte, tt.size))}
+			data, err := readEntry(e, limits)
+			if tt.ok && (err != nil || len(data) != tt.size) {
+				t.Errorf("read %d bytes, %v, want %d", len(data), err, tt.size)
+			}
+			if !tt.ok && err == nil {
+				t.Error("entry was accepted")
+			}
+		})
+	}
+}
+
+type testFile struct {
+	name string
+	body []byte
+	dir  bool
+}
+
+func writeArchive(t *testing.T, gz bool, files []testFile) *os.File {
+	t.Helper()
+	var buf bytes.Buffer
+	if gz {
+		zw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(zw)
+		for _, f := range files {
+			hdr := &tar.Header{Name: f.name, Mode: 0o644, Size: int64(len(f.body)), Typeflag: tar.TypeReg}
+			if f.dir {
+				hdr = &tar.Header{Name: f.name, Mode: 0o755, Typeflag: tar.TypeDir}
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tw.Write(f.body); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	} else {
+		zw := zip.NewWriter(&buf)
+		for _, f := range files {
+			name := f.name
+			if f.dir {
+				name = strings.TrimSuffix(name, "/") + "/"
+			}
+			w, err := zw.Create(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write(f.body); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "archive")
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestWalkArchive(t *testing.T) {
+	limits := ImportLimits{MaxEntries: 10, MaxTotalSize: 1 << 20}
+	files := []testFile{
+		{name: "a/", dir: true},
+		{name: "a/one.txt", body: []byte("one")},
+		{name: "two.txt", body: []byte("two")},
+	}
+	for _, gz := range []bool{false, true} {
+		f := writeArchive(t, gz, files)
+		got := map[string]string{}
+		total := -1
+		err := walkArchive(f, limits, func(n int) { total = n }, func(e archiveEntry) error {
+			data, err := io.ReadAll(e.r)
+			got[e.name] = string(data)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("gz %v: %v", gz, err)
+		}
+		if want := map[string]string{"a/one.txt": "one", "two.txt": "two"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("gz %v: walked %v, want %v", gz, got, want)
+		}
+		if !gz && total != 2 {
+			t.Errorf("zip total is %d, want 2", total)
+		}
+	}
+}
+
+func TestWalkArchiveLimitsTarGz(t *testing.T) {
+	walk := func(f *os.File, limits ImportLimits) error {
+		return walkArchive(f, limits, func(int) {}, func(e archiveEntry) error {
+			// entries skipped unread are decompressed all the same
+			return nil
+		})
+	}
+
+	dirs := make([]testFile, 20)
+	for i := range dirs {
+		dirs[i] = testFile{name: strings.Repeat("d", i+1) + "/", dir: true}
+	}
+	err := walk(writeArchive(t, true, dirs), ImportLimits{MaxEntries: 10, MaxTotalSize: 1 << 20})
+	if err == nil || !strings.Contains(err.Error(), "entries") {
+		t.Errorf("20 directories gave %v, want too many entries", err)
+	}
+
+	big := []testFile{{name: "big.bin", body: make([]byte, 1<<20)}}
+	err = walk(writeArchive(t, true, big), ImportLimits{MaxEntries: 10, MaxTotalSize: 64 << 10})
+	if err == nil || !strings.Contains(err.Error(), "unpacks to more than") {
+		t.Errorf("an unread 1 MiB entry gave %v, want too large", err)
+	}
+}
@@ -0,0 +1,257 @@
+package service
+
+import (
+	"HttpServer/internal/models"
+	"HttpServer/internal/storage"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"strings"
+	"time"
+)
+
+// IntegrityConfig configures the checks of stored content.
+type IntegrityConfig struct {
+	// VerifyDownloads checks content against its checksum while it is sent.
+	VerifyDownloads bool
+	// OrphanGrace is how old a blob without a version must be before a
+	// scrub reports it, so that blobs of uploads still being saved are not.
+	OrphanGrace time.Duration
+}
+
+// maxScrubProblems bounds the problems listed in a scrub report.
+const maxScrubProblems = 1000
+
+// verifiedReader hashes content while it is read and holds back its last
+// byte until the end shows that the content matches the version. A reader
+// of corrupted content gets an error instead and never sees it complete,
+// so a download is cut short rather than finished with bad data.
+type verifiedReader struct {
+	io.ReadCloser
+	v    *models.DocumentVersion
+	h    hash.Hash
+	size int64
+	back []byte
+	// buf is the content read but not returned yet
+	buf []byte
+	// err is set once the content was read to its end
+	err error
+}
+
+func newVerifiedReader(rc io.ReadCloser, v *models.DocumentVersion) *verifiedReader {
+	return &verifiedReader{ReadCloser: rc, v: v, h: sha256.New(), back: make([]byte, 32<<10)}
+}
+
+func (r *verifiedReader) Read(p []byte) (int, error) {
+	for len(r.buf) <= 1 && r.err == nil {
+		r.buf = append(r.back[:0], r.buf...)
+		n, err := r.ReadCloser.Read(r.back[len(r.buf):])
+		r.h.Write(r.back[len(r.buf) : len(r.buf)+n])
+		r.size += int64(n)
+		r.buf = r.back[:len(r.buf)+n]
+		switch {
+		case err == io.EOF:
+			r.err = r.verify()
+		case err != nil:
+			r.err = err
+		}
+	}
+	held := 1
+	if r.err == io.EOF {
+		held = 0
+	}
+	if len(r.buf) <= held {
+		return 0, r.err
+	}
+	n := copy(p, r.buf[:len(r.buf)-held])
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// verify returns io.EOF if what was read is the content of the version.
+func (r *verifiedReader) verify() error {
+	if err := checkBlob(r.v, r.size, r.h); err != nil {
+		log.Printf("document %d: %v", r.v.DocumentID, err)
+		return err
+	}
+	return io.EOF
+}
+
+// checkBlob compares the size and digest of read content with the version.
+func checkBlob(v *models.DocumentVersion, size int64, h hash.Hash) error {
+	if size != v.Size {
+		return fmt.Errorf("%w: version %d has %d bytes instead of %d", models.ErrCorrupted, v.Version, size, v.Size)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); v.SHA256 != "" && sum != v.SHA256 {
+		return fmt.Errorf("%w: checksum of version %d is %s instead of %s", models.ErrCorrupted, v.Version, sum, v.SHA256)
+	}
+	return nil
+}
+
+// Scrub checks every version against its blob and reports missing and
+// corrupted blobs as well as orphaned ones, which no version refers to.
+// Versions without a checksum get the one of their blob.
+func (s *dockserv) Scrub(ctx context.Context) (*models.ScrubReport, error) {
+	report, err := s.scrubs.StartScrub(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return report, s.runScrub(ctx, report)
+}
+
+// StartScrub starts a scrub in the background and returns its report, which
+// is updated as it progresses. Only admins may do this.
+func (s *dockserv) StartScrub(ctx context.Context, token string) (*models.ScrubReport, error) {
+	if _, err := s.requireAdmin(ctx, token); err != nil {
+		return nil, err
+	}
+	report, err := s.scrubs.StartScrub(ctx)
+	if err != nil {
+		return nil, err
+	}
+	started := *report
+	go func() {
+		if err := s.runScrub(context.WithoutCancel(ctx), report); err != nil {
+			log.Printf("scrub %d failed: %v", report.ID, err)
+		}
+	}()
+	return &started, nil
+}
+
+// ListScrubReports returns the latest scrub reports without their problems.
+// Only admins may do this.
+func (s *dockserv) ListScrubReports(ctx context.Context, token string) ([]models.ScrubReport, error) {
+	if _, err := s.requireAdmin(ctx, token); err != nil {
+		return nil, err
+	}
+	return s.scrubs.ListScrubReports(ctx, maxPageSize)
+}
+
+// GetScrubReport returns a scrub report. Only admins may do this.
+func (s *dockserv) GetScrubReport(ctx context.Context, token string, id int) (*models.ScrubReport, error) {
+	if _, err := s.requireAdmin(ctx, token); err != nil {
+		return nil, err
+	}
+	return s.scrubs.FindScrubReport(ctx, id)
+}
+
+func (s *dockserv) runScrub(ctx context.Context, report *models.ScrubReport) error {
+	err := s.scrub(ctx, report)
+	if err != nil {
+		report.Error = err.Error()
+	}
+	finished := time.Now()
+	report.Finished = &finished
+	if saveErr := s.scrubs.SaveScrubReport(ctx, report); err == nil {
+		err = saveErr
+	}
+	return err
+}
+
+func (s *dockserv) scrub(ctx context.Context, report *models.ScrubReport) error {
+	// versions are checked before the storage is walked, so that blobs of
+	// versions added in between are too new to be taken for orphans
+	referenced := map[string]bool{}
+	const batch = 100
+	afterID, afterVersion := 0, 0
+	for {
+		versions, err := s.docsRepository.ListAllVersions(ctx, afterID, afterVersion, batch)
+		if err != nil {
+			return err
+		}
+		for i := range versions {
+			v := &versions[i]
+			afterID, afterVersion = v.DocumentID, v.Version
+			referenced[v.StorageKey] = true
+			if err := s.scrubVersion(ctx, report, v); err != nil {
+				return err
+			}
+		}
+		if err := s.scrubs.SaveScrubReport(ctx, report); err != nil {
+			return err
+		}
+		if len(versions) < batch {
+			break
+		}
+	}
+
+	cutoff := time.Now().Add(-s.cfg.Integrity.OrphanGrace)
+	err := s.storage.Walk(ctx, func(b storage.BlobInfo) error {
+		report.Blobs++
+		if !referenced[thumbnailOf(b.Key)] && b.Modified.Before(cutoff) {
+			report.Orphaned++
+			addProblem(report, models.BlobProblem{Kind: models.BlobOrphaned, StorageKey: b.Key, Detail: fmt.Sprintf("%d bytes", b.Size)})
+		}
+		if report.Blobs%1000 == 0 {
+			return s.scrubs.SaveScrubReport(ctx, report)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to walk storage: %w", err)
+	}
+	return nil
+}
+
+// scrubVersion reads the blob of v. A blob that cannot be read to its end
+// counts as corrupted; only failures to open blobs or to record results end
+// the scrub.
+func (s *dockserv) scrubVersion(ctx context.Context, report *models.ScrubReport, v *models.DocumentVersion) error {
+	report.Versions++
+	problem := models.BlobProblem{StorageKey: v.StorageKey, DocumentID: &v.DocumentID, Version: &v.Version}
+	rc, err := s.storage.Open(ctx, v.StorageKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		report.Missing++
+		problem.Kind = models.BlobMissing
+		addProblem(report, problem)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", v.StorageKey, err)
+	}
+	defer rc.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, rc)
+	if err == nil {
+		err = checkBlob(v, size, h)
+	}
+	if err != nil {
+		report.Corrupted++
+		problem.Kind, problem.Detail = models.BlobCorrupted, err.Error()
+		addProblem(report, problem)
+		return nil
+	}
+	if v.SHA256 == "" {
+		if err := s.docsRepository.SetVersionChecksum(ctx, v.DocumentID, v.Version, hex.EncodeToString(h.Sum(nil))); err != nil {
+			return fmt.Errorf("failed to record checksum: %w", err)
+		}
+		report.Recorded++
+		report.Unverified++
+	} else if v.SHA256Source != models.ChecksumUpload {
+		report.Unverified++
+	}
+	return nil
+}
+
+// thumbnailOf returns the key of the blob a thumbnail key belongs to, and
+// any other key as it is. Keys merely containing the thumbnail suffix, such
+// as the data keys of encrypted thumbnails, are not thumbnails.
+func thumbnailOf(key string) string {
+	blob, size, ok := strings.Cut(key, ".thumb-")
+	if !ok || size == "" || strings.Trim(size, "0123456789") != "" {
+		return key
+	}
+	return blob
+}
+
+func addProblem(report *models.ScrubReport, p models.BlobProblem) {
+	if len(report.Problems) < maxScrubProblems {
+		report.Problems = append(report.Problems, p)
+	}
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"HttpServer/internal/models"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func versionOf(content []byte) *models.DocumentVersion {
+	sum := sha256.Sum256(content)
+	return &models.DocumentVersion{DocumentID: 1, Version: 1, Size: int64(len(content)), SHA256: hex.EncodeToString(sum[:])}
+}
+
+func TestVerifiedReader(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10_000)
+	tests := []struct {
+		name   string
+		stored []byte
+		v      *models.DocumentVersion
+		ok     bool
+	}{
+		{"intact", content, versionOf(content), true},
+		{"empty", nil, versionOf(nil), true},
+		{"one byte", []byte("x"), versionOf([]byte("x")), true},
+		{"without checksum", content, &models.DocumentVersion{Size: int64(len(content))}, true},
+		{"flipped byte", append(bytes.Clone(content[:len(content)-1]), 'x'), versionOf(content), false},
+		{"truncated", content[:len(content)-1], versionOf(content), false},
+		{"extended", append(bytes.Clone(content), 'x'), versionOf(content), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, r := range []io.Reader{bytes.NewReader(tt.stored), iotest.OneByteReader(bytes.NewReader(tt.stored))} {
+				got, err := io.ReadAll(newVerifiedReader(io.NopCloser(r), tt.v))
+				if tt.ok {
+					if err != nil || !bytes.Equal(got, tt.stored) {
+						t.Errorf("read %d bytes, %v, want the %d stored", len(got), err, len(tt.stored))
+					}
+					continue
+				}
+				if !errors.Is(err, models.ErrCorrupted) {
+					t.Errorf("got error %v, want ErrCorrupted", err)
+				}
+				if len(got) >= len(tt.stored) {
+					t.Errorf("a reader of corrupted content saw all %d bytes", len(got))
+				}
+			}
+		})
+	}
+}
+
+func TestVerifiedReaderPassesReadErrors(t *testing.T) {
+	broken := errors.New("disk on fire")
+	r := io.MultiReader(bytes.NewReader([]byte("abc")), iotest.ErrReader(broken))
+	if _, err := io.ReadAll(newVerifiedReader(io.NopCloser(r), versionOf([]byte("abcdef")))); !errors.Is(err, broken) {
+		t.Errorf("got error %v, want the read error", err)
+	}
+}
+
+func TestThumbnailOf(t *testing.T) {
+	for key, want := range map[string]string{
+		"abc":                    "abc",
+		"abc.thumb-128":          "abc",
+		"abc.thumb-":             "abc.thumb-",
+		"abc.thumb-128.dek.ff":   "abc.thumb-128.dek.ff",
+		"abc.thumb-x":            "abc.thumb-x",
+		"quarantine/abc":         "quarantine/abc",
+		"quarantine/abc.thumb-1": "quarantine/abc",
+	} {
+		if got := thumbnailOf(key); got != want {
+			t.Errorf("thumbnailOf(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"HttpServer/internal/models"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"io"
+	"time"
+)
+
+func hashLinkToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateLink creates a share link for the current content of a document.
+// Only a hash of the token is stored, so the returned link is the only place
+// the token can be read from.
+func (s *dockserv) CreateLink(ctx context.Context, token string, docID int, expiresAt *time.Time, maxDownloads *int, password string) (*models.ShareLink, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: expiry must be in the future", models.ErrInvalidQuery)
+	}
+	if maxDownloads != nil && *maxDownloads <= 0 {
+		return nil, fmt.Errorf("%w: max_downloads must be positive", models.ErrInvalidQuery)
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("failed to generate link token: %w", err)
+	}
+	link := models.ShareLink{
+		DocumentID:   docID,
+		Token:        base64.RawURLEncoding.EncodeToString(raw),
+		ExpiresAt:    expiresAt,
+		MaxDownloads: maxDownloads,
+	}
+	if password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash link password: %w", err)
+		}
+		link.PasswordHash = string(hash)
+	}
+	return s.links.CreateLink(ctx, login, link, hashLinkToken(link.Token))
+}
+
+func (s *dockserv) ListLinks(ctx context.Context, token string, docID int) ([]models.ShareLink, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return s.links.ListLinks(ctx, login, docID)
+}
+
+func (s *dockserv) RevokeLink(ctx context.Context, token string, docID, linkID int) (bool, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return false, err
+	}
+	return s.links.RevokeLink(ctx, login, docID, linkID)
+}
+
+// OpenShared opens the current content of a document through a share link.
+// Wrong passwords are counted against the link but do not use up downloads.
+func (s *dockserv) OpenShared(ctx context.Context, linkToken, password string, docID int) (*models.DocumentVersion, io.ReadCloser, error) {
+	link, err := s.links.FindLink(ctx, hashLinkToken(linkToken), docID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if link.HasPassword {
+		if password == "" {
+			return nil, nil, fmt.Errorf("%w: link password required", models.ErrUnauthorized)
+		}
+		if bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(password)) != nil {
+			s.links.DenyLink(ctx, link.ID)
+			return nil, nil, fmt.Errorf("%w: wrong link password", models.ErrUnauthorized)
+		}
+	}
+	v, err := s.links.UseLink(ctx, link.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.openBlob(ctx, v)
+}
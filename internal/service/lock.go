@@ -0,0 +1,106 @@
+package service
+
+import (
+	"HttpServer/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// LockConfig bounds how long documents stay checked out.
+type LockConfig struct {
+	// DefaultTTL is how long a lock lasts unless the caller asks otherwise.
+	DefaultTTL time.Duration
+	// MaxTTL is the longest a lock may last before it must be extended.
+	MaxTTL time.Duration
+}
+
+// LockDocument checks a document out to the caller for ttl, or the default
+// lock time if ttl is zero. Locking a document again extends the lock. The
+// caller needs edit permission.
+func (s *dockserv) LockDocument(ctx context.Context, token string, id int, ttl time.Duration) (*models.DocumentLock, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case ttl < 0:
+		return nil, fmt.Errorf("%w: negative lock time", models.ErrInvalidQuery)
+	case ttl == 0:
+		ttl = s.cfg.Lock.DefaultTTL
+	case ttl > s.cfg.Lock.MaxTTL:
+		return nil, fmt.Errorf("%w: locks last at most %s", models.ErrInvalidQuery, s.cfg.Lock.MaxTTL)
+	}
+	_, perm, err := s.docsRepository.FindAccess(ctx, login, id)
+	if err != nil {
+		return nil, err
+	}
+	if perm.Level() < models.PermEdit.Level() {
+		return nil, fmt.Errorf("%w: %s permission required", models.ErrForbidden, models.PermEdit)
+	}
+	now := time.Now()
+	return s.locks.AcquireLock(ctx, models.DocumentLock{DocumentID: id, Owner: login, Acquired: now, Expires: now.Add(ttl)})
+}
+
+// GetLock returns the lock on a document the caller can see.
+func (s *dockserv) GetLock(ctx context.Context, token string, id int) (*models.DocumentLock, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := s.docsRepository.FindAccess(ctx, login, id); err != nil {
+		return nil, err
+	}
+	return s.locks.FindLock(ctx, id)
+}
+
+// UnlockDocument releases the lock of the caller. With force it breaks the
+// lock whoever holds it, which only the owner of the document and admins
+// may do. It reports whether there was a lock to release.
+func (s *dockserv) UnlockDocument(ctx context.Context, token string, id int, force bool) (bool, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return false, err
+	}
+	owner, _, err := s.docsRepository.FindAccess(ctx, login, id)
+	if err != nil && !(force && errors.Is(err, models.ErrNotFound)) {
+		return false, err
+	}
+	if !force {
+		return s.locks.ReleaseLock(ctx, id, login)
+	}
+	if owner != login {
+		role, err := s.authService.GetRole(ctx, login)
+		if err != nil {
+			return false, err
+		}
+		if role != models.RoleAdmin {
+			if owner == "" {
+				return false, models.ErrNotFound
+			}
+			return false, fmt.Errorf("%w: only the owner of the document or an admin can break its lock", models.ErrForbidden)
+		}
+	}
+	return s.locks.ReleaseLock(ctx, id, "")
+}
+
+// checkLock fails with ErrLocked if someone other than login has the
+// document checked out. Who holds the lock is only told to callers who can
+// see the document.
+func (s *dockserv) checkLock(ctx context.Context, login string, id int) error {
+	lock, err := s.locks.FindLock(ctx, id)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check lock: %w", err)
+	}
+	if lock.Owner != login {
+		if _, _, err := s.docsRepository.FindAccess(ctx, login, id); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: locked by %s until %s", models.ErrLocked, lock.Owner, lock.Expires.Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"HttpServer/internal/models"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// UploadPolicy restricts the MIME types a role may upload. Patterns are full
+// types such as application/pdf or wildcards such as image/*. An empty Allow
+// list allows every type that is not denied.
+type UploadPolicy struct {
+	Allow []string
+	Deny  []string
+}
+
+func (p UploadPolicy) denies(mimeType string) bool {
+	for _, pattern := range p.Deny {
+		if mimeMatches(pattern, mimeType) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p UploadPolicy) permits(mimeType string) bool {
+	if p.denies(mimeType) {
+		return false
+	}
+	if len(p.Allow) == 0 {
+		return true
+	}
+	for _, pattern := range p.Allow {
+		if mimeMatches(pattern, mimeType) {
+			return true
+		}
+	}
+	return false
+}
+
+func mimeMatches(pattern, mimeType string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if pattern == "*" || pattern == "*/*" {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(mimeType, prefix+"/")
+	}
+	return pattern == mimeType
+}
+
+// executableSignatures are magic numbers of executables that
+// http.DetectContentType reports as application/octet-stream.
+var executableSignatures = []struct {
+	magic    []byte
+	mimeType string
+}{
+	{[]byte("MZ"), "application/x-msdownload"},
+	{[]byte("\x7fELF"), "application/x-executable"},
+	{[]byte{0xfe, 0xed, 0xfa, 0xce}, "application/x-mach-binary"},
+	{[]byte{0xfe, 0xed, 0xfa, 0xcf}, "application/x-mach-binary"},
+	{[]byte{0xce, 0xfa, 0xed, 0xfe}, "application/x-mach-binary"},
+	{[]byte{0xcf, 0xfa, 0xed, 0xfe}, "application/x-mach-binary"},
+	{[]byte("#!"), scriptMime},
+}
+
+// scriptMime is what content starting with #! is detected as. Any text file
+// may start so, so it only counts where a policy denies scripts.
+const scriptMime = "text/x-shellscript"
+
+// sniffLen is how much of the content detectMime looks at.
+const sniffLen = 512
+
+// readHead returns the start of content for detectMime and rewinds it.
+func readHead(content io.ReadSeeker) ([]byte, error) {
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(content, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return head[:n], nil
+}
+
+// detectMime sniffs the content type of data, without parameters.
+func detectMime(data []byte) string {
+	for _, sig := range executableSignatures {
+		if bytes.HasPrefix(data, sig.magic) {
+			return sig.mimeType
+		}
+	}
+	return baseMime(http.DetectContentType(data))
+}
+
+func baseMime(mimeType string) string {
+	if t, _, err := mime.ParseMediaType(mimeType); err == nil {
+		return t
+	}
+	return strings.ToLower(strings.TrimSpace(mimeType))
+}
+
+// compatibleMime reports whether content sniffed as detected may be of the
+// declared type. Sniffing only recognises some formats, so its generic
+// answers are compatible with the more specific types they cover.
+func compatibleMime(declared, detected string) bool {
+	if declared == detected {
+		return true
+	}
+	switch detected {
+	case "application/octet-stream":
+		return true
+	case "text/plain":
+		return strings.HasPrefix(declared, "text/") && declared != "text/html" ||
+			declared == "application/json" || declared == "application/xml" ||
+			declared == "application/javascript" || declared == "application/x-yaml" ||
+			strings.HasSuffix(declared, "+json") || strings.HasSuffix(declared, "+xml")
+	case "text/xml":
+		return declared == "application/xml" || strings.HasSuffix(declared, "+xml")
+	case "application/zip":
+		return strings.HasPrefix(declared, "application/vnd.openxmlformats-officedocument.") ||
+			strings.HasPrefix(declared, "application/vnd.oasis.opendocument.") ||
+			strings.HasSuffix(declared, "+zip") || declared == "application/java-archive" ||
+			declared == "application/x-zip-compressed"
+	}
+	return false
+}
+
+// checkUpload determines the MIME type of uploaded content. The content is
+// sniffed and the declared type, or the one implied by the file name when
+// nothing is declared, must agree with what was found. The upload policy of
+// the role of login must permit the resulting type and must not deny the
+// sniffed one.
+func (s *dockserv) checkUpload(ctx context.Context, login string, data []byte, filename, declared string) (string, error) {
+	role, err := s.authService.GetRole(ctx, login)
+	if err != nil {
+		return "", err
+	}
+	policy, ok := s.cfg.UploadPolicies[role]
+	if !ok {
+		policy = s.cfg.DefaultUploadPolicy
+	}
+
+	detected := detectMime(data)
+	if detected == scriptMime && !policy.denies(scriptMime) {
+		detected = baseMime(http.DetectContentType(data))
+	}
+	declared = baseMime(declared)
+
+	mimeType := declared
+	if mimeType == "" {
+		mimeType = detected
+		if byName := baseMime(mime.TypeByExtension(filepath.Ext(filename))); byName != "" && compatibleMime(byName, detected) {
+			mimeType = byName
+		}
+	} else if !compatibleMime(declared, detected) {
+		return "", fmt.Errorf("%w: declared type %s does not match detected type %s", models.ErrUnsupported, declared, detected)
+	}
+
+	if !policy.permits(mimeType) {
+		return "", fmt.Errorf("%w: %s files may not be uploaded", models.ErrUnsupported, mimeType)
+	}
+	if policy.denies(detected) {
+		return "", fmt.Errorf("%w: %s files may not be uploaded", models.ErrUnsupported, detected)
+	}
+	return mimeType, nil
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"HttpServer/internal/models"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestDetectMime(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"pdf", "%PDF-1.7\n", "application/pdf"},
+		{"png", "\x89PNG\r\n\x1a\n", "image/png"},
+		{"text", "hello world", "text/plain"},
+		{"windows executable", "MZ\x90\x00", "application/x-msdownload"},
+		{"elf", "\x7fELF\x02\x01", "application/x-executable"},
+		{"mach-o", "\xcf\xfa\xed\xfe", "application/x-mach-binary"},
+		{"script", "#!/bin/sh\necho hi\n", scriptMime},
+		{"html", "<!DOCTYPE html><html>", "text/html"},
+	}
+	for _, tt := range tests {
+		if got := detectMime([]byte(tt.data)); got != tt.want {
+			t.Errorf("%s: detected %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCompatibleMime(t *testing.T) {
+	tests := []struct {
+		declared, detected string
+		want               bool
+	}{
+		{"application/pdf", "application/pdf", true},
+		{"application/x-custom", "application/octet-stream", true},
+		{"text/csv", "text/plain", true},
+		{"application/json", "text/plain", true},
+		{"application/ld+json", "text/plain", true},
+		{"text/html", "text/plain", false},
+		{"image/svg+xml", "text/xml", true},
+		{"application/vnd.openxmlformats-officedocument.wordprocessingml.document", "application/zip", true},
+		{"application/epub+zip", "application/zip", true},
+		{"application/pdf", "application/zip", false},
+		{"image/png", "application/x-msdownload", false},
+		{"text/plain", "image/png", false},
+	}
+	for _, tt := range tests {
+		if got := compatibleMime(tt.declared, tt.detected); got != tt.want {
+			t.Errorf("compatibleMime(%s, %s) = %v, want %v", tt.declared, tt.detected, got, tt.want)
+		}
+	}
+}
+
+func TestUploadPolicy(t *testing.T) {
+	p := UploadPolicy{Allow: []string{"image/*", "application/pdf"}, Deny: []string{"image/svg+xml"}}
+	for mimeType, want := range map[string]bool{
+		"image/png":       true,
+		"application/pdf": true,
+		"image/svg+xml":   false,
+		"text/plain":      false,
+	} {
+		if got := p.permits(mimeType); got != want {
+			t.Errorf("permits(%s) = %v, want %v", mimeType, got, want)
+		}
+	}
+	if !(UploadPolicy{}).permits("application/x-anything") {
+		t.Error("an empty policy refuses uploads")
+	}
+}
+
+// roleAuth is an AuthService that only knows the role of every user.
+type roleAuth struct {
+	AuthService
+	role string
+}
+
+func (a roleAuth) GetRole(context.Context, string) (string, error) {
+	return a.role, nil
+}
+
+func TestCheckUpload(t *testing.T) {
+	s := &dockserv{
+		authService: roleAuth{role: models.RoleUser},
+		cfg: DocumentConfig{
+			DefaultUploadPolicy: UploadPolicy{Deny: []string{"application/x-msdownload"}},
+			UploadPolicies: map[string]UploadPolicy{
+				"guest": {Allow: []string{"text/*"}, Deny: []string{scriptMime}},
+			},
+		},
+	}
+	script := []byte("#!/usr/bin/env python3\nprint('hi')\n")
+	tests := []struct {
+		name     string
+		role     string
+		data     []byte
+		filename string
+		declared string
+		want     string
+	}{
+		{"declared", models.RoleUser, []byte("a,b\n"), "data", "text/csv; charset=utf-8", "text/csv"},
+		{"by file name", models.RoleUser, []byte("a,b\n"), "data.csv", "", "text/csv"},
+		{"file name contradicting content", models.RoleUser, []byte("%PDF-1.7"), "data.csv", "", "application/pdf"},
+		{"sniffed", models.RoleUser, []byte("%PDF-1.7"), "data", "", "application/pdf"},
+		{"script where scripts are allowed", models.RoleUser, script, "hi.py", "text/x-python", "text/x-python"},
+		{"script as text", models.RoleUser, script, "hi", "", "text/plain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.authService = roleAuth{role: tt.role}
+			got, err := s.checkUpload(context.Background(), "alice", tt.data, tt.filename, tt.declared)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	rejected := []struct {
+		name     string
+		role     string
+		data     []byte
+		declared string
+	}{
+		{"mismatch", models.RoleUser, []byte("%PDF-1.7"), "image/png"},
+		{"denied by content", models.RoleUser, []byte("MZ\x90\x00"), "application/octet-stream"},
+		{"script where scripts are denied", "guest", script, "text/x-python"},
+		{"undeclared script where scripts are denied", "guest", script, ""},
+		{"not allowed", "guest", []byte("%PDF-1.7"), ""},
+	}
+	for _, tt := range rejected {
+		t.Run(tt.name, func(t *testing.T) {
+			s.authService = roleAuth{role: tt.role}
+			if _, err := s.checkUpload(context.Background(), "alice", tt.data, "file", tt.declared); !errors.Is(err, models.ErrUnsupported) {
+				t.Errorf("got error %v, want ErrUnsupported", err)
+			}
+		})
+	}
+}
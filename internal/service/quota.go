@@ -0,0 +1,140 @@
+package service
+
+import (
+	"HttpServer/internal/models"
+	"context"
+	"fmt"
+)
+
+// quotaFor returns the quota of login: the one of its role with the user's
+// override applied.
+func (s *dockserv) quotaFor(ctx context.Context, login string) (models.Quota, error) {
+	role, err := s.authService.GetRole(ctx, login)
+	if err != nil {
+		return models.Quota{}, err
+	}
+	quota, ok := s.cfg.Quotas[role]
+	if !ok {
+		quota = s.cfg.DefaultQuota
+	}
+	override, err := s.quotas.FindOverride(ctx, login)
+	if err != nil {
+		return models.Quota{}, err
+	}
+	return override.Apply(quota), nil
+}
+
+// ownerQuota returns the quota of the owner of document id, which new
+// versions count against, after checking that a file of size fits into it.
+func (s *dockserv) ownerQuota(ctx context.Context, login string, id int, size int64) (models.Quota, error) {
+	doc, err := s.docsRepository.FindDocumentByID(ctx, login, id)
+	if err != nil {
+		return models.Quota{}, err
+	}
+	quota, err := s.quotaFor(ctx, doc.Owner)
+	if err != nil {
+		return models.Quota{}, err
+	}
+	return quota, checkFileSize(quota, size)
+}
+
+func checkFileSize(quota models.Quota, size int64) error {
+	if quota.MaxFileSize > 0 && size > quota.MaxFileSize {
+		return fmt.Errorf("%w: files may not exceed %d bytes", models.ErrQuotaExceeded, quota.MaxFileSize)
+	}
+	return nil
+}
+
+// GetUsage reports the quota and usage of the caller.
+func (s *dockserv) GetUsage(ctx context.Context, token string) (*models.QuotaReport, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return s.quotaReport(ctx, login, false)
+}
+
+// GetUserQuota reports the quota, override and usage of any user. Only
+// admins may do this.
+func (s *dockserv) GetUserQuota(ctx context.Context, token, login string) (*models.QuotaReport, error) {
+	if err := s.manageUser(ctx, token, login); err != nil {
+		return nil, err
+	}
+	return s.quotaReport(ctx, login, true)
+}
+
+// SetUserQuota overrides the role quota of a user. Only admins may do this.
+func (s *dockserv) SetUserQuota(ctx context.Context, token, login string, o models.QuotaOverride) (*models.QuotaReport, error) {
+	if err := s.manageUser(ctx, token, login); err != nil {
+		return nil, err
+	}
+	if o.MaxBytes != nil && *o.MaxBytes < 0 || o.MaxDocuments != nil && *o.MaxDocuments < 0 || o.MaxFileSize != nil && *o.MaxFileSize < 0 {
+		return nil, fmt.Errorf("%w: quotas may not be negative", models.ErrInvalidQuery)
+	}
+	if err := s.quotas.SaveOverride(ctx, login, o); err != nil {
+		return nil, err
+	}
+	return s.quotaReport(ctx, login, true)
+}
+
+// ResetUserQuota drops the override of a user, who gets the role quota
+// again. Only admins may do this.
+func (s *dockserv) ResetUserQuota(ctx context.Context, token, login string) (*models.QuotaReport, error) {
+	if err := s.manageUser(ctx, token, login); err != nil {
+		return nil, err
+	}
+	if err := s.quotas.DeleteOverride(ctx, login); err != nil {
+		return nil, err
+	}
+	return s.quotaReport(ctx, login, true)
+}
+
+// requireAdmin returns the login of the caller, who must be an admin.
+func (s *dockserv) requireAdmin(ctx context.Context, token string) (string, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return "", err
+	}
+	role, err := s.authService.GetRole(ctx, login)
+	if err != nil {
+		return "", err
+	}
+	if role != models.RoleAdmin {
+		return "", models.ErrForbidden
+	}
+	return login, nil
+}
+
+// manageUser checks that the caller is an admin and that the user the
+// caller wants to manage exists.
+func (s *dockserv) manageUser(ctx context.Context, token, login string) error {
+	if _, err := s.requireAdmin(ctx, token); err != nil {
+		return err
+	}
+	exists, err := s.authService.UserExists(ctx, login)
+	if err != nil {
+		return fmt.Errorf("failed to check user %s: %w", login, err)
+	}
+	if !exists {
+		return fmt.Errorf("%w: user %s does not exist", models.ErrNotFound, login)
+	}
+	return nil
+}
+
+func (s *dockserv) quotaReport(ctx context.Context, login string, withOverride bool) (*models.QuotaReport, error) {
+	quota, err := s.quotaFor(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := s.quotas.GetUsage(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+	report := &models.QuotaReport{Login: login, Quota: quota, Usage: *usage}
+	if withOverride {
+		if report.Override, err = s.quotas.FindOverride(ctx, login); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"HttpServer/internal/models"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// RetentionConfig configures document expiry.
+type RetentionConfig struct {
+	// Notice is how long before expiry owners are told.
+	Notice time.Duration
+	// BatchSize bounds the documents handled per query of the expiry job.
+	BatchSize int
+}
+
+func checkExpiry(expiresAt *time.Time) error {
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return fmt.Errorf("%w: expires_at must be in the future", models.ErrInvalidQuery)
+	}
+	return nil
+}
+
+// ListRetentionRules returns all retention rules. Only admins may do this.
+func (s *dockserv) ListRetentionRules(ctx context.Context, token string) ([]models.RetentionRule, error) {
+	if _, err := s.requireAdmin(ctx, token); err != nil {
+		return nil, err
+	}
+	return s.docsRepository.ListRetentionRules(ctx)
+}
+
+// CreateRetentionRule adds a rule, which applies to existing documents too.
+// Only admins may do this.
+func (s *dockserv) CreateRetentionRule(ctx context.Context, token string, rule models.RetentionRule) (*models.RetentionRule, error) {
+	login, err := s.requireAdmin(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if rule.Tag != nil {
+		tags, err := models.NormalizeTags([]string{*rule.Tag})
+		if err != nil {
+			return nil, err
+		}
+		rule.Tag = &tags[0]
+	}
+	if rule.Mime != nil {
+		mimeType := strings.ToLower(strings.TrimSpace(*rule.Mime))
+		if !strings.Contains(mimeType, "/") {
+			return nil, fmt.Errorf("%w: invalid MIME type %s", models.ErrInvalidQuery, *rule.Mime)
+		}
+		rule.Mime = &mimeType
+	}
+	if rule.Tag == nil && rule.FolderID == nil && rule.Mime == nil {
+		return nil, fmt.Errorf("%w: a rule needs a tag, folder or MIME type", models.ErrInvalidQuery)
+	}
+	if rule.Days <= 0 {
+		return nil, fmt.Errorf("%w: days must be positive", models.ErrInvalidQuery)
+	}
+	rule.CreatedBy = login
+	return s.docsRepository.CreateRetentionRule(ctx, rule)
+}
+
+// DeleteRetentionRule removes a rule. Only admins may do this.
+func (s *dockserv) DeleteRetentionRule(ctx context.Context, token string, id int) (bool, error) {
+	if _, err := s.requireAdmin(ctx, token); err != nil {
+		return false, err
+	}
+	return s.docsRepository.DeleteRetentionRule(ctx, id)
+}
+
+// ExpireDocuments tells owners about documents that expire soon and moves
+// expired documents to the trash, as if their owners had deleted them.
+// Owners are always told the notice ahead, so documents that become due at
+// once, e.g. by a new retention rule, expire the notice after they were told.
+func (s *dockserv) ExpireDocuments(ctx context.Context) error {
+	if err := s.notifyExpiring(ctx); err != nil {
+		return err
+	}
+
+	var expired []models.Notification
+	for afterID := 0; ; {
+		docs, err := s.docsRepository.FindExpiredDocuments(ctx, s.cfg.Retention.Notice, afterID, s.cfg.Retention.BatchSize)
+		if err != nil {
+			return err
+		}
+		for _, doc := range docs {
+			afterID = doc.ID
+			if _, err := s.docsRepository.DeleteDoc(ctx, doc.Owner, doc.ID); err != nil {
+				log.Printf("failed to expire document %d: %v", doc.ID, err)
+				continue
+			}
+			expired = append(expired, models.Notification{
+				Login:      doc.Owner,
+				Kind:       models.NotifyExpiry,
+				DocumentID: &doc.ID,
+				Message:    fmt.Sprintf("Document %q expired and was moved to the trash", doc.Name),
+			})
+		}
+		if len(docs) < s.cfg.Retention.BatchSize {
+			break
+		}
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+	log.Printf("expired %d documents", len(expired))
+	return s.notifications.SaveNotifications(ctx, expired)
+}
+
+func (s *dockserv) notifyExpiring(ctx context.Context) error {
+	for {
+		docs, err := s.docsRepository.FindExpiringDocuments(ctx, time.Now().Add(s.cfg.Retention.Notice), s.cfg.Retention.BatchSize)
+		if err != nil || len(docs) == 0 {
+			return err
+		}
+		notes := make([]models.Notification, 0, len(docs))
+		ids := make([]int, 0, len(docs))
+		// documents due sooner still get the full notice from now on
+		earliest := time.Now().Add(s.cfg.Retention.Notice)
+		for _, doc := range docs {
+			ids = append(ids, doc.ID)
+			expires := *doc.ExpiresAt
+			if expires.Before(earliest) {
+				expires = earliest
+			}
+			notes = append(notes, models.Notification{
+				Login:      doc.Owner,
+				Kind:       models.NotifyExpiry,
+				DocumentID: &doc.ID,
+				Message:    fmt.Sprintf("Document %q expires on %s", doc.Name, expires.UTC().Format(time.RFC3339)),
+			})
+		}
+		if err := s.notifications.SaveNotifications(ctx, notes); err != nil {
+			return err
+		}
+		if err := s.docsRepository.MarkExpiryNotified(ctx, ids); err != nil {
+			return err
+		}
+		if len(docs) < s.cfg.Retention.BatchSize {
+			return nil
+		}
+	}
+}
+
+// ListNotifications returns the caller's latest notifications.
+func (s *dockserv) ListNotifications(ctx context.Context, token string, unread bool) ([]models.Notification, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return s.notifications.ListNotifications(ctx, login, unread, 100)
+}
+
+func (s *dockserv) MarkNotificationRead(ctx context.Context, token string, id int) (bool, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return false, err
+	}
+	return s.notifications.MarkNotificationRead(ctx, login, id)
+}
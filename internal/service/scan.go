@@ -0,0 +1,156 @@
+package service
+
+import (
+	"HttpServer/internal/models"
+	"HttpServer/internal/storage"
+	"HttpServer/internal/thumbnail"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+)
+
+// ScanConfig configures malware scanning.
+type ScanConfig struct {
+	// BlockUnscanned refuses downloads and thumbnails of versions that were
+	// not found clean yet. Infected versions are never served.
+	BlockUnscanned bool
+}
+
+// quarantinePrefix is where the content of infected versions is kept, apart
+// from everything else and without thumbnails.
+const quarantinePrefix = "quarantine/"
+
+// scan returns the scan status and result of content. Without a scanner, or
+// when it fails, the content stays pending for ScanPending.
+func (s *dockserv) scan(ctx context.Context, r io.Reader) (string, string) {
+	if s.scanner == nil {
+		return models.ScanPending, ""
+	}
+	res, err := s.scanner.Scan(ctx, r)
+	if err != nil {
+		log.Printf("failed to scan upload: %v", err)
+		return models.ScanPending, ""
+	}
+	if res.Infected {
+		return models.ScanInfected, res.Signature
+	}
+	return models.ScanClean, ""
+}
+
+// checkScan refuses content that is infected or, by policy, not scanned
+// yet.
+func (s *dockserv) checkScan(v *models.DocumentVersion) error {
+	switch {
+	case v.ScanStatus == models.ScanInfected:
+		return fmt.Errorf("%w: version %d is infected with %s", models.ErrBlocked, v.Version, v.ScanResult)
+	case v.ScanStatus != models.ScanClean && s.cfg.Scan.BlockUnscanned:
+		return fmt.Errorf("%w: version %d was not scanned yet", models.ErrBlocked, v.Version)
+	}
+	return nil
+}
+
+// thumbnailable tells whether thumbnails may be made of content with the
+// scan status, which is whenever checkScan would serve it. Without a
+// scanner everything stays pending and still gets thumbnails.
+func (s *dockserv) thumbnailable(status string) bool {
+	return status == models.ScanClean || status == models.ScanPending && !s.cfg.Scan.BlockUnscanned
+}
+
+// ScanPending scans the versions stored before scanning was enabled or
+// while the scanner was unavailable, and quarantines infected ones.
+func (s *dockserv) ScanPending(ctx context.Context) error {
+	if s.scanner == nil {
+		return nil
+	}
+	const batch = 100
+	afterID, afterVersion, failed := 0, 0, 0
+	for {
+		versions, err := s.docsRepository.ListPendingScans(ctx, afterID, afterVersion, batch)
+		if err != nil {
+			return err
+		}
+		for i := range versions {
+			v := &versions[i]
+			afterID, afterVersion = v.DocumentID, v.Version
+			if err := s.scanVersion(ctx, v); err != nil {
+				log.Printf("failed to scan version %d of document %d: %v", v.Version, v.DocumentID, err)
+				failed++
+			}
+		}
+		if len(versions) < batch {
+			break
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to scan %d versions", failed)
+	}
+	return nil
+}
+
+func (s *dockserv) scanVersion(ctx context.Context, v *models.DocumentVersion) error {
+	rc, err := s.storage.Open(ctx, v.StorageKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		// deleted since it was listed, or missing, which a scrub reports
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	res, err := s.scanner.Scan(ctx, rc)
+	rc.Close()
+	if err != nil {
+		return err
+	}
+	if !res.Infected {
+		ok, err := s.docsRepository.SetScanResult(ctx, v.DocumentID, v.Version, models.ScanClean, "", v.StorageKey)
+		if err != nil || !ok {
+			return err
+		}
+		s.cleanThumbnails(ctx, v)
+		return nil
+	}
+
+	key, err := s.quarantine(ctx, v.StorageKey)
+	if err != nil {
+		return err
+	}
+	ok, err := s.docsRepository.SetScanResult(ctx, v.DocumentID, v.Version, models.ScanInfected, res.Signature, key)
+	if err != nil || !ok {
+		s.storage.Delete(ctx, key)
+		return err
+	}
+	s.deleteBlobs(ctx, []string{v.StorageKey})
+	log.Printf("quarantined version %d of document %d: %s", v.Version, v.DocumentID, res.Signature)
+	return nil
+}
+
+// cleanThumbnails makes the thumbnails of a version that was just found
+// clean, which BlockUnscanned held back while it was pending.
+func (s *dockserv) cleanThumbnails(ctx context.Context, v *models.DocumentVersion) {
+	if !s.cfg.Scan.BlockUnscanned || !thumbnail.Supported(v.Mime) {
+		return
+	}
+	rc, err := s.storage.Open(ctx, v.StorageKey)
+	if err != nil {
+		log.Printf("failed to make thumbnails of %s: %v", v.StorageKey, err)
+		return
+	}
+	defer rc.Close()
+	s.thumbnailsOf(ctx, v.StorageKey, v.Mime, rc)
+}
+
+// quarantine copies a blob into the quarantine and returns its new key. The
+// caller removes the original once the version refers to the copy.
+func (s *dockserv) quarantine(ctx context.Context, key string) (string, error) {
+	rc, err := s.storage.Open(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	if _, err := s.storage.Put(ctx, quarantinePrefix+key, rc); err != nil {
+		return "", fmt.Errorf("failed to quarantine %s: %w", key, err)
+	}
+	return quarantinePrefix + key, nil
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"HttpServer/internal/models"
+	"HttpServer/internal/storage"
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func TestStoreBlobThumbnails(t *testing.T) {
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 32, 32))); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name           string
+		blockUnscanned bool
+		want           bool
+	}{
+		{name: "no scanner", want: true},
+		{name: "unscanned content blocked", blockUnscanned: true, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := storage.NewLocalStorage(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := &dockserv{storage: store, cfg: DocumentConfig{
+				ThumbnailSizes: []int{16},
+				Scan:           ScanConfig{BlockUnscanned: tt.blockUnscanned},
+			}}
+			v, err := s.storeBlob(context.Background(), bytes.NewReader(img.Bytes()), "a.png", "image/png", "alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.ScanStatus != models.ScanPending {
+				t.Errorf("scan status %q, want %q", v.ScanStatus, models.ScanPending)
+			}
+			rc, err := store.Open(context.Background(), thumbnailKey(v.StorageKey, 16))
+			if err == nil {
+				rc.Close()
+			}
+			if got := err == nil; got != tt.want {
+				t.Errorf("thumbnail stored %v, want %v (%v)", got, tt.want, err)
+			}
+		})
+	}
+}
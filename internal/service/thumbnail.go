@@ -0,0 +1,175 @@
+package service
+
+import (
+	"HttpServer/internal/models"
+	"HttpServer/internal/storage"
+	"HttpServer/internal/thumbnail"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"strconv"
+)
+
+// thumbnailMimes are the image types thumbnails are made of.
+var thumbnailMimes = []string{"image/png", "image/jpeg", "image/gif"}
+
+// thumbnailKey is where the thumbnail of the given size of a blob is stored,
+// next to the blob itself.
+func thumbnailKey(key string, size int) string {
+	return key + ".thumb-" + strconv.Itoa(size)
+}
+
+// maxThumbnailSource is the size of the largest image thumbnails are made
+// of when it is stored, so that huge uploads are not read into memory.
+const maxThumbnailSource = 64 << 20
+
+// thumbnailsOf makes the thumbnails of content if it is an image that is
+// not too large. Callers only pass content that is thumbnailable; thumbnails
+// held back by the scan policy are made once ScanPending found it clean.
+func (s *dockserv) thumbnailsOf(ctx context.Context, key, mimeType string, content io.Reader) {
+	if !thumbnail.Supported(mimeType) {
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(content, maxThumbnailSource+1))
+	if err != nil {
+		log.Printf("failed to make thumbnails of %s: %v", key, err)
+		return
+	}
+	if len(data) > maxThumbnailSource {
+		return
+	}
+	s.makeThumbnails(ctx, key, mimeType, data)
+}
+
+// makeThumbnails stores a thumbnail of every configured size of an image
+// blob. Thumbnails missing later are made on demand, so failures are only
+// logged.
+func (s *dockserv) makeThumbnails(ctx context.Context, key, mimeType string, data []byte) int {
+	if !thumbnail.Supported(mimeType) {
+		return 0
+	}
+	made := 0
+	for _, size := range s.cfg.ThumbnailSizes {
+		if _, err := s.storeThumbnail(ctx, key, mimeType, data, size); err != nil {
+			log.Printf("failed to make %d px thumbnail of %s: %v", size, key, err)
+			continue
+		}
+		made++
+	}
+	return made
+}
+
+func (s *dockserv) storeThumbnail(ctx context.Context, key, mimeType string, data []byte, size int) ([]byte, error) {
+	thumb, err := thumbnail.Make(data, mimeType, size)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.storage.Put(ctx, thumbnailKey(key, size), bytes.NewReader(thumb)); err != nil {
+		return nil, err
+	}
+	return thumb, nil
+}
+
+// OpenThumbnail returns the type and content of a thumbnail of the current
+// version of an image document. A zero size means the smallest configured
+// one. Thumbnails are previews, so view permission is enough; public
+// documents have theirs available to anyone.
+func (s *dockserv) OpenThumbnail(ctx context.Context, token string, id, size int) (string, io.ReadCloser, error) {
+	if len(s.cfg.ThumbnailSizes) == 0 {
+		return "", nil, fmt.Errorf("%w: thumbnails are disabled", models.ErrNotFound)
+	}
+	if size == 0 {
+		size = slices.Min(s.cfg.ThumbnailSizes)
+	}
+	if !slices.Contains(s.cfg.ThumbnailSizes, size) {
+		return "", nil, fmt.Errorf("%w: size must be one of %v", models.ErrInvalidQuery, s.cfg.ThumbnailSizes)
+	}
+
+	var v *models.DocumentVersion
+	var err error
+	if token == "" {
+		v, err = s.docsRepository.FindPublicVersion(ctx, id)
+	} else {
+		var login string
+		if login, err = s.login(ctx, token); err != nil {
+			return "", nil, err
+		}
+		v, err = s.docsRepository.FindViewableVersion(ctx, login, id)
+		if errors.Is(err, models.ErrNotFound) {
+			v, err = s.docsRepository.FindPublicVersion(ctx, id)
+		}
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	if err := s.checkScan(v); err != nil {
+		return "", nil, err
+	}
+	if !thumbnail.Supported(v.Mime) {
+		return "", nil, fmt.Errorf("%w: %s documents have no thumbnail", models.ErrNotFound, v.Mime)
+	}
+
+	mimeType := thumbnail.OutputType(v.Mime)
+	rc, err := s.storage.Open(ctx, thumbnailKey(v.StorageKey, size))
+	if err == nil {
+		return mimeType, rc, nil
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		return "", nil, err
+	}
+
+	// made before thumbnails existed, or their generation failed
+	_, blob, err := s.openBlob(ctx, v)
+	if err != nil {
+		return "", nil, err
+	}
+	data, err := io.ReadAll(blob)
+	blob.Close()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read content: %w", err)
+	}
+	thumb, err := s.storeThumbnail(ctx, v.StorageKey, v.Mime, data, size)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to make thumbnail: %w", err)
+	}
+	return mimeType, io.NopCloser(bytes.NewReader(thumb)), nil
+}
+
+// RegenerateThumbnails makes the thumbnails of the current versions of all
+// image documents anew, e.g. after the configured sizes changed. It returns
+// how many thumbnails were written.
+func (s *dockserv) RegenerateThumbnails(ctx context.Context) (int, error) {
+	const batch = 100
+	made, after := 0, 0
+	for {
+		versions, err := s.docsRepository.ListCurrentVersions(ctx, thumbnailMimes, after, batch)
+		if err != nil {
+			return made, err
+		}
+		for _, v := range versions {
+			after = v.DocumentID
+			if !s.thumbnailable(v.ScanStatus) {
+				continue
+			}
+			_, blob, err := s.openBlob(ctx, &v)
+			if err != nil {
+				log.Printf("skipping thumbnails of document %d: %v", v.DocumentID, err)
+				continue
+			}
+			data, err := io.ReadAll(blob)
+			blob.Close()
+			if err != nil {
+				log.Printf("skipping thumbnails of document %d: %v", v.DocumentID, err)
+				continue
+			}
+			made += s.makeThumbnails(ctx, v.StorageKey, v.Mime, data)
+		}
+		if len(versions) < batch {
+			return made, nil
+		}
+	}
+}
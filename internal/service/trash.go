@@ -0,0 +1,69 @@
+package service
+
+import (
+	"HttpServer/internal/models"
+	"context"
+	"log"
+	"time"
+)
+
+func (s *dockserv) ListTrash(ctx context.Context, token string) ([]models.Document, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return s.docsRepository.ListTrash(ctx, login)
+}
+
+func (s *dockserv) RestoreDoc(ctx context.Context, token string, id int) (bool, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return false, err
+	}
+	return s.docsRepository.RestoreDoc(ctx, login, id)
+}
+
+// EmptyTrash permanently deletes the trashed documents the caller owns and
+// returns how many blobs were removed.
+func (s *dockserv) EmptyTrash(ctx context.Context, token string) (int, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return 0, err
+	}
+	keys, err := s.docsRepository.EmptyTrash(ctx, login)
+	if err != nil {
+		return 0, err
+	}
+	s.deleteBlobs(ctx, keys)
+	return len(keys), nil
+}
+
+// PurgeTrash permanently deletes documents that stayed in the trash longer
+// than the configured retention.
+func (s *dockserv) PurgeTrash(ctx context.Context) error {
+	keys, err := s.docsRepository.PurgeTrash(ctx, time.Now().Add(-s.cfg.TrashRetention))
+	if err != nil {
+		return err
+	}
+	s.deleteBlobs(ctx, keys)
+	if len(keys) > 0 {
+		log.Printf("purged %d blobs from trash", len(keys))
+	}
+	return nil
+}
+
+// deleteBlobs removes blobs whose rows are already gone, together with their
+// thumbnails. Failures only leave orphaned files behind, so they are logged
+// rather than returned.
+func (s *dockserv) deleteBlobs(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := s.storage.Delete(ctx, key); err != nil {
+			log.Printf("failed to delete blob %s: %v", key, err)
+		}
+		for _, size := range s.cfg.ThumbnailSizes {
+			if err := s.storage.Delete(ctx, thumbnailKey(key, size)); err != nil {
+				log.Printf("failed to delete thumbnail %s: %v", thumbnailKey(key, size), err)
+			}
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package service
+
+import (
+	"HttpServer/internal/models"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ResumableConfig configures resumable uploads.
+type ResumableConfig struct {
+	// Dir keeps the content received so far, one file per upload.
+	Dir     string
+	MaxSize int64
+	// Expiry is how long an upload may stay incomplete after its last
+	// chunk.
+	Expiry time.Duration
+}
+
+// ChecksumAlgorithms are the digests accepted for chunks.
+var ChecksumAlgorithms = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"md5":    md5.New,
+}
+
+// CreateUpload starts a resumable upload of length bytes that becomes a
+// document with the attributes of doc once complete.
+func (s *dockserv) CreateUpload(ctx context.Context, token string, length int64, doc models.Document, filename, metadata string) (*models.Upload, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("%w: invalid upload length", models.ErrInvalidQuery)
+	}
+	if length > s.cfg.Resumable.MaxSize {
+		return nil, fmt.Errorf("%w: uploads may not exceed %d bytes", models.ErrTooLarge, s.cfg.Resumable.MaxSize)
+	}
+	// fail early rather than after the whole file was sent; the quota is
+	// enforced again when the document is saved
+	report, err := s.quotaReport(ctx, login, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkFileSize(report.Quota, length); err != nil {
+		return nil, err
+	}
+	if report.Quota.MaxBytes > 0 && report.Usage.Bytes+length > report.Quota.MaxBytes {
+		return nil, fmt.Errorf("%w: the storage quota of %d bytes is used up", models.ErrQuotaExceeded, report.Quota.MaxBytes)
+	}
+	if doc.Tags, err = models.NormalizeTags(doc.Tags); err != nil {
+		return nil, err
+	}
+	if err := s.checkUploadGrantees(ctx, login, doc.Grant); err != nil {
+		return nil, err
+	}
+	if doc.FolderID != nil {
+		if _, err := s.folders.FindFolder(ctx, login, *doc.FolderID); err != nil {
+			return nil, err
+		}
+	}
+	if doc.Name == "" {
+		doc.Name = filename
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate upload id: %w", err)
+	}
+	now := time.Now()
+	upload := &models.Upload{
+		ID:       hex.EncodeToString(id),
+		Owner:    login,
+		Length:   length,
+		Document: doc,
+		Filename: filename,
+		Metadata: metadata,
+		Created:  now,
+		Expires:  now.Add(s.cfg.Resumable.Expiry),
+	}
+	if err := os.MkdirAll(s.cfg.Resumable.Dir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create upload directory: %w", err)
+	}
+	f, err := os.Create(s.partPath(upload.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upload: %w", err)
+	}
+	f.Close()
+	if err := s.uploads.SaveUpload(ctx, upload); err != nil {
+		os.Remove(s.partPath(upload.ID))
+		return nil, fmt.Errorf("failed to create upload: %w", err)
+	}
+	if length == 0 {
+		return s.finishUpload(ctx, upload)
+	}
+	return upload, nil
+}
+
+// GetUpload returns an upload started by the caller.
+func (s *dockserv) GetUpload(ctx context.Context, token, id string) (*models.Upload, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	upload, err := s.uploads.FindUpload(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if upload.Owner != login {
+		return nil, models.ErrNotFound
+	}
+	return upload, nil
+}
+
+// WriteUpload appends a chunk that starts at offset. Without a checksum
+// whatever arrived before a broken connection is kept, so the client can
+// resume from there; with one the chunk is kept only if it matches. The
+// document is created when the last chunk arrives.
+func (s *dockserv) WriteUpload(ctx context.Context, token, id string, offset int64, chunk io.Reader, sum *models.Checksum) (*models.Upload, error) {
+	var h hash.Hash
+	if sum != nil {
+		newHash, ok := ChecksumAlgorithms[strings.ToLower(sum.Algorithm)]
+		if !ok {
+			return nil, fmt.Errorf("%w: unsupported checksum algorithm %s", models.ErrInvalidQuery, sum.Algorithm)
+		}
+		h = newHash()
+	}
+	upload, err := s.GetUpload(ctx, token, id)
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := s.uploads.LockUpload(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	// the upload may have moved on while this request waited for the lock
+	if upload, err = s.uploads.FindUpload(ctx, id); err != nil {
+		return nil, err
+	}
+	if offset != upload.Offset {
+		return nil, fmt.Errorf("%w: the upload is at offset %d", models.ErrConflict, upload.Offset)
+	}
+	if upload.DocumentID != nil {
+		return upload, nil
+	}
+
+	f, err := os.OpenFile(s.partPath(id), os.O_WRONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload: %w", err)
+	}
+	defer f.Close()
+	// drop anything a crashed writer left beyond the recorded offset
+	if err := f.Truncate(offset); err != nil {
+		return nil, fmt.Errorf("failed to write upload: %w", err)
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to write upload: %w", err)
+	}
+	var w io.Writer = f
+	if h != nil {
+		w = io.MultiWriter(f, h)
+	}
+	remaining := upload.Length - offset
+	n, copyErr := io.Copy(w, io.LimitReader(chunk, remaining+1))
+	switch {
+	case n > remaining:
+		copyErr = fmt.Errorf("%w: the chunk exceeds the upload length", models.ErrTooLarge)
+	case copyErr == nil && h != nil && !bytes.Equal(h.Sum(nil), sum.Sum):
+		copyErr = models.ErrChecksumMismatch
+	case copyErr != nil && h != nil:
+		// a partial chunk cannot be verified
+	case copyErr != nil:
+		copyErr = nil
+	}
+	if copyErr != nil {
+		f.Truncate(offset)
+		return nil, copyErr
+	}
+
+	// the client may be gone but what arrived must be recorded
+	ctx = context.WithoutCancel(ctx)
+	upload.Offset += n
+	upload.Expires = time.Now().Add(s.cfg.Resumable.Expiry)
+	if err := s.uploads.SaveUpload(ctx, upload); err != nil {
+		f.Truncate(offset)
+		return nil, fmt.Errorf("failed to save upload: %w", err)
+	}
+	if upload.Offset < upload.Length {
+		return upload, nil
+	}
+	return s.finishUpload(ctx, upload)
+}
+
+// finishUpload turns a complete upload into a document. The upload is kept,
+// with the document id, so that a client resuming after the last chunk
+// learns the upload is done.
+func (s *dockserv) finishUpload(ctx context.Context, upload *models.Upload) (*models.Upload, error) {
+	f, err := os.Open(s.partPath(upload.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload: %w", err)
+	}
+	doc, err := s.uploadAs(ctx, upload.Owner, upload.Document, f, upload.Length, upload.Filename)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	upload.DocumentID = &doc.ID
+	if err := s.uploads.SaveUpload(ctx, upload); err != nil {
+		log.Printf("failed to save upload %s: %v", upload.ID, err)
+	}
+	if err := os.Remove(s.partPath(upload.ID)); err != nil {
+		log.Printf("failed to remove upload %s: %v", upload.ID, err)
+	}
+	return upload, nil
+}
+
+// DeleteUpload cancels an upload and discards what was received.
+func (s *dockserv) DeleteUpload(ctx context.Context, token, id string) error {
+	if _, err := s.GetUpload(ctx, token, id); err != nil {
+		return err
+	}
+	unlock, err := s.uploads.LockUpload(ctx, id)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := s.uploads.DeleteUpload(ctx, id); err != nil {
+		return err
+	}
+	if err := os.Remove(s.partPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove upload: %w", err)
+	}
+	return nil
+}
+
+// PurgeUploads removes the content of uploads that expired.
+func (s *dockserv) PurgeUploads(ctx context.Context) error {
+	parts, err := filepath.Glob(filepath.Join(s.cfg.Resumable.Dir, "*.part"))
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-s.cfg.Resumable.Expiry)
+	for _, part := range parts {
+		info, err := os.Stat(part)
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		id := strings.TrimSuffix(filepath.Base(part), ".part")
+		if _, err := s.uploads.FindUpload(ctx, id); !errors.Is(err, models.ErrNotFound) {
+			continue
+		}
+		if err := os.Remove(part); err != nil {
+			log.Printf("failed to remove upload %s: %v", id, err)
+		}
+	}
+	return nil
+}
+
+func (s *dockserv) partPath(id string) string {
+	return filepath.Join(s.cfg.Resumable.Dir, id+".part")
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"HttpServer/internal/models"
+	"context"
+	"crypto/sha1"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tokenAuth is an AuthService whose tokens are the logins themselves.
+type tokenAuth struct {
+	AuthService
+}
+
+func (tokenAuth) GetLoginFromToken(_ context.Context, token string) (string, error) {
+	return token, nil
+}
+
+// memUploads keeps uploads in memory.
+type memUploads map[string]models.Upload
+
+func (m memUploads) SaveUpload(_ context.Context, upload *models.Upload) error {
+	m[upload.ID] = *upload
+	return nil
+}
+
+func (m memUploads) FindUpload(_ context.Context, id string) (*models.Upload, error) {
+	upload, ok := m[id]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+	return &upload, nil
+}
+
+func (m memUploads) DeleteUpload(_ context.Context, id string) error {
+	delete(m, id)
+	return nil
+}
+
+func (m memUploads) LockUpload(context.Context, string) (func(), error) {
+	return func() {}, nil
+}
+
+// failingReader returns its content and then fails, like a connection that
+// breaks mid-chunk.
+type failingReader struct {
+	r io.Reader
+}
+
+func (f failingReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if err == io.EOF {
+		return n, errors.New("connection reset")
+	}
+	return n, err
+}
+
+func newUploadService(t *testing.T, length int64) (*dockserv, memUploads) {
+	t.Helper()
+	uploads := memUploads{"u1": {ID: "u1", Owner: "alice", Length: length}}
+	s := &dockserv{
+		authService: tokenAuth{},
+		uploads:     uploads,
+		cfg:         DocumentConfig{Resumable: ResumableConfig{Dir: t.TempDir(), Expiry: time.Hour}},
+	}
+	if err := os.WriteFile(s.partPath("u1"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return s, uploads
+}
+
+func sha1Sum(s string) *models.Checksum {
+	sum := sha1.Sum([]byte(s))
+	return &models.Checksum{Algorithm: "SHA1", Sum: sum[:]}
+}
+
+func TestWriteUpload(t *testing.T) {
+	tests := []struct {
+		name        string
+		offset      int64
+		chunk       io.Reader
+		sum         *models.Checksum
+		fails       bool
+		err         error
+		offsetAfter int64
+	}{
+		{"chunk", 0, strings.NewReader("hello"), nil, false, nil, 5},
+		{"verified chunk", 0, strings.NewReader("hello"), sha1Sum("hello"), false, nil, 5},
+		{"checksum mismatch", 0, strings.NewReader("hello"), sha1Sum("hellO"), true, models.ErrChecksumMismatch, 0},
+		{"unsupported algorithm", 0, strings.NewReader("hello"), &models.Checksum{Algorithm: "crc32"}, true, models.ErrInvalidQuery, 0},
+		{"wrong offset", 3, strings.NewReader("hello"), nil, true, models.ErrConflict, 0},
+		{"beyond the length", 0, strings.NewReader(strings.Repeat("x", 11)), nil, true, models.ErrTooLarge, 0},
+		{"broken chunk is kept", 0, failingReader{strings.NewReader("hel")}, nil, false, nil, 3},
+		{"broken verified chunk is dropped", 0, failingReader{strings.NewReader("hel")}, sha1Sum("hello"), true, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, uploads := newUploadService(t, 10)
+			_, err := s.WriteUpload(context.Background(), "alice", "u1", tt.offset, tt.chunk, tt.sum)
+			switch {
+			case !tt.fails && err != nil:
+				t.Fatalf("got error %v", err)
+			case tt.fails && err == nil:
+				t.Fatal("the chunk was accepted")
+			case tt.err != nil && !errors.Is(err, tt.err):
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if got := uploads["u1"].Offset; got != tt.offsetAfter {
+				t.Errorf("offset is %d, want %d", got, tt.offsetAfter)
+			}
+			info, err := os.Stat(s.partPath("u1"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Size() != tt.offsetAfter {
+				t.Errorf("part file has %d bytes, want %d", info.Size(), tt.offsetAfter)
+			}
+		})
+	}
+}
+
+func TestWriteUploadResumes(t *testing.T) {
+	s, uploads := newUploadService(t, 10)
+	ctx := context.Background()
+	if _, err := s.WriteUpload(ctx, "alice", "u1", 0, strings.NewReader("hello"), nil); err != nil {
+		t.Fatal(err)
+	}
+	// a crashed writer left bytes beyond the recorded offset
+	f, err := os.OpenFile(s.partPath("u1"), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("garbage")
+	f.Close()
+
+	if _, err := s.WriteUpload(ctx, "alice", "u1", 5, strings.NewReader("wor"), sha1Sum("wor")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(s.partPath("u1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hellowor" || uploads["u1"].Offset != 8 {
+		t.Errorf("upload holds %q at offset %d", data, uploads["u1"].Offset)
+	}
+
+	if _, err := s.WriteUpload(ctx, "bob", "u1", 8, strings.NewReader("ld"), nil); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("another user writing gave %v, want ErrNotFound", err)
+	}
+}
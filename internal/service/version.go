@@ -0,0 +1,247 @@
+package service
+
+import (
+	"HttpServer/internal/models"
+	"HttpServer/internal/storage"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+)
+
+// login resolves the token and fails with ErrUnauthorized when it does not
+// belong to any user.
+func (s *dockserv) login(ctx context.Context, token string) (string, error) {
+	login, err := s.authService.GetLoginFromToken(ctx, token)
+	if err != nil {
+		return "", fmt.Errorf("failed to get login from token: %w", err)
+	}
+	if login == "" {
+		return "", models.ErrUnauthorized
+	}
+	return login, nil
+}
+
+// storeBlob scans the content and writes it and its thumbnails under a new
+// storage key, in the quarantine if it is infected. It describes the content
+// as a version that is not yet attached to a document. The content is read
+// several times but never held in memory as a whole, except for images
+// small enough to make thumbnails of.
+func (s *dockserv) storeBlob(ctx context.Context, content io.ReadSeeker, filename, mime, login string) (*models.DocumentVersion, error) {
+	status, result := s.scan(ctx, content)
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	key := storage.NewKey()
+	if status == models.ScanInfected {
+		key = quarantinePrefix + key
+	}
+	h := sha256.New()
+	size, err := s.storage.Put(ctx, key, io.TeeReader(content, h))
+	if err != nil {
+		return nil, fmt.Errorf("failed to save file: %w", err)
+	}
+	if s.thumbnailable(status) {
+		if _, err := content.Seek(0, io.SeekStart); err != nil {
+			log.Printf("failed to make thumbnails of %s: %v", key, err)
+		} else {
+			s.thumbnailsOf(ctx, key, mime, content)
+		}
+	}
+	return &models.DocumentVersion{
+		Filename:     filename,
+		Mime:         mime,
+		Size:         size,
+		SHA256:       hex.EncodeToString(h.Sum(nil)),
+		SHA256Source: models.ChecksumUpload,
+		ScanStatus:   status,
+		ScanResult:   result,
+		StorageKey:   key,
+		CreatedBy:    login,
+	}, nil
+}
+
+func (s *dockserv) UpdateContent(ctx context.Context, token string, id int, fileData []byte, filename, mime string) (*models.DocumentVersion, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkLock(ctx, login, id); err != nil {
+		return nil, err
+	}
+	if mime, err = s.checkUpload(ctx, login, fileData, filename, mime); err != nil {
+		return nil, err
+	}
+	quota, err := s.ownerQuota(ctx, login, id, int64(len(fileData)))
+	if err != nil {
+		return nil, err
+	}
+	v, err := s.storeBlob(ctx, bytes.NewReader(fileData), filename, mime, login)
+	if err != nil {
+		return nil, err
+	}
+	v.DocumentID = id
+	return s.addVersion(ctx, login, v, extractText(mime, filename, fileData), quota)
+}
+
+func (s *dockserv) addVersion(ctx context.Context, login string, v *models.DocumentVersion, content string, quota models.Quota) (*models.DocumentVersion, error) {
+	saved, pruned, err := s.docsRepository.AddVersion(ctx, login, *v, content, s.cfg.MaxVersions, quota)
+	if err != nil {
+		s.deleteBlobs(ctx, []string{v.StorageKey})
+		return nil, err
+	}
+	s.deleteBlobs(ctx, pruned)
+	return saved, nil
+}
+
+func (s *dockserv) ListVersions(ctx context.Context, token string, id int) ([]models.DocumentVersion, error) {
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return s.docsRepository.ListVersions(ctx, login, id)
+}
+
+// OpenVersion returns the version and a reader of its content. A zero
+// version means the current one, which is also available to anyone for
+// public documents. The caller must close the reader.
+func (s *dockserv) OpenVersion(ctx context.Context, token string, id, version int) (*models.DocumentVersion, io.ReadCloser, error) {
+	var v *models.DocumentVersion
+	var err error
+	if token == "" && version == 0 {
+		v, err = s.docsRepository.FindPublicVersion(ctx, id)
+	} else {
+		var login string
+		if login, err = s.login(ctx, token); err != nil {
+			return nil, nil, err
+		}
+		v, err = s.docsRepository.FindVersion(ctx, login, id, version)
+		if errors.Is(err, models.ErrNotFound) && version == 0 {
+			v, err = s.docsRepository.FindPublicVersion(ctx, id)
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.openBlob(ctx, v)
+}
+
+// openBlob opens the content of a version, which is checked against its
+// checksum while it is read if downloads are verified. Content the scan
+// policy blocks is not opened.
+func (s *dockserv) openBlob(ctx context.Context, v *models.DocumentVersion) (*models.DocumentVersion, io.ReadCloser, error) {
+	if err := s.checkScan(v); err != nil {
+		return nil, nil, err
+	}
+	rc, err := s.storage.Open(ctx, v.StorageKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil, fmt.Errorf("%w: content of version %d is missing", models.ErrNotFound, v.Version)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if s.cfg.Integrity.VerifyDownloads && v.SHA256 != "" {
+		rc = newVerifiedReader(rc, v)
+	}
+	return v, rc, nil
+}
+
+// BackfillVersions gives file documents saved before versions existed their
+// stored file as version 1. It returns how many it gave one and the ids of
+// the documents left without. Such files were stored under the name of the
+// uploaded file, which was not recorded and need not be the name of the
+// document, so only files, mapping document ids to the storage keys of
+// their files, tells which file is whose. Documents missing from it, or
+// whose file cannot be read, are left unresolved rather than guessed.
+func (s *dockserv) BackfillVersions(ctx context.Context, files map[int]string) (int, []int, error) {
+	const batch = 100
+	n, afterID := 0, 0
+	var unresolved []int
+	for {
+		docs, err := s.docsRepository.FindUnversionedDocuments(ctx, afterID, batch)
+		if err != nil {
+			return n, unresolved, err
+		}
+		for i := range docs {
+			doc := &docs[i]
+			afterID = doc.ID
+			key, ok := files[doc.ID]
+			if !ok {
+				unresolved = append(unresolved, doc.ID)
+				continue
+			}
+			ok, err := s.backfillVersion(ctx, doc, key)
+			if err != nil {
+				log.Printf("failed to backfill version of document %d from %s: %v", doc.ID, key, err)
+				unresolved = append(unresolved, doc.ID)
+				continue
+			}
+			if ok {
+				n++
+			}
+		}
+		if len(docs) < batch {
+			return n, unresolved, nil
+		}
+	}
+}
+
+func (s *dockserv) backfillVersion(ctx context.Context, doc *models.Document, key string) (bool, error) {
+	rc, err := s.storage.Open(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	defer rc.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, rc)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	return s.docsRepository.SaveFirstVersion(ctx, models.DocumentVersion{
+		DocumentID:   doc.ID,
+		Filename:     path.Base(key),
+		Mime:         doc.Mime,
+		Size:         size,
+		SHA256:       hex.EncodeToString(h.Sum(nil)),
+		SHA256Source: models.ChecksumComputed,
+		ScanStatus:   models.ScanPending,
+		StorageKey:   key,
+		CreatedBy:    doc.Owner,
+	})
+}
+
+// RestoreVersion copies an older version into a new current version, so
+// history is never rewritten.
+func (s *dockserv) RestoreVersion(ctx context.Context, token string, id, version int) (*models.DocumentVersion, error) {
+	old, rc, err := s.OpenVersion(ctx, token, id, version)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read version %d: %w", version, err)
+	}
+	login, err := s.login(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkLock(ctx, login, id); err != nil {
+		return nil, err
+	}
+	quota, err := s.ownerQuota(ctx, login, id, int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	v, err := s.storeBlob(ctx, bytes.NewReader(data), old.Filename, old.Mime, login)
+	if err != nil {
+		return nil, err
+	}
+	v.DocumentID = id
+	return s.addVersion(ctx, login, v, extractText(old.Mime, old.Filename, data), quota)
+}
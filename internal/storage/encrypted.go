@@ -0,0 +1,513 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var ErrDecrypt = errors.New("failed to decrypt blob")
+
+// An encrypted blob starts with a header of encMagic followed by a random
+// nonce prefix. The content follows in chunks of encChunkSize bytes, each
+// sealed with AES-256-GCM under the nonce prefix, the chunk number and a
+// flag marking the last chunk, so that chunks can be neither reordered nor
+// dropped. The header is authenticated with every chunk.
+const (
+	encMagic      = "\x00DOCENC\x01"
+	encPrefixSize = 7
+	encHeaderSize = len(encMagic) + encPrefixSize
+	encChunkSize  = 64 << 10
+)
+
+// The wrapped data key of a blob is stored next to it, named after the blob
+// and the nonce prefix in its header, so that a Put replacing a blob writes
+// a new data key rather than overwriting the one the old content needs.
+const dataKeySuffix = ".dek."
+
+// encryptedMarker is written once every blob is encrypted. From then on
+// blobs in the clear are refused rather than served, since they can only
+// have been put there behind the back of the storage.
+const encryptedMarker = ".encrypted"
+
+type wrappedKey struct {
+	KeyID   string `json:"key_id"`
+	Wrapped []byte `json:"wrapped"`
+}
+
+// EncryptedStorage encrypts blobs at rest.
+type EncryptedStorage interface {
+	Storage
+	// Rewrap wraps every data key that is not wrapped with the current
+	// master key anew, without touching the content. It returns how many
+	// keys it rewrapped.
+	Rewrap(ctx context.Context) (int, error)
+	// EncryptAll encrypts the blobs stored before encryption was enabled
+	// and returns how many it encrypted. Once it succeeded, blobs in the
+	// clear can no longer be opened.
+	EncryptAll(ctx context.Context) (int, error)
+}
+
+type encrypted struct {
+	inner Storage
+	keys  KeyProvider
+	// complete caches that the marker was seen; it is never removed
+	complete atomic.Bool
+}
+
+// NewEncryptedStorage encrypts every blob put into inner with a data key of
+// its own, which is stored wrapped by keys. Blobs that were stored before
+// encryption was enabled are read as they are until EncryptAll encrypted
+// them.
+//
+// Only blobs are encrypted. The parts of resumable uploads and the temporary
+// copies of imported archives are kept in the clear outside the storage
+// while they are received, and removed once they are stored as blobs.
+func NewEncryptedStorage(inner Storage, keys KeyProvider) EncryptedStorage {
+	return &encrypted{inner: inner, keys: keys}
+}
+
+// dataKeyName is where the data key of the blob key with the given header
+// is stored.
+func dataKeyName(key string, header []byte) string {
+	return key + dataKeySuffix + hex.EncodeToString(header[len(encMagic):])
+}
+
+// splitDataKey returns the blob a data key belongs to.
+func splitDataKey(name string) (string, bool) {
+	i := strings.LastIndex(name, dataKeySuffix)
+	if i <= 0 {
+		return "", false
+	}
+	suffix := name[i+len(dataKeySuffix):]
+	if _, err := hex.DecodeString(suffix); err != nil || len(suffix) != 2*encPrefixSize {
+		return "", false
+	}
+	return name[:i], true
+}
+
+// reserved reports whether key is used by the encryption itself.
+func reserved(key string) bool {
+	_, ok := splitDataKey(key)
+	return ok || key == encryptedMarker
+}
+
+// Put stores a new data key before the content. Until the content is
+// written, readers of a blob being replaced keep using its previous data
+// key, which is removed afterwards. A failed Put leaves the previous blob
+// as it was.
+func (e *encrypted) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	if reserved(key) {
+		return 0, fmt.Errorf("invalid storage key %q", key)
+	}
+	dataKey := make([]byte, 32)
+	header := make([]byte, encHeaderSize)
+	copy(header, encMagic)
+	if _, err := rand.Read(dataKey); err != nil {
+		return 0, err
+	}
+	if _, err := rand.Read(header[len(encMagic):]); err != nil {
+		return 0, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return 0, err
+	}
+	previous := e.dataKeyOf(ctx, key)
+	name := dataKeyName(key, header)
+	if err := e.putDataKey(ctx, name, dataKey); err != nil {
+		return 0, err
+	}
+
+	enc := &encryptReader{src: bufio.NewReader(r), aead: aead, header: header, out: header}
+	if _, err := e.inner.Put(ctx, key, enc); err != nil {
+		e.inner.Delete(ctx, name)
+		return 0, err
+	}
+	if previous != "" {
+		// a leftover is reported by Walk
+		e.inner.Delete(ctx, previous)
+	}
+	return enc.n, nil
+}
+
+// dataKeyOf returns the name of the data key of a stored blob, or an empty
+// string if there is no such blob or it is not encrypted.
+func (e *encrypted) dataKeyOf(ctx context.Context, key string) string {
+	rc, err := e.inner.Open(ctx, key)
+	if err != nil {
+		return ""
+	}
+	defer rc.Close()
+	header := make([]byte, encHeaderSize)
+	if _, err := io.ReadFull(rc, header); err != nil || !bytes.HasPrefix(header, []byte(encMagic)) {
+		return ""
+	}
+	return dataKeyName(key, header)
+}
+
+func (e *encrypted) putDataKey(ctx context.Context, name string, dataKey []byte) error {
+	var w wrappedKey
+	var err error
+	if w.KeyID, w.Wrapped, err = e.keys.Wrap(ctx, dataKey); err != nil {
+		return fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	data, err := json.Marshal(w)
+	if err != nil {
+		return err
+	}
+	if _, err := e.inner.Put(ctx, name, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to save data key: %w", err)
+	}
+	return nil
+}
+
+func (e *encrypted) readDataKey(ctx context.Context, name string) (*wrappedKey, error) {
+	rc, err := e.inner.Open(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	var w wrappedKey
+	if err := json.NewDecoder(rc).Decode(&w); err != nil {
+		return nil, fmt.Errorf("failed to read data key %s: %w", name, err)
+	}
+	return &w, nil
+}
+
+// Open decrypts the blob while it is read.
+func (e *encrypted) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	if reserved(key) {
+		return nil, fmt.Errorf("invalid storage key %q", key)
+	}
+	rc, err := e.inner.Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	src := bufio.NewReader(rc)
+	header, err := src.Peek(encHeaderSize)
+	if err != nil && err != io.EOF {
+		rc.Close()
+		return nil, err
+	}
+	if !bytes.HasPrefix(header, []byte(encMagic)) {
+		// stored in the clear before encryption was enabled
+		if err := e.allowPlaintext(ctx, key); err != nil {
+			rc.Close()
+			return nil, err
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{src, rc}, nil
+	}
+	header = bytes.Clone(header)
+	src.Discard(encHeaderSize)
+
+	w, err := e.readDataKey(ctx, dataKeyName(key, header))
+	if errors.Is(err, ErrNotFound) {
+		err = fmt.Errorf("%w: data key of %s is missing", ErrDecrypt, key)
+	}
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	dataKey, err := e.keys.Unwrap(ctx, w.KeyID, w.Wrapped)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return &decryptReader{src: src, Closer: rc, aead: aead, header: header, buf: make([]byte, encChunkSize+aead.Overhead())}, nil
+}
+
+// allowPlaintext fails once the storage was marked as fully encrypted.
+func (e *encrypted) allowPlaintext(ctx context.Context, key string) error {
+	if !e.complete.Load() {
+		rc, err := e.inner.Open(ctx, encryptedMarker)
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rc.Close()
+		e.complete.Store(true)
+	}
+	return fmt.Errorf("%w: %s is not encrypted", ErrDecrypt, key)
+}
+
+func (e *encrypted) Delete(ctx context.Context, key string) error {
+	name := e.dataKeyOf(ctx, key)
+	if err := e.inner.Delete(ctx, key); err != nil {
+		return err
+	}
+	if name == "" {
+		return nil
+	}
+	return e.inner.Delete(ctx, name)
+}
+
+// Walk reports the blobs without their data keys, except for data keys
+// that belong to no blob, such as those left behind by an interrupted Put,
+// so that they are found as orphans. Sizes are those of the encrypted
+// content.
+func (e *encrypted) Walk(ctx context.Context, fn func(BlobInfo) error) error {
+	blobs := map[string]bool{}
+	dataKeys := map[string][]BlobInfo{}
+	err := e.inner.Walk(ctx, func(b BlobInfo) error {
+		if b.Key == encryptedMarker {
+			return nil
+		}
+		if key, ok := splitDataKey(b.Key); ok {
+			dataKeys[key] = append(dataKeys[key], b)
+			return nil
+		}
+		blobs[b.Key] = true
+		return fn(b)
+	})
+	if err != nil {
+		return err
+	}
+	for key, infos := range dataKeys {
+		current := ""
+		if blobs[key] {
+			current = e.dataKeyOf(ctx, key)
+		}
+		for _, b := range infos {
+			if b.Key == current {
+				continue
+			}
+			if err := fn(b); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (e *encrypted) Rewrap(ctx context.Context) (int, error) {
+	current := e.keys.CurrentKeyID()
+	var names []string
+	err := e.inner.Walk(ctx, func(b BlobInfo) error {
+		if _, ok := splitDataKey(b.Key); ok {
+			names = append(names, b.Key)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, name := range names {
+		w, err := e.readDataKey(ctx, name)
+		if errors.Is(err, ErrNotFound) {
+			// deleted since the walk
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+		if w.KeyID == current {
+			continue
+		}
+		dataKey, err := e.keys.Unwrap(ctx, w.KeyID, w.Wrapped)
+		if err != nil {
+			return n, fmt.Errorf("failed to unwrap data key %s: %w", name, err)
+		}
+		if err := e.putDataKey(ctx, name, dataKey); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (e *encrypted) EncryptAll(ctx context.Context) (int, error) {
+	var keys []string
+	err := e.inner.Walk(ctx, func(b BlobInfo) error {
+		if !reserved(b.Key) {
+			keys = append(keys, b.Key)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, key := range keys {
+		ok, err := e.encryptBlob(ctx, key)
+		if err != nil {
+			return n, fmt.Errorf("failed to encrypt %s: %w", key, err)
+		}
+		if ok {
+			n++
+		}
+	}
+	if _, err := e.inner.Put(ctx, encryptedMarker, strings.NewReader(time.Now().UTC().Format(time.RFC3339)+"\n")); err != nil {
+		return n, fmt.Errorf("failed to mark storage as encrypted: %w", err)
+	}
+	e.complete.Store(true)
+	return n, nil
+}
+
+// encryptBlob replaces a blob stored in the clear with its encrypted form.
+// It reports false for blobs that are encrypted already or gone.
+func (e *encrypted) encryptBlob(ctx context.Context, key string) (bool, error) {
+	rc, err := e.inner.Open(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer rc.Close()
+	src := bufio.NewReader(rc)
+	header, err := src.Peek(encHeaderSize)
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	if bytes.HasPrefix(header, []byte(encMagic)) {
+		return false, nil
+	}
+	if _, err := e.Put(ctx, key, src); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func chunkNonce(header []byte, chunk uint32, last bool) []byte {
+	nonce := make([]byte, 0, encPrefixSize+5)
+	nonce = append(nonce, header[len(encMagic):]...)
+	nonce = binary.BigEndian.AppendUint32(nonce, chunk)
+	if last {
+		return append(nonce, 1)
+	}
+	return append(nonce, 0)
+}
+
+// encryptReader reads the encrypted form of src: the header, then the
+// sealed chunks. The last chunk, empty if the content is, is sealed once
+// src is known to be exhausted.
+type encryptReader struct {
+	src    *bufio.Reader
+	aead   cipher.AEAD
+	header []byte
+	chunk  uint32
+	plain  []byte
+	sealed []byte
+	// out is what was encrypted but not read yet
+	out  []byte
+	done bool
+	// n counts the bytes read from src
+	n int64
+}
+
+func (e *encryptReader) Read(p []byte) (int, error) {
+	for len(e.out) == 0 {
+		if e.done {
+			return 0, io.EOF
+		}
+		if err := e.seal(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, e.out)
+	e.out = e.out[n:]
+	return n, nil
+}
+
+func (e *encryptReader) seal() error {
+	if e.plain == nil {
+		e.plain = make([]byte, encChunkSize)
+	}
+	n, err := io.ReadFull(e.src, e.plain)
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		e.done = true
+	case err != nil:
+		return err
+	default:
+		if _, err := e.src.Peek(1); err == io.EOF {
+			e.done = true
+		} else if err != nil {
+			return err
+		}
+	}
+	if e.chunk == ^uint32(0) && !e.done {
+		return errors.New("blob too large to encrypt")
+	}
+	e.n += int64(n)
+	e.sealed = e.aead.Seal(e.sealed[:0], chunkNonce(e.header, e.chunk, e.done), e.plain[:n], e.header)
+	e.out = e.sealed
+	e.chunk++
+	return nil
+}
+
+// decryptReader is the reverse of encryptReader once the header was read.
+type decryptReader struct {
+	src *bufio.Reader
+	io.Closer
+	aead   cipher.AEAD
+	header []byte
+	chunk  uint32
+	buf    []byte
+	out    []byte
+	done   bool
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.out) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	return n, nil
+}
+
+func (d *decryptReader) open() error {
+	n, err := io.ReadFull(d.src, d.buf)
+	switch {
+	case err == io.EOF:
+		return fmt.Errorf("%w: blob is truncated", ErrDecrypt)
+	case err == io.ErrUnexpectedEOF:
+		d.done = true
+	case err != nil:
+		return err
+	default:
+		if _, err := d.src.Peek(1); err == io.EOF {
+			d.done = true
+		} else if err != nil {
+			return err
+		}
+	}
+	plain, err := d.aead.Open(d.buf[:0], chunkNonce(d.header, d.chunk, d.done), d.buf[:n], d.header)
+	if err != nil {
+		return fmt.Errorf("%w: chunk %d: %v", ErrDecrypt, d.chunk, err)
+	}
+	d.out = plain
+	d.chunk++
+	return nil
+}
@@ -0,0 +1,353 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestKeys writes a key file with the given key ids, the last one being
+// current.
+func newTestKeys(t *testing.T, ids ...string) KeyProvider {
+	t.Helper()
+	var b strings.Builder
+	for i, id := range ids {
+		key := bytes.Repeat([]byte{byte(i + 1)}, 32)
+		fmt.Fprintf(&b, "%s %s\n", id, base64.StdEncoding.EncodeToString(key))
+	}
+	path := filepath.Join(t.TempDir(), "keys")
+	if err := os.WriteFile(path, []byte(b.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := NewKeyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func newTestStorage(t *testing.T, keys KeyProvider) (EncryptedStorage, string) {
+	t.Helper()
+	dir := t.TempDir()
+	inner, err := NewLocalStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewEncryptedStorage(inner, keys), dir
+}
+
+func readBlob(t *testing.T, s Storage, key string) ([]byte, error) {
+	t.Helper()
+	rc, err := s.Open(context.Background(), key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func content(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	return data
+}
+
+func TestEncryptedRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+	}{
+		{"empty", 0},
+		{"short", 10},
+		{"exactly one chunk", encChunkSize},
+		{"one chunk and a byte", encChunkSize + 1},
+		{"multiple chunks", 3*encChunkSize + 123},
+		{"multiple full chunks", 2 * encChunkSize},
+	}
+	s, dir := newTestStorage(t, newTestKeys(t, "k1"))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := content(tt.size)
+			n, err := s.Put(context.Background(), "blob", bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != int64(tt.size) {
+				t.Errorf("Put returned %d, want %d", n, tt.size)
+			}
+			raw, err := os.ReadFile(filepath.Join(dir, "blob"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.size > 0 && bytes.Contains(raw, data) {
+				t.Error("content is stored in the clear")
+			}
+			got, err := readBlob(t, s, "blob")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("read %d bytes that differ from the %d written", len(got), len(data))
+			}
+		})
+	}
+}
+
+func TestEncryptedRejectsTampering(t *testing.T) {
+	chunk := encChunkSize + 16
+	tests := []struct {
+		name   string
+		tamper func(t *testing.T, dir string, raw []byte) []byte
+	}{
+		{"truncated mid chunk", func(t *testing.T, dir string, raw []byte) []byte {
+			return raw[:len(raw)-5]
+		}},
+		{"truncated at a chunk boundary", func(t *testing.T, dir string, raw []byte) []byte {
+			return raw[:encHeaderSize+2*chunk]
+		}},
+		{"last chunk dropped", func(t *testing.T, dir string, raw []byte) []byte {
+			return raw[:encHeaderSize+chunk]
+		}},
+		{"chunks reordered", func(t *testing.T, dir string, raw []byte) []byte {
+			out := bytes.Clone(raw)
+			first := raw[encHeaderSize : encHeaderSize+chunk]
+			second := raw[encHeaderSize+chunk : encHeaderSize+2*chunk]
+			copy(out[encHeaderSize:], second)
+			copy(out[encHeaderSize+chunk:], first)
+			return out
+		}},
+		{"content changed", func(t *testing.T, dir string, raw []byte) []byte {
+			out := bytes.Clone(raw)
+			out[encHeaderSize+10] ^= 1
+			return out
+		}},
+		{"header changed", func(t *testing.T, dir string, raw []byte) []byte {
+			out := bytes.Clone(raw)
+			out[len(encMagic)] ^= 1
+			return out
+		}},
+		{"header changed along with its data key", func(t *testing.T, dir string, raw []byte) []byte {
+			out := bytes.Clone(raw)
+			out[len(encMagic)] ^= 1
+			data, err := os.ReadFile(filepath.Join(dir, dataKeyName("blob", raw[:encHeaderSize])))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, dataKeyName("blob", out[:encHeaderSize])), data, 0o600); err != nil {
+				t.Fatal(err)
+			}
+			return out
+		}},
+		{"unknown key id", func(t *testing.T, dir string, raw []byte) []byte {
+			path := filepath.Join(dir, dataKeyName("blob", raw[:encHeaderSize]))
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var w wrappedKey
+			if err := json.Unmarshal(data, &w); err != nil {
+				t.Fatal(err)
+			}
+			w.KeyID = "unknown"
+			if data, err = json.Marshal(w); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, data, 0o600); err != nil {
+				t.Fatal(err)
+			}
+			return raw
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, dir := newTestStorage(t, newTestKeys(t, "k1"))
+			if _, err := s.Put(context.Background(), "blob", bytes.NewReader(content(2*encChunkSize+100))); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(dir, "blob")
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, tt.tamper(t, dir, raw), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err = readBlob(t, s, "blob")
+			if !errors.Is(err, ErrDecrypt) && !errors.Is(err, ErrUnknownKey) {
+				t.Errorf("got error %v, want it rejected", err)
+			}
+		})
+	}
+}
+
+func TestEncryptedRewrap(t *testing.T) {
+	dir := t.TempDir()
+	inner, err := NewLocalStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	old := NewEncryptedStorage(inner, newTestKeys(t, "k1"))
+	for _, key := range []string{"a", "b"} {
+		if _, err := old.Put(ctx, key, strings.NewReader("content of "+key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rotated := NewEncryptedStorage(inner, newTestKeys(t, "k1", "k2"))
+	if _, err := rotated.Put(ctx, "c", strings.NewReader("content of c")); err != nil {
+		t.Fatal(err)
+	}
+	n, err := rotated.Rewrap(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("rewrapped %d keys, want 2", n)
+	}
+	if n, err := rotated.Rewrap(ctx); err != nil || n != 0 {
+		t.Errorf("second rewrap returned %d, %v, want nothing to do", n, err)
+	}
+
+	// the retired master key is no longer needed
+	current := NewEncryptedStorage(inner, newTestKeys(t, "k0", "k2"))
+	for _, key := range []string{"a", "b", "c"} {
+		got, err := readBlob(t, current, key)
+		if err != nil {
+			t.Fatalf("%s: %v", key, err)
+		}
+		if string(got) != "content of "+key {
+			t.Errorf("%s: read %q", key, got)
+		}
+	}
+}
+
+func TestEncryptedOverwrite(t *testing.T) {
+	s, dir := newTestStorage(t, newTestKeys(t, "k1"))
+	ctx := context.Background()
+	if _, err := s.Put(ctx, "blob", strings.NewReader("first")); err != nil {
+		t.Fatal(err)
+	}
+	rc, err := s.Open(ctx, "blob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if _, err := s.Put(ctx, "blob", strings.NewReader("second")); err != nil {
+		t.Fatal(err)
+	}
+
+	// a failed Put leaves the blob it would have replaced alone
+	failing := io.MultiReader(strings.NewReader("third"), errReader{})
+	if _, err := s.Put(ctx, "blob", failing); err == nil {
+		t.Fatal("Put of a failing reader succeeded")
+	}
+	got, err := readBlob(t, s, "blob")
+	if err != nil || string(got) != "second" {
+		t.Errorf("read %q, %v after overwrite, want second", got, err)
+	}
+
+	dataKeys, _ := filepath.Glob(filepath.Join(dir, "blob"+dataKeySuffix+"*"))
+	if len(dataKeys) != 1 {
+		t.Errorf("found %d data keys, want 1", len(dataKeys))
+	}
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) {
+	return 0, errors.New("broken")
+}
+
+func TestEncryptedWalkReportsOrphanedDataKeys(t *testing.T) {
+	s, dir := newTestStorage(t, newTestKeys(t, "k1"))
+	ctx := context.Background()
+	for _, key := range []string{"a", "b"} {
+		if _, err := s.Put(ctx, key, strings.NewReader(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// as if a Put of c crashed before writing the content and the blob b
+	// was removed without its data key
+	orphans := map[string]bool{
+		"c" + dataKeySuffix + "00112233445566": true,
+		"b" + dataKeySuffix + "66554433221100": true,
+	}
+	for name := range orphans {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var keys []string
+	err := s.Walk(ctx, func(b BlobInfo) error {
+		keys = append(keys, b.Key)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, key := range keys {
+		seen[key] = true
+	}
+	if len(keys) != 4 || !seen["a"] || !seen["b"] || !orphans[keys[2]] || !orphans[keys[3]] {
+		t.Errorf("walk reported %v, want a, b and the orphaned data keys", keys)
+	}
+}
+
+func TestEncryptAll(t *testing.T) {
+	dir := t.TempDir()
+	inner, err := NewLocalStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := inner.Put(ctx, "legacy", strings.NewReader("stored in the clear")); err != nil {
+		t.Fatal(err)
+	}
+	s := NewEncryptedStorage(inner, newTestKeys(t, "k1"))
+	if _, err := s.Put(ctx, "new", strings.NewReader("encrypted")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := readBlob(t, s, "legacy"); err != nil || string(got) != "stored in the clear" {
+		t.Fatalf("read legacy blob %q, %v", got, err)
+	}
+
+	n, err := s.EncryptAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("encrypted %d blobs, want 1", n)
+	}
+	raw, err := os.ReadFile(filepath.Join(dir, "legacy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(raw, []byte(encMagic)) {
+		t.Error("legacy blob is still in the clear")
+	}
+	if got, err := readBlob(t, s, "legacy"); err != nil || string(got) != "stored in the clear" {
+		t.Errorf("read encrypted legacy blob %q, %v", got, err)
+	}
+
+	// blobs in the clear are refused from now on, even by a new instance
+	if err := os.WriteFile(filepath.Join(dir, "planted"), []byte("planted"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	restarted := NewEncryptedStorage(inner, newTestKeys(t, "k1"))
+	if _, err := readBlob(t, restarted, "planted"); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("got error %v for a blob in the clear, want ErrDecrypt", err)
+	}
+}
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var ErrUnknownKey = errors.New("unknown master key")
+
+// KeyProvider wraps data keys with master keys, as a KMS does, so that the
+// master keys never leave it.
+type KeyProvider interface {
+	// Wrap encrypts a data key with the current master key and returns the
+	// id of that key along with the result.
+	Wrap(ctx context.Context, dataKey []byte) (keyID string, wrapped []byte, err error)
+	// Unwrap decrypts a data key wrapped with the master key keyID, which
+	// need not be the current one.
+	Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+	// CurrentKeyID is the id of the master key Wrap uses.
+	CurrentKeyID() string
+}
+
+type keyFile struct {
+	keys    map[string]cipher.AEAD
+	current string
+}
+
+// NewKeyFile reads 256-bit master keys from a file with one key per line:
+// an id, a space and the base64 encoded key. Empty lines and lines starting
+// with # are ignored. The last key is the current one; the others are kept
+// to unwrap data keys that were not rewrapped yet.
+func NewKeyFile(path string) (KeyProvider, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open key file: %w", err)
+	}
+	defer f.Close()
+
+	kf := &keyFile{keys: map[string]cipher.AEAD{}}
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		id, encoded, ok := strings.Cut(text, " ")
+		if !ok {
+			return nil, fmt.Errorf("key file line %d: expected an id and a key", line)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("key file line %d: expected a base64 encoded 32 byte key", line)
+		}
+		if _, ok := kf.keys[id]; ok {
+			return nil, fmt.Errorf("key file line %d: duplicate key id %s", line, id)
+		}
+		if kf.keys[id], err = newGCM(key); err != nil {
+			return nil, err
+		}
+		kf.current = id
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	if kf.current == "" {
+		return nil, fmt.Errorf("key file %s has no keys", path)
+	}
+	return kf, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (k *keyFile) CurrentKeyID() string {
+	return k.current
+}
+
+// Wrap seals the data key under a random nonce, which precedes the result.
+// The key id is authenticated too.
+func (k *keyFile) Wrap(ctx context.Context, dataKey []byte) (string, []byte, error) {
+	aead := k.keys[k.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+	return k.current, aead.Seal(nonce, nonce, dataKey, []byte(k.current)), nil
+}
+
+func (k *keyFile) Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	aead, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrUnknownKey, keyID)
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errors.New("wrapped data key is too short")
+	}
+	nonce, sealed := wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():]
+	dataKey, err := aead.Open(nil, nonce, sealed, []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	return dataKey, nil
+}
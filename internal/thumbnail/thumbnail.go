@@ -0,0 +1,127 @@
+// Package thumbnail scales PNG, JPEG and GIF images down using only the
+// standard library.
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+// maxPixels guards against images that are small files but decode to huge
+// bitmaps.
+const maxPixels = 50_000_000
+
+var ErrUnsupported = errors.New("unsupported image type")
+
+// Supported reports whether thumbnails can be made of images of mimeType.
+func Supported(mimeType string) bool {
+	switch mimeType {
+	case "image/png", "image/jpeg", "image/gif":
+		return true
+	}
+	return false
+}
+
+// OutputType is the type of the thumbnails of an image of mimeType: JPEG for
+// photos, PNG for everything that may have transparency.
+func OutputType(mimeType string) string {
+	if mimeType == "image/jpeg" {
+		return "image/jpeg"
+	}
+	return "image/png"
+}
+
+// Make decodes the image and scales it so that neither side exceeds size,
+// keeping the aspect ratio. Smaller images are re-encoded at their own size.
+// Of an animated GIF only the first frame is used.
+func Make(data []byte, mimeType string, size int) ([]byte, error) {
+	if !Supported(mimeType) {
+		return nil, ErrUnsupported
+	}
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid thumbnail size %d", size)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxPixels {
+		return nil, fmt.Errorf("image of %dx%d pixels is too large", cfg.Width, cfg.Height)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	w, h := fit(src.Bounds().Dx(), src.Bounds().Dy(), size)
+	dst := scale(src, w, h)
+
+	var buf bytes.Buffer
+	if OutputType(mimeType) == "image/jpeg" {
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&buf, dst)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func fit(w, h, size int) (int, int) {
+	if w <= size && h <= size {
+		return w, h
+	}
+	if w >= h {
+		return size, max(1, h*size/w)
+	}
+	return max(1, w*size/h), size
+}
+
+// scale resizes src to w x h by averaging the source pixels that fall into
+// each target pixel, which gives good results when shrinking. Averaging is
+// done on premultiplied colours so transparent pixels do not bleed.
+func scale(src image.Image, w, h int) *image.RGBA {
+	b := src.Bounds()
+	rgba, ok := src.(*image.RGBA)
+	if !ok {
+		rgba = image.NewRGBA(b)
+		draw.Draw(rgba, b, src, b.Min, draw.Src)
+	}
+	sw, sh := b.Dx(), b.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, (y+1)*sh/h
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, (x+1)*sw/w
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var sum [4]uint64
+			for sy := y0; sy < y1; sy++ {
+				off := rgba.PixOffset(b.Min.X+x0, b.Min.Y+sy)
+				for sx := x0; sx < x1; sx++ {
+					for c := 0; c < 4; c++ {
+						sum[c] += uint64(rgba.Pix[off+c])
+					}
+					off += 4
+				}
+			}
+			n := uint64((x1 - x0) * (y1 - y0))
+			off := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				dst.Pix[off+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+	return dst
+}
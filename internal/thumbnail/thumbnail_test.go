@@ -0,0 +1,128 @@
+package thumbnail
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		w, h, size   int
+		wantW, wantH int
+	}{
+		{100, 50, 128, 100, 50},
+		{128, 128, 128, 128, 128},
+		{1000, 500, 128, 128, 64},
+		{500, 1000, 128, 64, 128},
+		{10000, 1, 128, 128, 1},
+		{1, 10000, 128, 1, 128},
+	}
+	for _, tt := range tests {
+		w, h := fit(tt.w, tt.h, tt.size)
+		if w != tt.wantW || h != tt.wantH {
+			t.Errorf("fit(%d, %d, %d) = %d, %d, want %d, %d", tt.w, tt.h, tt.size, w, h, tt.wantW, tt.wantH)
+		}
+	}
+}
+
+func TestScaleAverages(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 2; y++ {
+			c := color.RGBA{A: 255}
+			if x < 2 {
+				c.R = 200
+			} else {
+				c.B = 100
+			}
+			src.Set(x, y, c)
+		}
+	}
+	dst := scale(src, 2, 1)
+	if got := dst.RGBAAt(0, 0); got != (color.RGBA{R: 200, A: 255}) {
+		t.Errorf("left pixel is %v", got)
+	}
+	if got := dst.RGBAAt(1, 0); got != (color.RGBA{B: 100, A: 255}) {
+		t.Errorf("right pixel is %v", got)
+	}
+
+	// a sub-image keeps its own origin
+	if got := scale(src.SubImage(image.Rect(2, 0, 4, 2)), 1, 1).RGBAAt(0, 0); got != (color.RGBA{B: 100, A: 255}) {
+		t.Errorf("scaled sub-image is %v", got)
+	}
+}
+
+func TestMake(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 300, 150))
+	encode := map[string]func(*bytes.Buffer) error{
+		"image/png":  func(b *bytes.Buffer) error { return png.Encode(b, src) },
+		"image/jpeg": func(b *bytes.Buffer) error { return jpeg.Encode(b, src, nil) },
+		"image/gif":  func(b *bytes.Buffer) error { return gif.Encode(b, src, nil) },
+	}
+	for mimeType, enc := range encode {
+		var buf bytes.Buffer
+		if err := enc(&buf); err != nil {
+			t.Fatal(err)
+		}
+		thumb, err := Make(buf.Bytes(), mimeType, 100)
+		if err != nil {
+			t.Fatalf("%s: %v", mimeType, err)
+		}
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(thumb))
+		if err != nil {
+			t.Fatalf("%s: %v", mimeType, err)
+		}
+		if cfg.Width != 100 || cfg.Height != 50 {
+			t.Errorf("%s: thumbnail is %dx%d, want 100x50", mimeType, cfg.Width, cfg.Height)
+		}
+		if "image/"+format != OutputType(mimeType) {
+			t.Errorf("%s: thumbnail is %s, want %s", mimeType, format, OutputType(mimeType))
+		}
+	}
+}
+
+func TestMakeRejects(t *testing.T) {
+	// only the header is read, so the pixel data may be far too short
+	var huge bytes.Buffer
+	if err := png.Encode(&huge, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	data := huge.Bytes()
+	// IHDR width and height follow the signature, length and chunk type,
+	// and the chunk ends with a CRC of its type and data
+	copy(data[16:24], []byte{0, 0, 0x40, 0, 0, 0, 0x40, 0})
+	binary.BigEndian.PutUint32(data[29:33], crc32.ChecksumIEEE(data[12:29]))
+
+	tests := []struct {
+		name     string
+		data     []byte
+		mimeType string
+		size     int
+	}{
+		{"unsupported type", []byte("x"), "image/webp", 100},
+		{"bad size", data, "image/png", 0},
+		{"not an image", []byte("not an image"), "image/png", 100},
+		{"too many pixels", data, "image/png", 100},
+	}
+	for _, tt := range tests {
+		_, err := Make(tt.data, tt.mimeType, tt.size)
+		if err == nil {
+			t.Errorf("%s: thumbnail was made", tt.name)
+		}
+		if tt.name == "unsupported type" && !errors.Is(err, ErrUnsupported) {
+			t.Errorf("%s: got %v, want ErrUnsupported", tt.name, err)
+		}
+		if tt.name == "too many pixels" && (err == nil || !strings.Contains(err.Error(), "too large")) {
+			t.Errorf("%s: got %v, want the image refused as too large", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE documents5 ADD COLUMN content_text text;
+
+ALTER TABLE documents5 ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', coalesce(name, '')), 'A') ||
+    setweight(to_tsvector('simple', coalesce(content_text, '')), 'C')
+) STORED;
+
+CREATE INDEX documents5_search_idx ON documents5 USING GIN (search_vector);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX documents5_search_idx;
+ALTER TABLE documents5 DROP COLUMN search_vector;
+ALTER TABLE documents5 DROP COLUMN content_text;
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+-- existing documents start without a version; the server gives them their
+-- stored file as version 1 at startup, since only it can read the files
+ALTER TABLE documents5 ADD COLUMN current_version int NOT NULL DEFAULT 0;
+ALTER TABLE documents5 ADD COLUMN max_versions int;
+
+CREATE TABLE document_versions (
+    document_id int NOT NULL REFERENCES documents5 (id) ON DELETE CASCADE,
+    version     int NOT NULL,
+    filename    text NOT NULL,
+    mime        text,
+    size        bigint NOT NULL,
+    storage_key text NOT NULL,
+    created_by  text,
+    created     timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (document_id, version)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE document_versions;
+ALTER TABLE documents5 DROP COLUMN max_versions;
+ALTER TABLE documents5 DROP COLUMN current_version;
+-- +goose StatementEnd
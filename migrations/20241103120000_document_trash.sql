@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE documents5 ADD COLUMN deleted_at timestamptz;
+ALTER TABLE documents5 ADD COLUMN deleted_by text;
+
+CREATE INDEX documents5_deleted_at_idx ON documents5 (deleted_at) WHERE deleted_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX documents5_deleted_at_idx;
+ALTER TABLE documents5 DROP COLUMN deleted_by;
+ALTER TABLE documents5 DROP COLUMN deleted_at;
+-- +goose StatementEnd
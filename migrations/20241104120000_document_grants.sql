@@ -0,0 +1,44 @@
+-- +goose Up
+-- +goose StatementBegin
+-- levels: 1 view, 2 download, 3 edit, 4 share, 5 delete, 6 owner
+CREATE TABLE document_grants (
+    document_id int      NOT NULL REFERENCES documents5 (id) ON DELETE CASCADE,
+    login       text     NOT NULL,
+    level       smallint NOT NULL CHECK (level BETWEEN 1 AND 5),
+    granted_by  text,
+    created     timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (document_id, login)
+);
+
+CREATE INDEX document_grants_login_idx ON document_grants (login);
+
+-- grantees used to be able to do anything but share; keep them at edit so
+-- that they lose only the ability to delete
+INSERT INTO document_grants (document_id, login, level)
+SELECT d.id, g, 3 FROM documents5 d, unnest(d.grants) g
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE documents5 DROP COLUMN grants;
+
+CREATE FUNCTION document_access_level(p_document_id int, p_owner text, p_login text) RETURNS smallint
+    LANGUAGE sql STABLE AS
+$$
+SELECT CASE
+           WHEN p_owner = p_login THEN 6::smallint
+           ELSE coalesce((SELECT g.level FROM document_grants g
+                          WHERE g.document_id = p_document_id AND g.login = p_login), 0::smallint)
+       END
+$$;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP FUNCTION document_access_level(int, text, text);
+
+ALTER TABLE documents5 ADD COLUMN grants text[];
+
+UPDATE documents5 d
+SET grants = ARRAY(SELECT g.login FROM document_grants g WHERE g.document_id = d.id ORDER BY g.login);
+
+DROP TABLE document_grants;
+-- +goose StatementEnd
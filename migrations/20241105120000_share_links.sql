@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE share_links (
+    id            serial PRIMARY KEY,
+    token_hash    text        NOT NULL UNIQUE,
+    document_id   int         NOT NULL REFERENCES documents5 (id) ON DELETE CASCADE,
+    created_by    text        NOT NULL,
+    created       timestamptz NOT NULL DEFAULT now(),
+    expires_at    timestamptz,
+    max_downloads int,
+    downloads     int         NOT NULL DEFAULT 0,
+    denied        int         NOT NULL DEFAULT 0,
+    last_access   timestamptz,
+    password_hash text,
+    revoked_at    timestamptz
+);
+
+CREATE INDEX share_links_document_idx ON share_links (document_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE share_links;
+-- +goose StatementEnd
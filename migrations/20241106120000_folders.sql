@@ -0,0 +1,75 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE folders (
+    id          serial PRIMARY KEY,
+    name        text        NOT NULL CHECK (name <> '' AND position('/' IN name) = 0),
+    parent_id   int REFERENCES folders (id) ON DELETE RESTRICT,
+    owner_login text        NOT NULL,
+    created     timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX folders_root_name_idx ON folders (owner_login, name) WHERE parent_id IS NULL;
+CREATE UNIQUE INDEX folders_child_name_idx ON folders (parent_id, name) WHERE parent_id IS NOT NULL;
+
+CREATE TABLE folder_grants (
+    folder_id  int      NOT NULL REFERENCES folders (id) ON DELETE CASCADE,
+    login      text     NOT NULL,
+    level      smallint NOT NULL CHECK (level BETWEEN 1 AND 5),
+    granted_by text,
+    created    timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (folder_id, login)
+);
+
+CREATE INDEX folder_grants_login_idx ON folder_grants (login);
+
+ALTER TABLE documents5 ADD COLUMN folder_id int REFERENCES folders (id) ON DELETE SET NULL;
+CREATE INDEX documents5_folder_idx ON documents5 (folder_id);
+
+-- the highest level the login holds on the folder or any of its ancestors;
+-- owning an ancestor counts as owning the folder
+CREATE FUNCTION folder_access_level(p_folder_id int, p_login text) RETURNS smallint
+    LANGUAGE sql STABLE AS
+$$
+WITH RECURSIVE chain AS (
+    SELECT f.id, f.parent_id, f.owner_login FROM folders f WHERE f.id = p_folder_id
+    UNION ALL
+    SELECT f.id, f.parent_id, f.owner_login FROM folders f JOIN chain c ON f.id = c.parent_id
+)
+SELECT coalesce(max(CASE WHEN c.owner_login = p_login THEN 6 ELSE g.level END), 0)::smallint
+FROM chain c
+LEFT JOIN folder_grants g ON g.folder_id = c.id AND g.login = p_login
+$$;
+
+-- documents inherit folder grants, but never ownership
+CREATE OR REPLACE FUNCTION document_access_level(p_document_id int, p_owner text, p_login text) RETURNS smallint
+    LANGUAGE sql STABLE AS
+$$
+SELECT CASE
+           WHEN p_owner = p_login THEN 6::smallint
+           ELSE greatest(
+                   coalesce((SELECT g.level FROM document_grants g
+                             WHERE g.document_id = p_document_id AND g.login = p_login), 0),
+                   coalesce((SELECT least(folder_access_level(d.folder_id, p_login), 5) FROM documents5 d
+                             WHERE d.id = p_document_id AND d.folder_id IS NOT NULL), 0)
+               )::smallint
+       END
+$$;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION document_access_level(p_document_id int, p_owner text, p_login text) RETURNS smallint
+    LANGUAGE sql STABLE AS
+$$
+SELECT CASE
+           WHEN p_owner = p_login THEN 6::smallint
+           ELSE coalesce((SELECT g.level FROM document_grants g
+                          WHERE g.document_id = p_document_id AND g.login = p_login), 0::smallint)
+       END
+$$;
+
+DROP FUNCTION folder_access_level(int, text);
+ALTER TABLE documents5 DROP COLUMN folder_id;
+DROP TABLE folder_grants;
+DROP TABLE folders;
+-- +goose StatementEnd
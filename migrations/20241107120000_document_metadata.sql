@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE documents5 ADD COLUMN tags text[] NOT NULL DEFAULT '{}';
+ALTER TABLE documents5 ADD COLUMN metadata jsonb NOT NULL DEFAULT '{}'
+    CHECK (jsonb_typeof(metadata) = 'object');
+
+CREATE INDEX documents5_tags_idx ON documents5 USING GIN (tags);
+CREATE INDEX documents5_metadata_idx ON documents5 USING GIN (metadata jsonb_path_ops);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX documents5_metadata_idx;
+DROP INDEX documents5_tags_idx;
+ALTER TABLE documents5 DROP COLUMN metadata;
+ALTER TABLE documents5 DROP COLUMN tags;
+-- +goose StatementEnd
@@ -0,0 +1,96 @@
+-- +goose Up
+-- +goose StatementBegin
+-- what each user's documents take up, kept current by the triggers below;
+-- versions count against the owner of their document
+CREATE TABLE user_usage (
+    login     text PRIMARY KEY,
+    bytes     bigint NOT NULL DEFAULT 0,
+    documents int    NOT NULL DEFAULT 0
+);
+
+-- per user overrides of the role quotas; null keeps the role value and
+-- zero means unlimited
+CREATE TABLE user_quotas (
+    login         text PRIMARY KEY,
+    max_bytes     bigint CHECK (max_bytes >= 0),
+    max_documents int    CHECK (max_documents >= 0),
+    max_file_size bigint CHECK (max_file_size >= 0)
+);
+
+-- documents from before owners were recorded have none and count for nobody
+CREATE FUNCTION add_usage(p_login text, p_bytes bigint, p_documents int) RETURNS void
+    LANGUAGE sql AS
+$$
+INSERT INTO user_usage (login, bytes, documents)
+SELECT p_login, p_bytes, p_documents WHERE p_login IS NOT NULL
+ON CONFLICT (login) DO UPDATE
+SET bytes = user_usage.bytes + EXCLUDED.bytes, documents = user_usage.documents + EXCLUDED.documents;
+$$;
+
+-- a version deleted together with its document finds no document any more;
+-- documents_usage accounts for it instead
+CREATE FUNCTION document_versions_usage() RETURNS trigger
+    LANGUAGE plpgsql AS
+$$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        PERFORM add_usage(d.owner_login, NEW.size, 0) FROM documents5 d WHERE d.id = NEW.document_id;
+        RETURN NEW;
+    END IF;
+    PERFORM add_usage(d.owner_login, -OLD.size, 0) FROM documents5 d WHERE d.id = OLD.document_id;
+    RETURN OLD;
+END;
+$$;
+
+CREATE TRIGGER document_versions_usage AFTER INSERT OR DELETE ON document_versions
+    FOR EACH ROW EXECUTE FUNCTION document_versions_usage();
+
+CREATE FUNCTION documents_usage() RETURNS trigger
+    LANGUAGE plpgsql AS
+$$
+DECLARE
+    v_bytes bigint;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        PERFORM add_usage(NEW.owner_login, 0, 1);
+        RETURN NEW;
+    END IF;
+    SELECT coalesce(sum(size), 0) INTO v_bytes FROM document_versions WHERE document_id = OLD.id;
+    PERFORM add_usage(OLD.owner_login, -v_bytes, -1);
+    IF TG_OP = 'DELETE' THEN
+        RETURN OLD;
+    END IF;
+    PERFORM add_usage(NEW.owner_login, v_bytes, 1);
+    RETURN NEW;
+END;
+$$;
+
+CREATE TRIGGER documents_usage_insert AFTER INSERT ON documents5
+    FOR EACH ROW EXECUTE FUNCTION documents_usage();
+-- before the delete, while the versions are still there
+CREATE TRIGGER documents_usage_delete BEFORE DELETE ON documents5
+    FOR EACH ROW EXECUTE FUNCTION documents_usage();
+CREATE TRIGGER documents_usage_owner AFTER UPDATE OF owner_login ON documents5
+    FOR EACH ROW WHEN (OLD.owner_login IS DISTINCT FROM NEW.owner_login)
+    EXECUTE FUNCTION documents_usage();
+
+INSERT INTO user_usage (login, bytes, documents)
+SELECT d.owner_login, coalesce(sum(v.bytes), 0), count(*)
+FROM documents5 d
+LEFT JOIN (SELECT document_id, sum(size) AS bytes FROM document_versions GROUP BY document_id) v ON v.document_id = d.id
+WHERE d.owner_login IS NOT NULL
+GROUP BY d.owner_login;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER documents_usage_owner ON documents5;
+DROP TRIGGER documents_usage_delete ON documents5;
+DROP TRIGGER documents_usage_insert ON documents5;
+DROP FUNCTION documents_usage();
+DROP TRIGGER document_versions_usage ON document_versions;
+DROP FUNCTION document_versions_usage();
+DROP FUNCTION add_usage(text, bigint, int);
+DROP TABLE user_quotas;
+DROP TABLE user_usage;
+-- +goose StatementEnd
@@ -0,0 +1,57 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE documents5 ADD COLUMN expires_at timestamptz;
+ALTER TABLE documents5 ADD COLUMN expiry_notified_at timestamptz;
+
+-- a rule applies to documents that match all of its criteria; a folder rule
+-- covers the subfolders too
+CREATE TABLE retention_rules (
+    id         serial PRIMARY KEY,
+    tag        text,
+    folder_id  int REFERENCES folders (id) ON DELETE CASCADE,
+    mime       text,
+    days       int         NOT NULL CHECK (days > 0),
+    created_by text,
+    created    timestamptz NOT NULL DEFAULT now(),
+    CHECK (tag IS NOT NULL OR folder_id IS NOT NULL OR mime IS NOT NULL)
+);
+
+-- the earlier of the expiry set on the document and the one implied by the
+-- retention rules matching it, null if neither exists
+CREATE FUNCTION document_expiry(p_expires_at timestamptz, p_created timestamptz, p_tags text[], p_folder_id int, p_mime text)
+    RETURNS timestamptz
+    LANGUAGE sql STABLE AS
+$$
+WITH RECURSIVE chain AS (
+    SELECT f.id, f.parent_id FROM folders f WHERE f.id = p_folder_id
+    UNION ALL
+    SELECT f.id, f.parent_id FROM folders f JOIN chain c ON f.id = c.parent_id
+)
+SELECT least(p_expires_at, min(p_created + make_interval(days => r.days)))
+FROM retention_rules r
+WHERE (r.tag IS NULL OR p_tags @> ARRAY[r.tag])
+  AND (r.mime IS NULL OR r.mime = p_mime OR (right(r.mime, 2) = '/*' AND p_mime LIKE left(r.mime, -1) || '%'))
+  AND (r.folder_id IS NULL OR r.folder_id IN (SELECT id FROM chain))
+$$;
+
+CREATE TABLE notifications (
+    id          serial PRIMARY KEY,
+    login       text        NOT NULL,
+    kind        text        NOT NULL,
+    document_id int REFERENCES documents5 (id) ON DELETE SET NULL,
+    message     text        NOT NULL,
+    created     timestamptz NOT NULL DEFAULT now(),
+    read_at     timestamptz
+);
+
+CREATE INDEX notifications_login_idx ON notifications (login, id DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE notifications;
+DROP FUNCTION document_expiry(timestamptz, timestamptz, text[], int, text);
+DROP TABLE retention_rules;
+ALTER TABLE documents5 DROP COLUMN expiry_notified_at;
+ALTER TABLE documents5 DROP COLUMN expires_at;
+-- +goose StatementEnd
@@ -0,0 +1,78 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE documents5 ADD COLUMN legal_hold boolean NOT NULL DEFAULT false;
+ALTER TABLE documents5 ADD COLUMN immutable_until timestamptz;
+
+-- entries are kept after their document is purged
+CREATE TABLE audit_log (
+    id          bigserial PRIMARY KEY,
+    login       text        NOT NULL,
+    action      text        NOT NULL,
+    document_id int,
+    outcome     text        NOT NULL,
+    detail      text        NOT NULL DEFAULT '',
+    created     timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX audit_log_document_idx ON audit_log (document_id, id DESC);
+
+CREATE FUNCTION document_held(p_id int) RETURNS boolean
+    LANGUAGE sql STABLE AS
+$$
+SELECT coalesce(bool_or(d.legal_hold OR d.immutable_until > now()), false) FROM documents5 d WHERE d.id = p_id;
+$$;
+
+-- the application refuses changes to held documents and audits the
+-- attempts; these triggers guarantee that nothing slips through
+CREATE FUNCTION documents_worm() RETURNS trigger
+    LANGUAGE plpgsql AS
+$$
+BEGIN
+    -- releasing a legal hold is allowed, shortening an immutability period
+    -- is not
+    IF (OLD.legal_hold OR OLD.immutable_until > now()) AND (TG_OP = 'DELETE'
+        OR NEW.deleted_at IS NOT NULL AND OLD.deleted_at IS NULL
+        OR NEW.current_version IS DISTINCT FROM OLD.current_version OR NEW.name IS DISTINCT FROM OLD.name
+        OR NEW.tags IS DISTINCT FROM OLD.tags OR NEW.metadata IS DISTINCT FROM OLD.metadata
+        OR OLD.immutable_until > now() AND (NEW.immutable_until IS NULL OR NEW.immutable_until < OLD.immutable_until)) THEN
+        RAISE EXCEPTION 'document % is immutable', OLD.id;
+    END IF;
+    IF TG_OP = 'DELETE' THEN
+        RETURN OLD;
+    END IF;
+    RETURN NEW;
+END;
+$$;
+
+CREATE TRIGGER documents_worm BEFORE UPDATE OR DELETE ON documents5
+    FOR EACH ROW EXECUTE FUNCTION documents_worm();
+
+CREATE FUNCTION document_children_worm() RETURNS trigger
+    LANGUAGE plpgsql AS
+$$
+BEGIN
+    IF document_held(OLD.document_id) THEN
+        RAISE EXCEPTION 'document % is immutable', OLD.document_id;
+    END IF;
+    RETURN OLD;
+END;
+$$;
+
+CREATE TRIGGER document_versions_worm BEFORE DELETE ON document_versions
+    FOR EACH ROW EXECUTE FUNCTION document_children_worm();
+CREATE TRIGGER document_grants_worm BEFORE DELETE ON document_grants
+    FOR EACH ROW EXECUTE FUNCTION document_children_worm();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER document_grants_worm ON document_grants;
+DROP TRIGGER document_versions_worm ON document_versions;
+DROP FUNCTION document_children_worm();
+DROP TRIGGER documents_worm ON documents5;
+DROP FUNCTION documents_worm();
+DROP FUNCTION document_held(int);
+DROP TABLE audit_log;
+ALTER TABLE documents5 DROP COLUMN immutable_until;
+ALTER TABLE documents5 DROP COLUMN legal_hold;
+-- +goose StatementEnd
@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+-- hex SHA-256 of the content; versions stored before this column existed
+-- get theirs from the first scrub
+ALTER TABLE document_versions ADD COLUMN sha256 text;
+
+CREATE TABLE scrub_reports (
+    id        serial PRIMARY KEY,
+    started   timestamptz NOT NULL DEFAULT now(),
+    updated   timestamptz NOT NULL DEFAULT now(),
+    finished  timestamptz,
+    versions  int         NOT NULL DEFAULT 0,
+    recorded  int         NOT NULL DEFAULT 0,
+    blobs     int         NOT NULL DEFAULT 0,
+    missing   int         NOT NULL DEFAULT 0,
+    corrupted int         NOT NULL DEFAULT 0,
+    orphaned  int         NOT NULL DEFAULT 0,
+    problems  jsonb       NOT NULL DEFAULT '[]',
+    error     text        NOT NULL DEFAULT ''
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE scrub_reports;
+ALTER TABLE document_versions DROP COLUMN sha256;
+-- +goose StatementEnd
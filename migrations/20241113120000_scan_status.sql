@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+-- existing versions were never scanned; scan_result names what was found
+ALTER TABLE document_versions ADD COLUMN scan_status text NOT NULL DEFAULT 'pending'
+    CHECK (scan_status IN ('pending', 'clean', 'infected'));
+ALTER TABLE document_versions ADD COLUMN scan_result text;
+
+CREATE INDEX document_versions_pending_idx ON document_versions (document_id, version) WHERE scan_status = 'pending';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX document_versions_pending_idx;
+ALTER TABLE document_versions DROP COLUMN scan_result;
+ALTER TABLE document_versions DROP COLUMN scan_status;
+-- +goose StatementEnd
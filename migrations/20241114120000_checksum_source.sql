@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+-- where the checksum of a version comes from: 'upload' when it was taken of
+-- the content as it arrived, 'computed' when it was taken of the stored blob
+-- later, by a scrub or the version backfill, which cannot show corruption
+-- that happened before. Checksums of versions older than the integrity
+-- migration were recorded by a scrub.
+ALTER TABLE document_versions ADD COLUMN sha256_source text
+    CHECK (sha256_source IN ('upload', 'computed'));
+
+UPDATE document_versions v
+SET sha256_source = CASE
+    WHEN v.created < (SELECT min(g.tstamp) FROM goose_db_version g WHERE g.version_id = 20241112120000 AND g.is_applied)
+    THEN 'computed' ELSE 'upload' END
+WHERE v.sha256 IS NOT NULL;
+
+ALTER TABLE scrub_reports ADD COLUMN unverified int NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE scrub_reports DROP COLUMN unverified;
+ALTER TABLE document_versions DROP COLUMN sha256_source;
+-- +goose StatementEnd